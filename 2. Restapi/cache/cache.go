@@ -0,0 +1,45 @@
+// Package cache keeps values for a limited time, in the memory of the process or in Redis
+// The values are bytes, so that both backends behave the same way: what is read back is a copy of what was stored
+package cache
+
+import (
+	"context"
+	"fmt"
+	"my-rest-api/configs"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores values by key, each one for the time-to-live the cache was created with
+// it is safe for concurrent use, the values which are read back must not be modified
+type Cache interface {
+	// Get returns the value stored under the key, false when there is none (or it expired)
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores a value under the key, replacing the previous one
+	Set(ctx context.Context, key string, value []byte) error
+
+	// Delete removes the value stored under the key, if any
+	Delete(ctx context.Context, key string) error
+}
+
+// function to create the cache of the configured backend, there is none (nil) with the none backend
+// the Redis client connects on its first command, an unreachable server does not stop the api from starting
+func New(cfg configs.Cache) (Cache, error) {
+	switch cfg.Backend {
+	case configs.CacheMemory:
+		return NewLRU(cfg.Size, cfg.TTL), nil
+
+	case configs.CacheRedis:
+		options, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("redisURL: %w", err)
+		}
+		return NewRedis(redis.NewClient(options), cfg.TTL), nil
+
+	case configs.CacheNone:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"my-rest-api/configs"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// function to check the behaviour both backends share
+func checkCache(t *testing.T, c Cache) {
+	ctx := context.Background()
+
+	_, ok, err := c.Get(ctx, "missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	value := []byte("Ada")
+	assert.NoError(t, c.Set(ctx, "a", value))
+	value[0] = 'I'
+
+	got, ok, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Ada", string(got), "the value is stored as it was when it was set")
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("Grace")))
+	got, _, _ = c.Get(ctx, "a")
+	assert.Equal(t, "Grace", string(got))
+
+	assert.NoError(t, c.Delete(ctx, "a"))
+	assert.NoError(t, c.Delete(ctx, "a"), "deleting a missing key is not an error")
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok)
+}
+
+func TestLRU(t *testing.T) {
+	checkCache(t, NewLRU(10, time.Minute))
+
+	ctx := context.Background()
+	clock := time.Now()
+	c := NewLRU(2, time.Minute)
+	c.now = func() time.Time { return clock }
+
+	// the least recently used value is forgotten first
+	c.Set(ctx, "a", []byte("1"))
+	c.Set(ctx, "b", []byte("2"))
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"))
+	assert.Equal(t, 2, c.Len())
+
+	_, ok, _ := c.Get(ctx, "b")
+	assert.False(t, ok, "b was the least recently used")
+	_, ok, _ = c.Get(ctx, "a")
+	assert.True(t, ok)
+
+	// the values expire after their time-to-live
+	clock = clock.Add(time.Minute)
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len(), "an expired value is removed once it is looked up")
+}
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute)
+	defer c.Close(context.Background())
+
+	checkCache(t, c)
+
+	// the values expire on the server
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("Ada"))
+	assert.Equal(t, time.Minute, server.TTL("a"))
+	server.FastForward(time.Minute)
+	_, ok, _ := c.Get(ctx, "a")
+	assert.False(t, ok)
+
+	// an unreachable server is an error, which the callers treat as a miss
+	server.Close()
+	_, ok, err := c.Get(ctx, "a")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(configs.Cache{Backend: configs.CacheNone})
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	c, err = New(configs.Cache{Backend: configs.CacheMemory, Size: 10, TTL: time.Minute})
+	assert.NoError(t, err)
+	assert.IsType(t, &LRU{}, c)
+
+	c, err = New(configs.Cache{Backend: configs.CacheRedis, TTL: time.Minute, RedisURL: "redis://localhost:6379/1"})
+	if assert.NoError(t, err) {
+		assert.IsType(t, &Redis{}, c)
+		c.(*Redis).Close(context.Background())
+	}
+
+	_, err = New(configs.Cache{Backend: configs.CacheRedis, RedisURL: "http://localhost"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+// File containing the in-process cache, it holds a bounded number of values and forgets the least recently used first
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// making sure the implementation keeps satisfying the interface
+var _ Cache = (*LRU)(nil)
+
+// LRU is a cache living in the memory of the process
+// every instance of the api has its own, so a change made through another instance is only seen once the value expires
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+
+	// the entries from the most recently used to the least recently used one
+	order *list.List
+
+	// the clock of the expirations, replaced by the tests
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// function to create a cache holding at most size values, each one for ttl
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{size: size, ttl: ttl, entries: map[string]*list.Element{}, order: list.New(), now: time.Now}
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *LRU) Set(_ context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the value is copied so that the caller can keep using its slice
+	entry := &lruEntry{key: key, value: append([]byte(nil), value...), expires: c.now().Add(c.ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	return nil
+}
+
+// function to tell how many values the cache holds, the expired ones which were not looked up since included
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
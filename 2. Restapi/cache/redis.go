@@ -0,0 +1,50 @@
+// File containing the cache backed by Redis, it is shared by every instance of the api
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// making sure the implementation keeps satisfying the interface
+var _ Cache = (*Redis)(nil)
+
+// Redis is a cache stored in a Redis server, the values expire on the server
+// since every instance of the api uses the same one, a change made through any instance is seen by all of them
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// function to create a cache on top of a Redis client, each value is kept for ttl
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte) error {
+	return c.client.Set(ctx, key, value, c.ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// function to close the connections to the server, to call once nothing uses the cache anymore
+func (c *Redis) Close(_ context.Context) error {
+	return c.client.Close()
+}
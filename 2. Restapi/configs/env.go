@@ -3,17 +3,39 @@
 package configs
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/joho/godotenv"
 )
 
-func EnvMongoURI() string {
+// name of the environment variable pointing at the config file, like the --config flag
+const EnvConfigFile = "CONFIG_FILE"
+
+// function to load the variables of the .env file into the environment
+// the file is optional, and a variable which is already set in the environment is not overwritten by it
+func loadDotEnv() error {
 	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading .env: %w", err)
+	}
+	return nil
+}
+
+// function to apply the settings set in the environment, under the name in their env tag
+func applyEnv(cfg *Config) error {
+	for _, setting := range settings(cfg) {
+		value, ok := os.LookupEnv(setting.env)
+		if !ok || setting.env == "" {
+			continue
+		}
+
+		if err := setting.set(value); err != nil {
+			return fmt.Errorf("%s: %w", setting.env, err)
+		}
 	}
 
-	return os.Getenv("MONGOURI")
+	return nil
 }
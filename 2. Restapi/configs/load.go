@@ -0,0 +1,275 @@
+// File responsible for building the configuration out of its layers
+// Every setting starts at its default and is then overwritten by the config file, the environment and the command line,
+// in that order, so that a flag always wins. The names of a setting in each layer come from the tags of Config
+
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// CommandLine is what the api is started with, the configuration and whatever the flags did not consume
+type CommandLine struct {
+	Config Config
+
+	// --print-config asks for the configuration to be printed instead of starting the api
+	PrintConfig bool
+
+	// the command which follows the flags, e.g. "migrate up"
+	Args []string
+}
+
+// function to build the configuration out of the defaults, the config file, the environment and the flags
+// the flags are read up to the first argument which is not one, that argument and the ones after it are the command
+// the configuration is validated once every layer is applied
+func Load(args []string) (CommandLine, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := flags.String("config", "", "YAML or TOML config file, also read from $"+EnvConfigFile)
+	printConfig := flags.Bool("print-config", false, "print the configuration with its secrets redacted and exit")
+
+	// the flags are only applied once the other layers are, so that they win
+	set := map[string]string{}
+	for _, setting := range settings(&cfg) {
+		flags.Var(&flagValue{setting: setting, set: set}, setting.flag, setting.usage+" ($"+setting.env+")")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return CommandLine{}, err
+	}
+
+	if err := loadDotEnv(); err != nil {
+		return CommandLine{}, err
+	}
+
+	if *file == "" {
+		*file = os.Getenv(EnvConfigFile)
+	}
+	if *file != "" {
+		if err := applyFile(&cfg, *file); err != nil {
+			return CommandLine{}, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return CommandLine{}, err
+	}
+
+	for _, setting := range settings(&cfg) {
+		if value, ok := set[setting.flag]; ok {
+			if err := setting.set(value); err != nil {
+				return CommandLine{}, fmt.Errorf("-%s: %w", setting.flag, err)
+			}
+		}
+	}
+
+	// a configuration which cannot be started with can still be printed, to find out what is wrong with it
+	if !*printConfig {
+		if err := cfg.Validate(); err != nil {
+			return CommandLine{}, err
+		}
+	}
+
+	return CommandLine{Config: cfg, PrintConfig: *printConfig, Args: flags.Args()}, nil
+}
+
+// function to apply a YAML (.yaml, .yml) or TOML (.toml) config file, a setting it does not know is a mistake
+// the keys are the yaml tags of Config, TOML matches them without taking the case into account
+func applyFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading the config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+	case ".toml":
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+		}
+
+	default:
+		return fmt.Errorf("%s: the config file must be a .yaml, .yml or .toml file", path)
+	}
+
+	return nil
+}
+
+// function to write the configuration as YAML, in the format of the config file, with the secret settings redacted
+func Print(w io.Writer, cfg Config) error {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	describe(node, reflect.ValueOf(cfg))
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// function to add the fields of a section of the configuration to a YAML mapping, in the order they are declared
+func describe(node *yaml.Node, section reflect.Value) {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Type().Field(i)
+		value := section.Field(i)
+
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.Tag.Get("yaml")}
+		if value.Kind() == reflect.Struct {
+			child := &yaml.Node{Kind: yaml.MappingNode}
+			describe(child, value)
+			node.Content = append(node.Content, key, child)
+			continue
+		}
+
+		text, tag := format(value), "!!str"
+		if field.Tag.Get("secret") == "true" {
+			text = redact(text)
+		}
+		// the numbers are left for YAML to resolve, so that 1 is not written as !!float 1
+		switch value.Kind() {
+		case reflect.Bool:
+			tag = "!!bool"
+		case reflect.Int, reflect.Float64:
+			tag = ""
+		}
+		node.Content = append(node.Content, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: text})
+	}
+}
+
+// setting is a single value of the configuration, along with its names in the environment and on the command line
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value reflect.Value
+}
+
+// function to list the settings of a configuration, the sections (TLS, Timeouts, Tracing, Cache) are walked into
+// the settings point into the given configuration, setting one of them changes it
+func settings(cfg *Config) []setting {
+	var found []setting
+
+	var walk func(section reflect.Value)
+	walk = func(section reflect.Value) {
+		for i := 0; i < section.NumField(); i++ {
+			field := section.Type().Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(section.Field(i))
+				continue
+			}
+
+			found = append(found, setting{env: field.Tag.Get("env"), flag: field.Tag.Get("flag"), usage: field.Tag.Get("usage"), value: section.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+
+	return found
+}
+
+// function to read a value written as text into the setting
+func (s setting) set(value string) error {
+	parsed, err := parse(s.value.Type(), value)
+	if err != nil {
+		return err
+	}
+
+	s.value.Set(parsed)
+	return nil
+}
+
+// flagValue is the flag of a setting, it only checks and remembers the value until the flags are applied
+type flagValue struct {
+	setting setting
+	set     map[string]string
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.setting.value.IsValid() {
+		return ""
+	}
+	return format(f.setting.value)
+}
+
+func (f *flagValue) Set(value string) error {
+	if _, err := parse(f.setting.value.Type(), value); err != nil {
+		return err
+	}
+
+	f.set[f.setting.flag] = value
+	return nil
+}
+
+// the boolean settings can be turned on with their flag alone, e.g. -migrate-on-startup
+func (f *flagValue) IsBoolFlag() bool {
+	return f.setting.value.Kind() == reflect.Bool
+}
+
+func parse(t reflect.Type, value string) (reflect.Value, error) {
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%q is not a duration such as 10s or 720h", value)
+		}
+		return reflect.ValueOf(duration), nil
+
+	case t.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%q is neither true nor false", value)
+		}
+		return reflect.ValueOf(parsed), nil
+
+	case t.Kind() == reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%q is not a whole number", value)
+		}
+		return reflect.ValueOf(parsed), nil
+
+	case t.Kind() == reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%q is not a number", value)
+		}
+		return reflect.ValueOf(parsed), nil
+
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(value), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("settings of type %s are not supported", t)
+}
+
+// function to write the value of a setting the way it is read back
+func format(value reflect.Value) string {
+	if duration, ok := value.Interface().(time.Duration); ok {
+		return duration.String()
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -5,40 +5,298 @@ package configs
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-//	function to connect to the client
-func ConnectDB() *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI(EnvMongoURI()))
-	if err != nil {
-		log.Fatal(err)
+// Config holds everything the application needs to start
+// It is built once in main by Load and handed down to the pieces that need it
+// The tags give the name of every setting in the config file, the environment and the command line, see load.go
+type Config struct {
+	ListenAddr string    `yaml:"listenAddr" env:"LISTEN_ADDR" flag:"listen-addr" usage:"address the REST api listens on"`
+	GRPCAddr   string    `yaml:"grpcAddr" env:"GRPC_ADDR" flag:"grpc-addr" usage:"address the gRPC api listens on"`
+	TLS        TLSConfig `yaml:"tls"`
+
+	// the URI may carry the credentials of the database, it is redacted when the configuration is printed
+	MongoURI string `yaml:"mongoURI" env:"MONGOURI" flag:"mongo-uri" usage:"connection string of MongoDB" secret:"true"`
+	Database string `yaml:"database" env:"DATABASE" flag:"database" usage:"name of the database holding the students"`
+
+	Timeouts Timeouts `yaml:"timeouts"`
+
+	// how long deleted students are kept in the trash before they can be purged
+	TrashRetention time.Duration `yaml:"trashRetention" env:"TRASH_RETENTION" flag:"trash-retention" usage:"how long deleted students are kept in the trash"`
+
+	// applying the pending migrations before serving the api
+	MigrateOnStartup bool `yaml:"migrateOnStartup" env:"MIGRATE_ON_STARTUP" flag:"migrate-on-startup" usage:"apply the pending migrations before serving the api"`
+
+	// checking every response against the OpenAPI document, which the tests turn on
+	ValidateResponses bool `yaml:"validateResponses" env:"VALIDATE_RESPONSES" flag:"validate-responses" usage:"check every response against the OpenAPI document"`
+
+	Tracing Tracing `yaml:"tracing"`
+
+	Cache Cache `yaml:"cache"`
+
+	// the logs are written as JSON lines on stdout, from this level on
+	LogLevel string `yaml:"logLevel" env:"LOG_LEVEL" flag:"log-level" usage:"lowest level of the logs written: debug, info, warn or error"`
+}
+
+// TLSConfig holds the certificate both apis are served with, they are served in plain text without one
+type TLSConfig struct {
+	CertFile string `yaml:"certFile" env:"TLS_CERT_FILE" flag:"tls-cert-file" usage:"PEM certificate to serve the apis with over TLS"`
+	KeyFile  string `yaml:"keyFile" env:"TLS_KEY_FILE" flag:"tls-key-file" usage:"PEM private key of the certificate"`
+}
+
+// Timeouts holds the time limits of the server and of the database, 0 means no limit
+type Timeouts struct {
+	Read    time.Duration `yaml:"read" env:"READ_TIMEOUT" flag:"read-timeout" usage:"maximum time to read a request"`
+	Write   time.Duration `yaml:"write" env:"WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum time to write a response"`
+	Idle    time.Duration `yaml:"idle" env:"IDLE_TIMEOUT" flag:"idle-timeout" usage:"maximum time to keep an idle connection open"`
+	Request time.Duration `yaml:"request" env:"REQUEST_TIMEOUT" flag:"request-timeout" usage:"maximum time the queries of one request may take"`
+	Connect time.Duration `yaml:"connect" env:"CONNECT_TIMEOUT" flag:"connect-timeout" usage:"maximum time to connect to MongoDB"`
+
+	// how long the api keeps serving once it reports it is not ready anymore, for the orchestrator to stop sending it traffic
+	Drain time.Duration `yaml:"drain" env:"DRAIN_DELAY" flag:"drain-delay" usage:"time between failing the readiness probe and refusing new connections when stopping"`
+
+	// how long the requests in progress are given to finish once the api is asked to stop
+	Shutdown time.Duration `yaml:"shutdown" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"maximum time to drain the requests in progress when stopping"`
+}
+
+// Tracing holds where the spans of the requests are exported, nothing is recorded with the none exporter
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"where the spans are exported: none, stdout or otlp"`
+	Endpoint    string  `yaml:"endpoint" env:"OTLP_ENDPOINT" flag:"otlp-endpoint" usage:"host:port of the OTLP collector, spoken to over gRPC"`
+	Insecure    bool    `yaml:"insecure" env:"OTLP_INSECURE" flag:"otlp-insecure" usage:"speak to the OTLP collector without TLS"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"share of the traces started by the api which are recorded, from 0 to 1"`
+	ServiceName string  `yaml:"serviceName" env:"SERVICE_NAME" flag:"service-name" usage:"name of the api in the traces"`
+}
+
+// Cache holds where the students read by ID are kept, so that the same student is not fetched from the database again and again
+type Cache struct {
+	Backend  string        `yaml:"backend" env:"CACHE_BACKEND" flag:"cache-backend" usage:"where the students read by ID are cached: none, memory or redis"`
+	Size     int           `yaml:"size" env:"CACHE_SIZE" flag:"cache-size" usage:"how many students the memory cache holds at most"`
+	TTL      time.Duration `yaml:"ttl" env:"CACHE_TTL" flag:"cache-ttl" usage:"how long a student stays in the cache"`
+	RedisURL string        `yaml:"redisURL" env:"REDIS_URL" flag:"redis-url" usage:"connection string of Redis, e.g. redis://localhost:6379/0" secret:"true"`
+}
+
+// the backends of the cache
+const (
+	CacheNone   = "none"
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+// the exporters of the spans
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// function to build the configuration used when nothing else is set
+func Default() Config {
+	return Config{
+		ListenAddr: ":6000",
+		GRPCAddr:   ":6001",
+		Database:   "Records",
+		Timeouts: Timeouts{
+			Read:    30 * time.Second,
+			Write:   30 * time.Second,
+			Idle:    2 * time.Minute,
+			Request: 10 * time.Second,
+			Connect: 10 * time.Second,
+
+			// enough for a load balancer probing every few seconds to notice, well within the shutdown timeout
+			Drain:    5 * time.Second,
+			Shutdown: 15 * time.Second,
+		},
+		TrashRetention: 30 * 24 * time.Hour,
+		LogLevel:       "info",
+		Cache: Cache{
+			Backend: CacheMemory,
+			Size:    10000,
+			TTL:     30 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter:    ExporterNone,
+			SampleRatio: 1,
+			ServiceName: "student-api",
+		},
 	}
+}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	err = client.Connect(ctx)
+// function to read the level of the logs, info when it cannot be read (Validate reports it)
+func (c Config) Level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// function to tell whether the apis are served over TLS
+func (c Config) TLSEnabled() bool {
+	return c.TLS.CertFile != ""
+}
+
+// function to check that the configuration can be started with, every mistake is reported at once
+func (c Config) Validate() error {
+	var problems []string
+
+	for name, addr := range map[string]string{"listenAddr": c.ListenAddr, "grpcAddr": c.GRPCAddr} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be an address such as :6000, got %q", name, addr))
+		}
+	}
+	if c.ListenAddr != "" && c.ListenAddr == c.GRPCAddr {
+		problems = append(problems, "listenAddr and grpcAddr must be different addresses")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls.certFile and tls.keyFile must be set together")
+	}
+
+	if !strings.HasPrefix(c.MongoURI, "mongodb://") && !strings.HasPrefix(c.MongoURI, "mongodb+srv://") {
+		problems = append(problems, "mongoURI must be set to a mongodb:// or mongodb+srv:// connection string")
+	}
+	if c.Database == "" {
+		problems = append(problems, "database must be set")
+	}
+
+	for name, timeout := range map[string]time.Duration{"read": c.Timeouts.Read, "write": c.Timeouts.Write, "idle": c.Timeouts.Idle, "request": c.Timeouts.Request, "connect": c.Timeouts.Connect, "drain": c.Timeouts.Drain, "shutdown": c.Timeouts.Shutdown} {
+		if timeout < 0 {
+			problems = append(problems, fmt.Sprintf("timeouts.%s must not be negative", name))
+		}
+	}
+	if c.Timeouts.Shutdown > 0 && c.Timeouts.Drain >= c.Timeouts.Shutdown {
+		problems = append(problems, "timeouts.drain must be shorter than timeouts.shutdown, which it is part of")
+	}
+	if c.TrashRetention < 0 {
+		problems = append(problems, "trashRetention must not be negative")
+	}
+
+	switch c.Tracing.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if _, _, err := net.SplitHostPort(c.Tracing.Endpoint); err != nil {
+			problems = append(problems, fmt.Sprintf("tracing.endpoint must be the host:port of the OTLP collector, got %q", c.Tracing.Endpoint))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be one of none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sampleRatio must be between 0 and 1")
+	}
+
+	switch c.Cache.Backend {
+	case CacheNone:
+	case CacheMemory, CacheRedis:
+		if c.Cache.TTL <= 0 {
+			problems = append(problems, "cache.ttl must be positive")
+		}
+		if c.Cache.Backend == CacheMemory && c.Cache.Size <= 0 {
+			problems = append(problems, "cache.size must be positive")
+		}
+		if c.Cache.Backend == CacheRedis && !strings.HasPrefix(c.Cache.RedisURL, "redis://") && !strings.HasPrefix(c.Cache.RedisURL, "rediss://") {
+			problems = append(problems, "cache.redisURL must be set to a redis:// or rediss:// connection string")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cache.backend must be one of none, memory or redis, got %q", c.Cache.Backend))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		problems = append(problems, fmt.Sprintf("logLevel must be one of debug, info, warn or error, got %q", c.LogLevel))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	// the maps are iterated in random order, the report should not be
+	sort.Strings(problems)
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// function to hide a secret setting, only the password of a URL is hidden since the rest tells what the api connects to
+// any other value (or a URL which cannot be parsed) is hidden entirely
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" {
+		return "[redacted]"
+	}
+	return parsed.Redacted()
+}
+
+// function to connect to the client
+// the options are applied on top of the URI, e.g. the monitors of the driver
+func ConnectDB(uri string, timeout time.Duration, opts ...*options.ClientOptions) (*mongo.Client, error) {
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{options.Client().ApplyURI(uri)}, opts...)...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	//ping the database
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal(err)
+	if err = client.Ping(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	slog.Info("connected to MongoDB")
+	return client, nil
+}
+
+// function to combine command monitors into one, since the driver only takes a single one
+// e.g. the one measuring the commands and the one tracing them
+func CommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Started != nil {
+					monitor.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				if monitor.Succeeded != nil {
+					monitor.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Failed != nil {
+					monitor.Failed(ctx, e)
+				}
+			}
+		},
 	}
-	fmt.Println("Connected to MongoDB")
-	return client
 }
 
-//	Client instance
-var DB *mongo.Client = ConnectDB()
+// function to create a context limited to the given time, 0 means no limit
+func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
 
-//	getting database collections
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	collection := client.Database("Records").Collection(collectionName)
+// getting database collections
+func GetCollection(client *mongo.Client, database string, collectionName string) *mongo.Collection {
+	collection := client.Database(database).Collection(collectionName)
 	return collection
 }
@@ -0,0 +1,231 @@
+// File responsible for turning the errors returned by the handlers into application/problem+json responses
+// The handlers only return errors, ErrorHandler is the one place deciding what the client gets to see
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"my-rest-api/filters"
+	"my-rest-api/openapi"
+	"my-rest-api/repository"
+	"my-rest-api/responses"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorKind is the kind of problem an error response is about, it is sent in the "type" of the problem
+type ErrorKind string
+
+const (
+	KindNotFound             ErrorKind = "not-found"
+	KindInvalidID            ErrorKind = "invalid-id"
+	KindValidation           ErrorKind = "validation"
+	KindBadRequest           ErrorKind = "bad-request"
+	KindConflict             ErrorKind = "conflict"
+	KindPreconditionFailed   ErrorKind = "precondition-failed"
+	KindUnsupportedMediaType ErrorKind = "unsupported-media-type"
+	KindInternal             ErrorKind = "internal"
+)
+
+// the types of the problems are relative URIs made of this prefix and the kind, e.g. "/problems/not-found"
+const ProblemTypePrefix = "/problems/"
+
+// the status and the title which go with every kind of problem
+var errorKinds = map[ErrorKind]struct {
+	status int
+	title  string
+}{
+	KindNotFound:             {http.StatusNotFound, "Resource not found"},
+	KindInvalidID:            {http.StatusBadRequest, "Invalid identifier"},
+	KindValidation:           {http.StatusBadRequest, "Validation failed"},
+	KindBadRequest:           {http.StatusBadRequest, "Bad request"},
+	KindConflict:             {http.StatusConflict, "Conflict"},
+	KindPreconditionFailed:   {http.StatusPreconditionFailed, "Precondition failed"},
+	KindUnsupportedMediaType: {http.StatusUnsupportedMediaType, "Unsupported media type"},
+	KindInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// APIError is an error of a known kind, Detail is shown to the client while Err is only logged
+type APIError struct {
+	Kind   ErrorKind
+	Detail string
+	Fields []responses.FieldError
+	Err    error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Detail)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func notFound(detail string) *APIError {
+	return &APIError{Kind: KindNotFound, Detail: detail}
+}
+
+func badRequest(detail string) *APIError {
+	return &APIError{Kind: KindBadRequest, Detail: detail}
+}
+
+func conflict(detail string) *APIError {
+	return &APIError{Kind: KindConflict, Detail: detail}
+}
+
+// function to build the error of a request body which cannot be read into a student
+// a value of the wrong type is reported like a failed rule so that the client knows which field to fix
+func bodyError(err error) *APIError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		expected := jsonType(typeErr.Type.Kind().String())
+		return &APIError{Kind: KindValidation, Detail: "the request body does not match the student model", Fields: []responses.FieldError{
+			{Field: typeErr.Field, Rule: "type", Param: expected, Message: fmt.Sprintf("must be a %s, got a %s", expected, typeErr.Value)},
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return badRequest(fmt.Sprintf("the request body is not valid JSON: %s", syntaxErr.Error()))
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return &APIError{Kind: KindUnsupportedMediaType, Detail: "the request body must be sent as application/json"}
+	}
+
+	return badRequest(err.Error())
+}
+
+// function to name a go type the way json does
+func jsonType(kind string) string {
+	switch kind {
+	case "float32", "float64", "int", "int64":
+		return "number"
+	case "struct", "map":
+		return "object"
+	}
+	return kind
+}
+
+// function to turn the failed validator rules into one entry per field and rule
+func validationError(errs validator.ValidationErrors) *APIError {
+	fields := make([]responses.FieldError, len(errs))
+	for i, fieldErr := range errs {
+		fields[i] = responses.FieldError{Field: fieldErr.Field(), Rule: fieldErr.Tag(), Param: fieldErr.Param(), Message: ruleMessage(fieldErr)}
+	}
+
+	return &APIError{Kind: KindValidation, Detail: "the student does not follow the rules of the model", Fields: fields}
+}
+
+func ruleMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "past":
+		return "must be a date in the past, no earlier than 1900-01-01"
+	}
+
+	if fieldErr.Param() != "" {
+		return fmt.Sprintf("must satisfy %s=%s", fieldErr.Tag(), fieldErr.Param())
+	}
+	return fmt.Sprintf("must satisfy %s", fieldErr.Tag())
+}
+
+// function to translate a request rejected by the api documentation, a malformed path parameter is an invalid identifier
+// and the schema violations are reported field by field like the failed rules of the model
+func contractError(err *openapi.RequestError) *APIError {
+	kind := KindValidation
+	switch {
+	case err.In == "path":
+		kind = KindInvalidID
+	case len(err.Violations) == 0:
+		kind = KindBadRequest
+	}
+
+	fields := make([]responses.FieldError, len(err.Violations))
+	for i, violation := range err.Violations {
+		fields[i] = responses.FieldError{Field: violation.Field, Rule: violation.Keyword, Param: violation.Param, Message: violation.Message}
+	}
+
+	return &APIError{Kind: kind, Detail: err.Detail, Fields: fields, Err: err}
+}
+
+// Classify finds out the kind of an error, the errors of the repository and of the libraries are translated here
+// it is shared with the other ways of reaching the students (GraphQL) so that they report the errors the same way
+func Classify(err error) *APIError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return validationError(validationErrs)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var requestErr *openapi.RequestError
+	if errors.As(err, &requestErr) {
+		return contractError(requestErr)
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return &APIError{Kind: KindNotFound, Detail: "User with specified ID not found!", Err: err}
+	case errors.Is(err, repository.ErrAuditEntryNotFound):
+		return &APIError{Kind: KindNotFound, Detail: "The user with specified ID has no such version!", Err: err}
+	case errors.Is(err, repository.ErrVersionConflict):
+		return &APIError{Kind: KindPreconditionFailed, Detail: "User was modified since it was fetched, fetch it again and retry", Err: err}
+	case errors.Is(err, repository.ErrDuplicate):
+		return &APIError{Kind: KindConflict, Detail: err.Error(), Err: err}
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return &APIError{Kind: KindBadRequest, Detail: err.Error(), Err: err}
+	case errors.Is(err, errUnsupportedPatch), errors.Is(err, openapi.ErrUnsupportedMediaType):
+		return &APIError{Kind: KindUnsupportedMediaType, Detail: err.Error(), Err: err}
+	}
+
+	return &APIError{Kind: KindInternal, Detail: "An unexpected error occurred, try again later", Err: err}
+}
+
+// ErrorHandler is the error handler of the fiber app, it renders every error as application/problem+json
+// the errors of fiber itself (unknown route, wrong method, ...) keep their status and get the "about:blank" type
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	problem := responses.Problem{Instance: c.Path()}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		problem.Type, problem.Status, problem.Title = "about:blank", fiberErr.Code, http.StatusText(fiberErr.Code)
+		problem.Detail = fiberErr.Message
+	} else {
+		apiErr := Classify(err)
+		kind := errorKinds[apiErr.Kind]
+
+		problem.Type, problem.Status, problem.Title = ProblemTypePrefix+string(apiErr.Kind), kind.status, kind.title
+		problem.Detail, problem.Errors = apiErr.Detail, apiErr.Fields
+
+		// pointing the client at the position of the mistake in the filter expression
+		var filterErr *filters.Error
+		if errors.As(err, &filterErr) {
+			problem.Detail, problem.Filter, problem.Position = filterErr.Message, c.Query("filter"), filterErr.Position
+		}
+
+		// the cause of an internal error stays in the logs, it may carry details of the database
+		if apiErr.Kind == KindInternal {
+			slog.ErrorContext(c.UserContext(), "internal error", "method", c.Method(), "path", c.Path(), "error", err)
+		}
+	}
+
+	if err := c.Status(problem.Status).JSON(problem); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, responses.ProblemContentType)
+	return nil
+}
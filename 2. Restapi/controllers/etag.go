@@ -0,0 +1,117 @@
+// File responsible for the ETag based conditional requests on a single student
+
+package controllers
+
+import (
+	"context"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// function to build the ETag of a student out of its version
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// function to read an If-Match / If-None-Match header
+// it returns the listed ETags, or any=true when the header is "*"
+func parseETags(header string) (tags []string, any bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, false
+}
+
+// function to tell whether the client already has the given version, following If-None-Match
+// the comparison is weak, so W/"3" matches the version 3
+func notModified(c *fiber.Ctx, version int64) bool {
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+
+	tags, any := parseETags(header)
+	if any {
+		return true
+	}
+
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == etag(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// function to turn the If-Match header into the version a write must be conditioned on
+// without the header the write is unconditional, ok=false means no version can ever match and the
+// request has to be rejected with 412
+func expectedVersion(ctx context.Context, c *fiber.Ctx, students repository.StudentRepository, id primitive.ObjectID) (version int64, ok bool, err error) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return repository.AnyVersion, true, nil
+	}
+
+	tags, any := parseETags(header)
+
+	// the ETags are compared strongly, so weak ones never match
+	var versions []int64
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+
+		if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+
+	switch {
+	case !any && len(versions) == 0:
+		return 0, false, nil
+	case !any && len(versions) == 1:
+		return versions[0], true, nil
+	}
+
+	// "*" or several candidates, checking them against the stored student
+	// the write is then conditioned on the version which was seen here, so it is not read from a cache which may be stale
+	student, err := repository.Uncached(students).Get(ctx, id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if any || containsVersion(versions, student.Version) {
+		return student.Version, true, nil
+	}
+
+	return 0, false, nil
+}
+
+func containsVersion(versions []int64, version int64) bool {
+	for _, candidate := range versions {
+		if candidate == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// function to send the ETag of a student along with a response
+func setETag(c *fiber.Ctx, student models.Student) {
+	c.Set(fiber.HeaderETag, etag(student.Version))
+}
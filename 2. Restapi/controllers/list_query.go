@@ -0,0 +1,103 @@
+// File responsible for reading the pagination, sorting and filtering query params of the list endpoint
+
+package controllers
+
+import (
+	"fmt"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// query params which are not filters
+var reservedListParams = map[string]bool{"limit": true, "cursor": true, "sort": true, "filter": true}
+
+// function to build a list query out of the request query params, e.g.
+// ?limit=10&cursor=<token>&sort=percentage,-name&percentage_gte=80&address=Paris
+// ?filter=percentage > 80 and (address = "Paris" or name ~ "Ad*")
+func parseListQuery(c *fiber.Ctx) (repository.ListQuery, error) {
+	query := repository.ListQuery{Cursor: c.Query("cursor")}
+
+	// the filter expression is parsed and checked against the model before anything reaches the database
+	if filter := c.Query("filter"); filter != "" {
+		expr, err := filters.Compile(filter)
+		if err != nil {
+			return query, err
+		}
+		query.Filter = expr
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return query, err
+	}
+	query.Limit = limit
+
+	if sort := c.Query("sort"); sort != "" {
+		if query.Sort, err = repository.ParseSort(strings.Split(sort, ",")); err != nil {
+			return query, err
+		}
+	}
+
+	query.Conditions, err = parseConditions(c, reservedListParams)
+	return query, err
+}
+
+// function to read the filter params, every query param but the reserved ones is one
+func parseConditions(c *fiber.Ctx, reserved map[string]bool) (conditions []repository.Condition, err error) {
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if err != nil || reserved[string(key)] {
+			return
+		}
+
+		var condition repository.Condition
+		if condition, err = parseCondition(string(key), string(value)); err == nil {
+			conditions = append(conditions, condition)
+		}
+	})
+
+	return conditions, err
+}
+
+// function to read the size of a page, 0 means the default size
+func parseLimit(c *fiber.Ctx) (int, error) {
+	limit := c.Query("limit")
+	if limit == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(limit)
+	if err != nil || value < 1 || value > repository.MaxLimit {
+		return 0, fmt.Errorf("limit must be a number between 1 and %d", repository.MaxLimit)
+	}
+
+	return value, nil
+}
+
+// function to read a single filter param, either "<field>=<value>" or "<field>_<operator>=<value>"
+func parseCondition(key string, value string) (repository.Condition, error) {
+	name, op := key, repository.OpEq
+	for _, candidate := range repository.Operators {
+		if strings.HasSuffix(key, "_"+string(candidate)) {
+			name, op = strings.TrimSuffix(key, "_"+string(candidate)), candidate
+			break
+		}
+	}
+
+	field, ok := models.LookupField(name)
+	if !ok {
+		return repository.Condition{}, fmt.Errorf("unknown query parameter %q", key)
+	}
+
+	// converting the raw value to the type of the field
+	typed, err := field.ParseValue(value)
+	if err != nil {
+		return repository.Condition{}, err
+	}
+
+	return repository.Condition{Field: field, Op: op, Value: typed}, nil
+}
@@ -0,0 +1,62 @@
+// File responsible for reading the student identifier out of the route parameters
+
+package controllers
+
+import (
+	"fmt"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// name of the route parameter holding the student identifier
+const ParamStudentID = "userId"
+
+// key under which BindStudentID stores the parsed ID in the locals of the request
+const studentIDKey = "studentID"
+
+// BindStudentID is the middleware of the routes taking a student identifier
+// it reads the ID (or the roll number, written "roll:<roll number>") out of the route, rejects the malformed ones with 400
+// and stores the parsed ID for the handlers, which read it back with studentID
+// a roll number only designates a student which is not deleted
+func (sc *StudentController) BindStudentID(c *fiber.Ctx) error {
+	return sc.bindStudentID(c, false)
+}
+
+// BindDeletedStudentID is BindStudentID for the routes working on the trash, a roll number designates a deleted student
+func (sc *StudentController) BindDeletedStudentID(c *fiber.Ctx) error {
+	return sc.bindStudentID(c, true)
+}
+
+func (sc *StudentController) bindStudentID(c *fiber.Ctx, deleted bool) error {
+	param := c.Params(ParamStudentID)
+
+	identifier, ok := models.ParseStudentIdentifier(param)
+	if !ok {
+		return InvalidStudentIdentifier(param)
+	}
+
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	id, err := repository.ResolveStudentID(ctx, sc.students, identifier, deleted)
+	if err != nil {
+		return err
+	}
+
+	c.Locals(studentIDKey, id)
+	return c.Next()
+}
+
+// function to build the error of an identifier which is neither an ID nor a roll number, shared by every api
+func InvalidStudentIdentifier(raw string) *APIError {
+	return &APIError{Kind: KindInvalidID, Detail: fmt.Sprintf("%q is neither a valid ID (24 hexadecimal characters) nor an identifier such as roll:<roll number>", raw)}
+}
+
+// function to read the ID stored by BindStudentID
+func studentID(c *fiber.Ctx) primitive.ObjectID {
+	id, _ := c.Locals(studentIDKey).(primitive.ObjectID)
+	return id
+}
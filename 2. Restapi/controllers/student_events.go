@@ -0,0 +1,307 @@
+// File containing the handlers streaming the changes made to the students, over Server-Sent Events and a WebSocket
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"my-rest-api/filters"
+	"my-rest-api/logging"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/gofiber/websocket/v2"
+)
+
+// header of the id of the last event an EventSource got, it is sent back when it reconnects
+const HeaderLastEventID = "Last-Event-ID"
+
+// how long a stream stays silent before the client is pinged, which also finds out the clients which went away
+const heartbeatInterval = 15 * time.Second
+
+// how long an EventSource waits before reconnecting, in milliseconds
+const sseRetry = 3000
+
+// query params of the event streams which are not filters
+var reservedEventParams = map[string]bool{"filter": true, "actions": true, "lastEventId": true}
+
+// key of the local carrying the request of a WebSocket over the upgrade
+const localEventRequest = "eventRequest"
+
+// error ending the streams when the server shuts down
+var errShuttingDown = errors.New("the server is shutting down")
+
+// StudentEvents holds the dependencies of the event stream handlers
+// the events are the changes of the students described as audit entries, so a client resuming after the id of the last event it got misses nothing
+// the streams of the process share the change feed, which reads the changes once for all of them
+type StudentEvents struct {
+	feed *repository.ChangeFeed
+
+	// how long writing an event may take, the streams outlive the write timeout of the server
+	writeTimeout time.Duration
+
+	// the handler upgrading the connections, built once since it holds the settings of the upgrader
+	upgrade fiber.Handler
+
+	// closed when the server shuts down, the streams end then
+	stopping chan struct{}
+	once     sync.Once
+}
+
+// function to create the event handlers on top of the change feed of the students
+func NewStudentEvents(feed *repository.ChangeFeed, writeTimeout time.Duration) *StudentEvents {
+	e := &StudentEvents{feed: feed, writeTimeout: writeTimeout, stopping: make(chan struct{})}
+	e.upgrade = websocket.New(e.streamWebSocket)
+	return e
+}
+
+// function to end every open stream, the clients are expected to resume elsewhere
+func (e *StudentEvents) Shutdown() {
+	e.once.Do(func() { close(e.stopping) })
+}
+
+// what a client asked to be streamed
+// the ID of the request is kept for the logs of the stream, which goes on once the handler is over
+type eventRequest struct {
+	from      repository.FeedPosition
+	filter    repository.ChangeFilter
+	requestID string
+}
+
+// function to build the error of an event id which the feed did not give, shared by every api
+func InvalidEventID(raw string) *APIError {
+	return &APIError{Kind: KindInvalidID, Detail: fmt.Sprintf("%q is not a valid event id (24 hexadecimal characters, then the resume token after a dot)", raw)}
+}
+
+// function to read the event to resume after and the filters out of the request, e.g.
+// ?actions=create,delete&address=Paris&percentage_gte=80
+// ?filter=percentage > 80&lastEventId=<id>
+func parseEventRequest(c *fiber.Ctx) (eventRequest, error) {
+	request := eventRequest{requestID: logging.RequestID(c.UserContext())}
+
+	// an EventSource sends the header when it reconnects, the param is for the clients which cannot set headers
+	lastEventID := c.Get(HeaderLastEventID, c.Query("lastEventId"))
+	if lastEventID != "" {
+		from, ok := repository.ParseFeedPosition(lastEventID)
+		if !ok {
+			return request, InvalidEventID(lastEventID)
+		}
+		request.from = from
+	}
+
+	// what is kept from the query is copied, fiber reuses its memory once the handler is over but the stream goes on
+	if actions := utils.CopyString(c.Query("actions")); actions != "" {
+		for _, action := range strings.Split(actions, ",") {
+			if !slices.Contains(models.Actions, action) {
+				return request, badRequest(fmt.Sprintf("unknown action %q, expected one of %s", action, strings.Join(models.Actions, ", ")))
+			}
+			request.filter.Actions = append(request.filter.Actions, action)
+		}
+	}
+
+	if filter := utils.CopyString(c.Query("filter")); filter != "" {
+		expr, err := filters.Compile(filter)
+		if err != nil {
+			return request, &APIError{Kind: KindBadRequest, Detail: err.Error(), Err: err}
+		}
+		request.filter.Filter = expr
+	}
+
+	conditions, err := parseConditions(c, reservedEventParams)
+	if err != nil {
+		return request, badRequest(err.Error())
+	}
+	request.filter.Conditions = conditions
+
+	return request, nil
+}
+
+// function to create the context of a stream, it outlives the handler and ends with the stream
+// it carries the request ID for the logs but not the span of the request, which is over before the first event
+func streamContext(request eventRequest) (context.Context, context.CancelFunc) {
+	return context.WithCancel(logging.WithRequestID(context.Background(), request.requestID))
+}
+
+// function to follow the feed for a request, the matching changes are handed to emit
+// ping is called when nothing was emitted for a while, the first error of either ends the stream
+func (e *StudentEvents) follow(ctx context.Context, request eventRequest, emit func(repository.Change) error, ping func() error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the feed runs on its own so that the stream can be pinged, and stopped, while it waits for changes
+	events := make(chan repository.Change)
+	done := make(chan error, 1)
+	go func() {
+		done <- e.feed.Follow(ctx, request.from, func(change repository.Change) error {
+			if !request.filter.Match(change.Entry) {
+				return nil
+			}
+			select {
+			case events <- change:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case change := <-events:
+			err = emit(change)
+			heartbeat.Reset(heartbeatInterval)
+		case <-heartbeat.C:
+			err = ping()
+		case err := <-done:
+			// a client which cannot keep up resumes after the last event it got, like after a failure
+			switch {
+			case ctx.Err() != nil:
+			case errors.Is(err, repository.ErrFeedBehind):
+				slog.WarnContext(ctx, "the client fell behind the change feed, the event stream is closed")
+			default:
+				slog.ErrorContext(ctx, "the change feed failed, the event stream is closed", "error", err)
+			}
+			return err
+		case <-e.stopping:
+			return errShuttingDown
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// function to extend the deadline of the writes on a connection, 0 means no deadline
+func (e *StudentEvents) extendDeadline(conn interface{ SetWriteDeadline(time.Time) error }) {
+	var deadline time.Time
+	if e.writeTimeout > 0 {
+		deadline = time.Now().Add(e.writeTimeout)
+	}
+	conn.SetWriteDeadline(deadline)
+}
+
+// function responsible for streaming the changes as Server-Sent Events, one event per change named after its action
+// the id of an event is where the feed is right after it, and its data is the entry as returned by the history of a student
+// the stream ends when the client goes away or the server shuts down, an EventSource then reconnects by itself
+func (e *StudentEvents) StreamEvents(c *fiber.Ctx) error {
+	request, err := parseEventRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// the body is written once the handler is over, nothing of the fiber context can be used from there on
+	conn := c.Context().Conn()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := streamContext(request)
+		defer cancel()
+
+		write := func(format string, args ...interface{}) error {
+			e.extendDeadline(conn)
+			fmt.Fprintf(w, format, args...)
+			return w.Flush()
+		}
+
+		// the headers go out along with the first message, so the client knows right away that the stream is open
+		if err := write("retry: %d\n\n", sseRetry); err != nil {
+			return
+		}
+
+		e.follow(ctx, request, func(change repository.Change) error {
+			data, err := json.Marshal(change.Entry)
+			if err != nil {
+				return err
+			}
+			return write("id: %s\nevent: %s\ndata: %s\n\n", change.Position, change.Entry.Action, data)
+		}, func() error {
+			return write(": keep-alive\n\n")
+		})
+	})
+
+	return nil
+}
+
+// function to check the request of a WebSocket before upgrading the connection
+// the requests which are not upgrades are answered with 426 Upgrade Required
+func (e *StudentEvents) UpgradeEvents(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	request, err := parseEventRequest(c)
+	if err != nil {
+		return err
+	}
+
+	// the upgrade carries the locals over to the connection
+	c.Locals(localEventRequest, request)
+	return e.upgrade(c)
+}
+
+// WebSocketEvent is a message of the WebSocket, the change described like the entries of the history of a student
+// along with the id of the event
+type WebSocketEvent struct {
+	models.AuditEntry
+	EventID string `json:"eventId"`
+}
+
+// function responsible for streaming the changes over a WebSocket, one text message per change
+// the messages of the client are ignored, the connection is closed with 1001 when the server shuts down
+func (e *StudentEvents) streamWebSocket(conn *websocket.Conn) {
+	request := conn.Locals(localEventRequest).(eventRequest)
+	ctx, cancel := streamContext(request)
+	defer cancel()
+
+	// reading is how a close of the client is noticed
+	// the connection goes back to a pool once the handler is over, so the reader is done by then
+	reading := make(chan struct{})
+	go func() {
+		defer close(reading)
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		conn.Close()
+		<-reading
+	}()
+
+	err := e.follow(ctx, request, func(change repository.Change) error {
+		e.extendDeadline(conn)
+		return conn.WriteJSON(WebSocketEvent{AuditEntry: change.Entry, EventID: change.Position.String()})
+	}, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+	})
+
+	// the client which went away is not told anything, the others are told to resume after the last event they got
+	if ctx.Err() != nil {
+		return
+	}
+	code, text := websocket.CloseInternalServerErr, "the change feed failed, reconnect with lastEventId"
+	if errors.Is(err, errShuttingDown) {
+		code, text = websocket.CloseGoingAway, "the server is shutting down, reconnect with lastEventId"
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
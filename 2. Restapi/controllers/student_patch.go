@@ -0,0 +1,79 @@
+// File responsible for applying the patch documents accepted by the PATCH endpoint
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"my-rest-api/models"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	// RFC 7396, a partial document which is merged into the student
+	MergePatchContentType = "application/merge-patch+json"
+
+	// RFC 6902, a list of operations applied to the student
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// error returned when the request is not sent with one of the patch content types
+var errUnsupportedPatch = fmt.Errorf("the body must be sent as %s or %s", MergePatchContentType, JSONPatchContentType)
+
+// function to apply the patch in the body to a student and to read the result back into the model
+// the fields which are managed by the server cannot be changed through a patch
+func applyPatch(contentType string, body []byte, student models.Student) (models.Student, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	original, err := json.Marshal(student)
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	var patched []byte
+	switch mediaType {
+	case MergePatchContentType:
+		patched, err = jsonpatch.MergePatch(original, body)
+
+	case JSONPatchContentType:
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(body); err == nil {
+			patched, err = patch.Apply(original)
+		}
+
+	default:
+		return models.Student{}, errUnsupportedPatch
+	}
+
+	if err != nil {
+		return models.Student{}, fmt.Errorf("the patch cannot be applied: %w", err)
+	}
+
+	// reading the patched document strictly, an unknown or mistyped field is a mistake of the client
+	var result models.Student
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		return models.Student{}, fmt.Errorf("the patched student is invalid: %w", err)
+	}
+
+	if result.ID != student.ID {
+		return models.Student{}, errors.New("the _id of a student cannot be changed")
+	}
+
+	if result.DeletedAt != nil {
+		return models.Student{}, errors.New("a student cannot be deleted through a patch")
+	}
+
+	for _, field := range models.StudentFields {
+		if !field.Editable && !field.Equal(result, student) {
+			return models.Student{}, fmt.Errorf("the %s of a student cannot be changed", field.Name)
+		}
+	}
+
+	return result, nil
+}
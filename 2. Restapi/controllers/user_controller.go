@@ -4,97 +4,155 @@ package controllers
 
 import (
 	"context"
-	"my-rest-api/configs"
+	"errors"
+	"fmt"
+	"log/slog"
 	"my-rest-api/models"
+	"my-rest-api/repository"
 	"my-rest-api/responses"
+	"my-rest-api/tracing"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
-// variable to the collection
-var studentCollection *mongo.Collection = configs.GetCollection(configs.DB, "students")
-
 // special validator variable
-var validate = validator.New()
+// it knows how to check the typed dates of the student model
+var validate = models.NewValidator()
+
+// header naming the user who makes the request, there is no authentication so it is taken as it is
+const HeaderUser = "X-User"
+
+// how many times a patch without If-Match is applied again when the user changes concurrently
+const maxPatchAttempts = 3
 
 // We are going to validate the request body and check whether the fields/attributes are properly set are not to avoid inconsistency
 // We are going test for this in CreateUser and EditUser handlers where we receive json in request body
 
+// StudentController holds the dependencies of the student handlers
+// The handlers only talk to the repository, so any storage can be plugged in
+type StudentController struct {
+	students repository.StudentRepository
+	audit    repository.AuditRepository
+
+	// how long deleted users stay in the trash before PurgeTrash removes them
+	trashRetention time.Duration
+
+	// how long the queries made while handling one request may take
+	requestTimeout time.Duration
+}
+
+// function to create a controller on top of a student repository
+// the changes made through the students repository are expected to be recorded in the audit repository
+func NewStudentController(students repository.StudentRepository, audit repository.AuditRepository, trashRetention time.Duration, requestTimeout time.Duration) *StudentController {
+	return &StudentController{students: students, audit: audit, trashRetention: trashRetention, requestTimeout: requestTimeout}
+}
+
+// RequestContext creates the context of the queries made while handling a request, limited to the given time (0 means no limit)
+// it carries the user making the request, which is recorded in the audit log along with the changes,
+// and the span of the request, which the queries are traced under
+// (the header is copied since fiber reuses its memory once the request is over)
+func RequestContext(c *fiber.Ctx, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := repository.WithActor(c.UserContext(), utils.CopyString(c.Get(HeaderUser)))
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (sc *StudentController) requestContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	return RequestContext(c, sc.requestTimeout)
+}
+
+// function to check a student against the rules of the model, the time it takes is traced in a span of its own
+func validateStudent(ctx context.Context, student *models.Student) error {
+	_, span := tracing.Start(ctx, "validate student")
+	err := validate.Struct(student)
+	tracing.End(span, err)
+	return err
+}
+
 func GetHome(c *fiber.Ctx) error {
 	c.Send([]byte("Welcome to Student Records API!"))
 	return nil
 }
 
 // function responsible for creating a new user in the database
-func CreateStudent(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (sc *StudentController) CreateStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
 
 	var student models.Student
 	defer cancel()
 
 	//validate the request body
 	if err := c.BodyParser(&student); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(responses.StudentResponse{Status: http.StatusBadRequest, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return bodyError(err)
 	}
 
 	//use the validator library to validate required fields
-	if validationErr := validate.Struct(&student); validationErr != nil {
-		return c.Status(http.StatusBadRequest).JSON(responses.StudentResponse{Status: http.StatusBadRequest, Message: "error", Data: &fiber.Map{"data": validationErr.Error()}})
+	if validationErr := validateStudent(ctx, &student); validationErr != nil {
+		return validationErr
 	}
 
 	// filling details in the user model
-	// the createdAt attribute is set only at the time of user creation
-	// it is not manipulated elsewhere (Updating)
+	// the createdAt and updatedAt attributes are set by the repository at the time of user creation
 	newStudent := models.Student{
+		RollNumber:  student.RollNumber,
 		Name:        student.Name,
 		DOB:         student.DOB,
 		Percentage:  student.Percentage,
 		Address:     student.Address,
 		Description: student.Description,
-		CreatedAt:   time.Now().String(),
 	}
 
 	// query to insert a user
-	result, err := studentCollection.InsertOne(ctx, newStudent)
+	created, err := sc.students.Create(ctx, newStudent)
 
-	// checking whether an error occured while updating
-	// sending an error response to the user if error exists
+	// checking whether an error occured while inserting
+	// the error handler sends the error response to the user
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return err
 	}
 
 	// sending correct response upon success
-	return c.Status(http.StatusCreated).JSON(responses.StudentResponse{Status: http.StatusCreated, Message: "success", Data: &fiber.Map{"data": result}})
+	setETag(c, created)
+	return c.Status(http.StatusCreated).JSON(responses.StudentResponse{Status: http.StatusCreated, Message: "success", Data: &fiber.Map{"data": fiber.Map{"InsertedID": created.ID}}})
 }
 
 // function responsible for retrieving a user from the database based on UserID
-func GetAStudent(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-
-	// extracting userId from params
-	userId := c.Params("userId")
-
-	// student model to store fetched data
-	var student models.Student
-
+func (sc *StudentController) GetAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
 	defer cancel()
 
-	// converting userId from string to ObjectID
-	objId, _ := primitive.ObjectIDFromHex(userId)
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
 
 	// query to fetch an existing users from collection
-	err := studentCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&student)
+	student, err := sc.students.Get(ctx, objId)
 
 	// checking whether an error occured while fetching
-	// sending an error response to the user if error exists
+	// the error handler sends the error response to the user (404 when no user matched)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return err
+	}
+
+	// the client already has this version of the user, there is no need to send it again
+	// a cached user may be older than the stored one, the client is only told it is up to date by the stored user
+	if notModified(c, student.Version) {
+		student, err = repository.Uncached(sc.students).Get(ctx, objId)
+		if err != nil {
+			return err
+		}
+	}
+
+	setETag(c, student)
+	if notModified(c, student.Version) {
+		// a 304 has no body
+		return c.Status(http.StatusNotModified).Send(nil)
 	}
 
 	// sending correct response upon success
@@ -102,134 +160,337 @@ func GetAStudent(c *fiber.Ctx) error {
 }
 
 // function responsible for editing a user from the database based on UserID
-func EditAStudent(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-
-	// extracting userId from params
-	userId := c.Params("userId")
+func (sc *StudentController) EditAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
 
 	// student model to store fetched data
 	var student models.Student
 	defer cancel()
 
-	// converting userId from string to ObjectID
-	objId, _ := primitive.ObjectIDFromHex(userId)
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
 
 	//validate the request body
 	if err := c.BodyParser(&student); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(responses.StudentResponse{Status: http.StatusBadRequest, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return bodyError(err)
 	}
 
 	//use the validator library to validate required fields
-	if validationErr := validate.Struct(&student); validationErr != nil {
-		return c.Status(http.StatusBadRequest).JSON(responses.StudentResponse{Status: http.StatusBadRequest, Message: "error", Data: &fiber.Map{"data": validationErr.Error()}})
+	if validationErr := validateStudent(ctx, &student); validationErr != nil {
+		return validationErr
 	}
 
-	// variable which stores the new user attributes after fetching to be updated
-	update := bson.M{"name": student.Name, "dob": student.DOB, "percentage": student.Percentage, "address": student.Address, "description": student.Description}
+	// reading the version the client expects the user to be at from If-Match
+	version, ok, err := expectedVersion(ctx, c, sc.students, objId)
+	if err == nil && !ok {
+		err = repository.ErrVersionConflict
+	}
 
 	// query to update a user based on the "_id" value passed
-	result, err := studentCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
+	// the repository hands back the user as it looks after the update
+	var updatedStudent models.Student
+	if err == nil {
+		updatedStudent, err = sc.students.Update(ctx, objId, student, version)
+	}
 
 	// checking whether an error occured while updating
-	// sending an error response to the user if error exists
+	// no user matched -> 404, the user changed since the client fetched it -> 412
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return err
 	}
 
-	// if updated user count is 0 -> No user updated -> Invalid userId
-	// sending error response to the user
-	if result.MatchedCount == 0 {
-		return c.Status(http.StatusNotFound).JSON(
-			responses.StudentResponse{Status: http.StatusNotFound, Message: "error", Data: &fiber.Map{"data": "User with specified ID not found!"}},
-		)
+	// sending correct response upon success
+	setETag(c, updatedStudent)
+	return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": updatedStudent}})
+}
+
+// function responsible for partially updating a user based on UserID
+// the body is either a JSON Merge Patch or a JSON Patch, see applyPatch
+func (sc *StudentController) PatchAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
+
+	// reading the version the client expects the user to be at from If-Match
+	version, ok, err := expectedVersion(ctx, c, sc.students, objId)
+	if err != nil {
+		return err
 	}
 
-	//get updated user details
-	var updatedStudent models.Student
+	// the patch is applied on top of the user as it is now, and only written if nobody changed the user meanwhile
+	// without If-Match a concurrent change is not the client's business, so the patch is simply applied again
+	for attempt := 1; ; attempt++ {
+		// fetching the user as it is now
+		student, err := sc.students.Get(ctx, objId)
+		if err != nil {
+			return err
+		}
 
-	// After updating the user, fetching back the same user and returning it to the user as a response
-	// this code is similar to the fetching a single user code
-	if result.MatchedCount == 1 {
-		err := studentCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedStudent)
+		// the user changed since the client fetched it
+		if !ok || (version != repository.AnyVersion && version != student.Version) {
+			return repository.ErrVersionConflict
+		}
+
+		// applying the patch from the request body
+		patched, err := applyPatch(c.Get(fiber.HeaderContentType), c.Body(), student)
+		if errors.Is(err, errUnsupportedPatch) {
+			return err
+		}
 
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+			return &APIError{Kind: KindBadRequest, Detail: err.Error(), Err: err}
 		}
-	}
 
-	// sending correct response upon success
-	return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": updatedStudent}})
+		// the merged user has to be as valid as one sent to CreateStudent or EditAStudent
+		if validationErr := validateStudent(ctx, &patched); validationErr != nil {
+			return validationErr
+		}
+
+		// query to update only the fields which were changed by the patch
+		updatedStudent, err := sc.students.Patch(ctx, objId, patched, models.ChangedFields(student, patched), student.Version)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			if version == repository.AnyVersion && attempt < maxPatchAttempts {
+				continue
+			}
+
+			// the user keeps changing under our feet
+			if version == repository.AnyVersion {
+				return conflict("User is being modified concurrently, retry later")
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// sending correct response upon success
+		setETag(c, updatedStudent)
+		return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": updatedStudent}})
+	}
 }
 
 // function responsible for deleting a user from the database based on UserID
-func DeleteAStudent(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-
-	// extracting userId from params
-	userId := c.Params("userId")
+func (sc *StudentController) DeleteAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
 	defer cancel()
 
-	// converting userId from string to ObjectID
-	objId, _ := primitive.ObjectIDFromHex(userId)
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
+
+	// reading the version the client expects the user to be at from If-Match
+	version, ok, err := expectedVersion(ctx, c, sc.students, objId)
+	if err == nil && !ok {
+		err = repository.ErrVersionConflict
+	}
 
 	// query to delete o user based on the "_id" value passed
-	result, err := studentCollection.DeleteOne(ctx, bson.M{"_id": objId})
+	if err == nil {
+		_, err = sc.students.Delete(ctx, objId, version)
+	}
 
 	// checking whether an error occured while deleting
-	// sending an error response to the user if error exists
+	// no user was deleted -> 404, the user changed since the client fetched it -> 412
+	if err != nil {
+		return err
+	}
+
+	// sending correct response upon success
+	return c.Status(http.StatusOK).JSON(
+		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": "User successfully deleted!"}},
+	)
+}
+
+// function responsible for taking a user out of the trash based on UserID
+func (sc *StudentController) RestoreAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
+
+	// query to restore a deleted user
+	restored, err := sc.students.Restore(ctx, objId)
+
+	// the user is not in the trash (never existed, not deleted or already purged)
+	if errors.Is(err, repository.ErrNotFound) {
+		return notFound("Deleted user with specified ID not found!")
+	}
+
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return err
 	}
 
-	// if deleted users are less than 1 -> No user deleted -> Invalid userId
-	// sending error response to the user
-	if result.DeletedCount < 1 {
-		return c.Status(http.StatusNotFound).JSON(
-			responses.StudentResponse{Status: http.StatusNotFound, Message: "error", Data: &fiber.Map{"data": "User with specified ID not found!"}},
-		)
+	// sending correct response upon success
+	setETag(c, restored)
+	return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": restored}})
+}
+
+// function responsible for permanently removing the users which are in the trash for longer than the retention period
+func (sc *StudentController) PurgeTrash(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	// query to remove the users deleted before the retention period
+	purged, err := sc.students.Purge(ctx, time.Now().Add(-sc.trashRetention))
+	if err != nil {
+		return err
 	}
 
+	// removing students for good is worth a trace in the logs
+	slog.InfoContext(ctx, "purged the trash", "purged", purged, "retention", sc.trashRetention.String())
+
 	// sending correct response upon success
 	return c.Status(http.StatusOK).JSON(
-		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": "User successfully deleted!"}},
+		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": fiber.Map{"purged": purged, "retention": sc.trashRetention.String()}}},
 	)
 }
 
-// function responsible for retrieving all the user from the database
-func GetAllStudents(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// function responsible for retrieving a page of users from the database
+// the users can be filtered and sorted, see parseListQuery for the supported query params
+func (sc *StudentController) GetAllStudents(c *fiber.Ctx) error {
+	return sc.listStudents(c, sc.students.List)
+}
+
+// function responsible for retrieving a page of the deleted users, it accepts the same query params as GetAllStudents
+func (sc *StudentController) GetTrash(c *fiber.Ctx) error {
+	return sc.listStudents(c, sc.students.ListTrash)
+}
 
-	// slice to store all the retrieved students
-	var students []bson.M
+func (sc *StudentController) listStudents(c *fiber.Ctx, list func(context.Context, repository.ListQuery) (repository.Page, error)) error {
+	ctx, cancel := sc.requestContext(c)
 	defer cancel()
 
-	// query to fetch all existing users from collection
-	results, err := studentCollection.Find(ctx, bson.M{})
+	// reading pagination, sorting and filters from the query params
+	// a mistake in a filter expression is reported with its position by the error handler
+	query, err := parseListQuery(c)
+	if err != nil {
+		return &APIError{Kind: KindBadRequest, Detail: err.Error(), Err: err}
+	}
 
-	// checking whether an error occured while fetching
-	// sending an error response to the user if error exists
+	// query to fetch one page of users from the repository
+	// a cursor which cannot be read is a mistake of the client -> 400
+	page, err := list(ctx, query)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
+		return err
 	}
 
-	defer results.Close(ctx)
+	pagination := responses.Pagination{Limit: query.Limit, Count: len(page.Students), NextCursor: page.NextCursor}
+	if pagination.Limit == 0 {
+		pagination.Limit = repository.DefaultLimit
+	}
 
-	// reading from the db in an optimal way
-	// fetching an individual user using a curson and appending it to the users slice
-	for results.Next(ctx) {
-		var singleStudent bson.M
+	// sending correct response upon success
+	return c.Status(http.StatusOK).JSON(
+		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": page.Students, "pagination": pagination}},
+	)
+}
 
-		// sending back error response if error exists
-		if err = results.Decode(&singleStudent); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.StudentResponse{Status: http.StatusInternalServerError, Message: "error", Data: &fiber.Map{"data": err.Error()}})
-		}
+// function responsible for searching users by the words of their name, address and description
+// the most relevant users come first and the results are paged the same way as GetAllStudents
+func (sc *StudentController) SearchStudents(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	// the searched text is mandatory
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		return badRequest("the q query param is required")
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return badRequest(err.Error())
+	}
 
-		students = append(students, singleStudent)
+	// query to search the users through the full-text index
+	// a cursor which cannot be read is a mistake of the client -> 400
+	page, err := sc.students.Search(ctx, repository.SearchQuery{Text: text, Limit: limit, Cursor: c.Query("cursor")})
+	if err != nil {
+		return err
+	}
+
+	pagination := responses.Pagination{Limit: limit, Count: len(page.Hits), NextCursor: page.NextCursor}
+	if pagination.Limit == 0 {
+		pagination.Limit = repository.DefaultLimit
 	}
 
 	// sending correct response upon success
 	return c.Status(http.StatusOK).JSON(
-		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": students}},
+		responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": page.Hits, "pagination": pagination}},
 	)
 }
+
+// function responsible for listing the changes made to a user based on UserID, the latest first
+func (sc *StudentController) GetStudentHistory(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+	defer cancel()
+
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
+
+	// query to fetch the audit entries of the user
+	entries, err := sc.audit.History(ctx, objId)
+	if err != nil {
+		return err
+	}
+
+	// an unknown user has no history at all, while a user written before the audit log existed has an empty one
+	if len(entries) == 0 {
+		if _, err := sc.students.Get(ctx, objId); err != nil {
+			return err
+		}
+	}
+
+	// sending correct response upon success
+	return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": entries}})
+}
+
+// function responsible for rolling a user back to the state it had at a given version
+// the rollback is itself a change, so it gets a new version and its own audit entry
+func (sc *StudentController) RevertAStudent(c *fiber.Ctx) error {
+	ctx, cancel := sc.requestContext(c)
+
+	defer cancel()
+
+	// the ID parsed by BindStudentID
+	objId := studentID(c)
+
+	// extracting the version from params
+	target, err := strconv.ParseInt(c.Params("version"), 10, 64)
+	if err != nil || target < 1 {
+		return badRequest("the version must be a positive number")
+	}
+
+	// query to fetch the state the user had at that version
+	entry, err := sc.audit.Get(ctx, objId, target)
+	if err != nil {
+		return err
+	}
+
+	// the state a deletion left is in the trash, writing it back would bring the user back to life without its deletion
+	if entry.Snapshot.DeletedAt != nil {
+		return badRequest(fmt.Sprintf("version %d moved the user to the trash, it cannot be reverted to", target))
+	}
+
+	// reading the version the client expects the user to be at from If-Match
+	version, ok, err := expectedVersion(ctx, c, sc.students, objId)
+	if err == nil && !ok {
+		err = repository.ErrVersionConflict
+	}
+
+	// query to write the old attributes back
+	var reverted models.Student
+	if err == nil {
+		reverted, err = sc.students.Update(repository.WithAuditAction(ctx, models.ActionRevert), objId, entry.Snapshot, version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// sending correct response upon success
+	setETag(c, reverted)
+	return c.Status(http.StatusOK).JSON(responses.StudentResponse{Status: http.StatusOK, Message: "success", Data: &fiber.Map{"data": reverted}})
+}
@@ -0,0 +1,65 @@
+// File containing the syntax tree of a filter expression
+
+package filters
+
+import (
+	"fmt"
+	"my-rest-api/models"
+	"regexp"
+)
+
+// Expr is a node of a parsed filter expression
+type Expr interface {
+	// Pos is the 1-based position of the node in the expression
+	Pos() int
+}
+
+// Logical joins two expressions with "and" / "or"
+type Logical struct {
+	Op          string
+	Left, Right Expr
+	pos         int
+}
+
+// Not negates an expression
+type Not struct {
+	Expr Expr
+	pos  int
+}
+
+// Comparison compares a field of the student with a literal value, e.g. percentage > 80
+// Field, Value and pattern are only filled in once the expression has been checked
+type Comparison struct {
+	FieldName string
+	Op        string
+	Literal   string
+	IsString  bool
+
+	Field models.Field
+	Value interface{}
+
+	pos      int
+	opPos    int
+	valuePos int
+	regex    string
+	pattern  *regexp.Regexp
+}
+
+func (e *Logical) Pos() int    { return e.pos }
+func (e *Not) Pos() int        { return e.pos }
+func (e *Comparison) Pos() int { return e.pos }
+
+// Error is returned for every mistake in an expression
+// Position is 1-based and points at the character where the problem was found
+type Error struct {
+	Position int    `json:"position"`
+	Message  string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid filter at position %d: %s", e.Position, e.Message)
+}
+
+func errorAt(pos int, format string, args ...interface{}) *Error {
+	return &Error{Position: pos, Message: fmt.Sprintf(format, args...)}
+}
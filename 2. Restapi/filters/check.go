@@ -0,0 +1,133 @@
+// File responsible for checking a parsed filter against the fields of the student model
+
+package filters
+
+import (
+	"my-rest-api/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// limits of the patterns of the "~" operator, a pattern is run by mongo against every student it scans
+// and the cost of a regex grows with its wildcards
+const (
+	MaxPatternLength    = 100
+	MaxPatternWildcards = 10
+)
+
+// function to check that every comparison uses a known field, a value of the right type and an operator
+// which makes sense for it, the comparisons are filled with the typed value on the way
+func Check(expr Expr) error {
+	switch e := expr.(type) {
+	case *Logical:
+		if err := Check(e.Left); err != nil {
+			return err
+		}
+		return Check(e.Right)
+
+	case *Not:
+		return Check(e.Expr)
+
+	case *Comparison:
+		return checkComparison(e)
+	}
+
+	return nil
+}
+
+func checkComparison(e *Comparison) error {
+	field, ok := models.LookupField(e.FieldName)
+	if !ok {
+		return errorAt(e.pos, "unknown field %q, expected one of %s", e.FieldName, fieldNames())
+	}
+	e.Field = field
+
+	switch field.Kind {
+	case models.NumberField:
+		if e.IsString {
+			return errorAt(e.valuePos, "%s is a number, the value must not be quoted", field.Name)
+		}
+
+		if e.Op == "~" {
+			return errorAt(e.opPos, "the \"~\" operator only works on text fields, %s is a number", field.Name)
+		}
+
+		number, err := strconv.ParseFloat(e.Literal, 64)
+		if err != nil {
+			return errorAt(e.valuePos, "%q is not a valid number", e.Literal)
+		}
+		e.Value = field.RoundNumber(number)
+
+	case models.TimeField:
+		if !e.IsString {
+			return errorAt(e.valuePos, "%s is a date, the value must be a quoted date such as \"2006-01-02\"", field.Name)
+		}
+
+		if e.Op == "~" {
+			return errorAt(e.opPos, "the \"~\" operator only works on text fields, %s is a date", field.Name)
+		}
+
+		value, err := field.ParseValue(e.Literal)
+		if err != nil {
+			return errorAt(e.valuePos, "%q is not a valid date", e.Literal)
+		}
+		e.Value = value
+
+	case models.StringField:
+		if !e.IsString {
+			return errorAt(e.valuePos, "%s is a text field, the value must be a quoted string", field.Name)
+		}
+		e.Value = e.Literal
+
+		if e.Op == "~" {
+			if length := len([]rune(e.Literal)); length > MaxPatternLength {
+				return errorAt(e.valuePos, "the pattern is %d characters long, at most %d are allowed", length, MaxPatternLength)
+			}
+			if wildcards := strings.Count(e.Literal, "*") + strings.Count(e.Literal, "?"); wildcards > MaxPatternWildcards {
+				return errorAt(e.valuePos, "the pattern has %d wildcards, at most %d are allowed", wildcards, MaxPatternWildcards)
+			}
+
+			e.regex = globToRegex(e.Literal)
+			e.pattern = regexp.MustCompile("(?i)" + e.regex)
+		}
+	}
+
+	return nil
+}
+
+// function to translate a wildcard pattern into a regular expression anchored at the start of the text
+// "*" matches any text and "?" a single character, everything else is matched literally
+// a run of "*" is a single ".*", and a pattern ending with "*" is only a prefix, which spares the regex a backtracking
+func globToRegex(glob string) string {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	trimmed := strings.TrimRight(glob, "*")
+	for i, r := range trimmed {
+		switch r {
+		case '*':
+			if i > 0 && trimmed[i-1] == '*' {
+				continue
+			}
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if len(trimmed) == len(glob) {
+		pattern.WriteString("$")
+	}
+	return pattern.String()
+}
+
+func fieldNames() string {
+	names := make([]string, len(models.StudentFields))
+	for i, field := range models.StudentFields {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
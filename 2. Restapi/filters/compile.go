@@ -0,0 +1,79 @@
+// File responsible for turning a checked filter into a mongo query, or evaluating it directly on a student
+
+package filters
+
+import (
+	"my-rest-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the mongo operator behind every comparison operator of the language
+var mongoOperators = map[string]string{
+	"=":  "$eq",
+	"!=": "$ne",
+	">":  "$gt",
+	">=": "$gte",
+	"<":  "$lt",
+	"<=": "$lte",
+}
+
+// function to translate a checked expression into a mongo filter
+// field names only come from the model and values are always placed as operands,
+// so nothing the client writes can end up as a mongo operator
+func ToBSON(expr Expr) bson.M {
+	switch e := expr.(type) {
+	case *Logical:
+		return bson.M{"$" + e.Op: bson.A{ToBSON(e.Left), ToBSON(e.Right)}}
+
+	case *Not:
+		return bson.M{"$nor": bson.A{ToBSON(e.Expr)}}
+
+	case *Comparison:
+		if e.Op == "~" {
+			return bson.M{e.Field.Key: primitive.Regex{Pattern: e.regex, Options: "i"}}
+		}
+		return bson.M{e.Field.Key: bson.M{mongoOperators[e.Op]: e.Value}}
+	}
+
+	return bson.M{}
+}
+
+// function to evaluate a checked expression against a student, with the same meaning as ToBSON
+func Match(expr Expr, student models.Student) bool {
+	switch e := expr.(type) {
+	case *Logical:
+		if e.Op == "and" {
+			return Match(e.Left, student) && Match(e.Right, student)
+		}
+		return Match(e.Left, student) || Match(e.Right, student)
+
+	case *Not:
+		return !Match(e.Expr, student)
+
+	case *Comparison:
+		value := e.Field.Value(student)
+		if e.Op == "~" {
+			return e.pattern.MatchString(value.(string))
+		}
+
+		result := models.CompareValues(value, e.Value)
+		switch e.Op {
+		case "=":
+			return result == 0
+		case "!=":
+			return result != 0
+		case ">":
+			return result > 0
+		case ">=":
+			return result >= 0
+		case "<":
+			return result < 0
+		case "<=":
+			return result <= 0
+		}
+	}
+
+	return false
+}
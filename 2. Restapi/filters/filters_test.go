@@ -0,0 +1,143 @@
+package filters
+
+import (
+	"my-rest-api/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Every expression is compiled to a mongo filter and evaluated against the same student,
+// so that both ways of running a filter are checked to agree
+
+func TestCompile(t *testing.T) {
+	student := models.Student{Name: "Adam", DOB: models.NewDate(2002, time.December, 1), Percentage: 85, Address: "Paris", Description: "Go Developer"}
+
+	tests := []struct {
+		description string
+		filter      string
+		expected    bson.M
+		matches     bool
+	}{
+		{
+			description: "a single comparison on a number",
+			filter:      "percentage > 80",
+			expected:    bson.M{"percentage": bson.M{"$gt": 80.0}},
+			matches:     true,
+		},
+		{
+			description: "and binds tighter than or",
+			filter:      `address = "London" or percentage >= 90 and name = "Adam"`,
+			expected: bson.M{"$or": bson.A{
+				bson.M{"address": bson.M{"$eq": "London"}},
+				bson.M{"$and": bson.A{bson.M{"percentage": bson.M{"$gte": 90.0}}, bson.M{"name": bson.M{"$eq": "Adam"}}}},
+			}},
+			matches: false,
+		},
+		{
+			description: "parentheses and wildcards",
+			filter:      `percentage > 80 and (address = "Paris" or name ~ "ad*")`,
+			expected: bson.M{"$and": bson.A{
+				bson.M{"percentage": bson.M{"$gt": 80.0}},
+				bson.M{"$or": bson.A{
+					bson.M{"address": bson.M{"$eq": "Paris"}},
+					bson.M{"name": primitive.Regex{Pattern: "^ad", Options: "i"}},
+				}},
+			}},
+			matches: true,
+		},
+		{
+			description: "not and escaped quotes",
+			filter:      `NOT description = "say \"hi\""`,
+			expected:    bson.M{"$nor": bson.A{bson.M{"description": bson.M{"$eq": `say "hi"`}}}},
+			matches:     true,
+		},
+		{
+			description: "regex characters in a pattern are matched literally",
+			filter:      `name ~ "A.a$"`,
+			expected:    bson.M{"name": primitive.Regex{Pattern: `^A\.a\$$`, Options: "i"}},
+			matches:     false,
+		},
+		{
+			description: "a run of wildcards is a single one",
+			filter:      `name ~ "?d**m"`,
+			expected:    bson.M{"name": primitive.Regex{Pattern: "^.d.*m$", Options: "i"}},
+			matches:     true,
+		},
+		{
+			description: "mongo operators in a value are only text",
+			filter:      `address != "{\"$gt\": \"\"}"`,
+			expected:    bson.M{"address": bson.M{"$ne": `{"$gt": ""}`}},
+			matches:     true,
+		},
+		{
+			description: "dates are compared as dates",
+			filter:      `dob >= "2002-01-01" and dob < "2003-01-01"`,
+			expected: bson.M{"$and": bson.A{
+				bson.M{"dob": bson.M{"$gte": time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+				bson.M{"dob": bson.M{"$lt": time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+			}},
+			matches: true,
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := Compile(test.filter)
+		if !assert.NoErrorf(t, err, test.description) {
+			continue
+		}
+
+		assert.Equalf(t, test.expected, ToBSON(expr), test.description)
+		assert.Equalf(t, test.matches, Match(expr, student), test.description)
+	}
+}
+
+// the percentage is a float32, mongo stores it widened to a double which no decimal literal is equal to
+func TestCompileRoundsNumbers(t *testing.T) {
+	expr, err := Compile("percentage = 99.99")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, bson.M{"percentage": bson.M{"$eq": float64(float32(99.99))}}, ToBSON(expr))
+	assert.True(t, Match(expr, models.Student{Percentage: 99.99}))
+	assert.False(t, Match(expr, models.Student{Percentage: 99.98}))
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		filter      string
+		position    int
+	}{
+		{description: "empty filter", filter: "   ", position: 1},
+		{description: "unknown field", filter: `percentage > 1 and $where = "1"`, position: 20},
+		{description: "unknown field name", filter: `grade > 1`, position: 1},
+		{description: "missing value", filter: "percentage >", position: 13},
+		{description: "missing operator", filter: `name "Adam"`, position: 6},
+		{description: "unclosed parenthesis", filter: `(name = "Adam"`, position: 15},
+		{description: "unterminated string", filter: `name = "Adam`, position: 8},
+		{description: "quoted number", filter: `percentage = "80"`, position: 14},
+		{description: "unquoted text", filter: `name = 80`, position: 8},
+		{description: "wildcard on a number", filter: `percentage ~ 8`, position: 12},
+		{description: "pattern too long", filter: `name ~ "` + strings.Repeat("a", MaxPatternLength+1) + `"`, position: 8},
+		{description: "too many wildcards", filter: `name ~ "` + strings.Repeat("a*", MaxPatternWildcards+1) + `"`, position: 8},
+		{description: "unquoted date", filter: `dob > 2002`, position: 7},
+		{description: "impossible date", filter: `dob = "2002-02-30"`, position: 7},
+		{description: "trailing tokens", filter: `name = "Adam" "Eve"`, position: 15},
+	}
+
+	for _, test := range tests {
+		_, err := Compile(test.filter)
+
+		filterErr, ok := err.(*Error)
+		if !assert.Truef(t, ok, "%s: expected a *filters.Error, got %v", test.description, err) {
+			continue
+		}
+		assert.Equalf(t, test.position, filterErr.Position, "%s: %s", test.description, filterErr.Message)
+	}
+}
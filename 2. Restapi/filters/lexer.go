@@ -0,0 +1,154 @@
+// File responsible for splitting a filter expression into tokens
+
+package filters
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // the raw text, or the unescaped value for strings
+	pos   int    // 1-based position of the first character in the expression
+	width int
+}
+
+// the comparison operators, the two character ones come first so that they win over their prefix
+var comparisonOperators = []string{">=", "<=", "!=", "=", ">", "<", "~"}
+
+type lexer struct {
+	src []rune
+	i   int
+}
+
+// function to read every token of an expression, the last token is always tokenEOF
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: []rune(src)}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.i < len(l.src) && unicode.IsSpace(l.src[l.i]) {
+		l.i++
+	}
+
+	start := l.i
+	if start >= len(l.src) {
+		return token{kind: tokenEOF, pos: start + 1}, nil
+	}
+
+	r := l.src[start]
+	switch {
+	case r == '(':
+		l.i++
+		return token{kind: tokenLParen, text: "(", pos: start + 1, width: 1}, nil
+	case r == ')':
+		l.i++
+		return token{kind: tokenRParen, text: ")", pos: start + 1, width: 1}, nil
+	case r == '"':
+		return l.readString()
+	case r == '-' || unicode.IsDigit(r):
+		return l.readNumber()
+	case unicode.IsLetter(r) || r == '_':
+		for l.i < len(l.src) && (unicode.IsLetter(l.src[l.i]) || unicode.IsDigit(l.src[l.i]) || l.src[l.i] == '_') {
+			l.i++
+		}
+
+		text := string(l.src[start:l.i])
+		tok := token{kind: tokenIdent, text: text, pos: start + 1, width: l.i - start}
+
+		// the keywords are case insensitive, field names are not
+		switch strings.ToLower(text) {
+		case "and":
+			tok.kind = tokenAnd
+		case "or":
+			tok.kind = tokenOr
+		case "not":
+			tok.kind = tokenNot
+		}
+		return tok, nil
+	}
+
+	rest := string(l.src[start:])
+	for _, operator := range comparisonOperators {
+		if strings.HasPrefix(rest, operator) {
+			l.i += len(operator)
+			return token{kind: tokenOperator, text: operator, pos: start + 1, width: len(operator)}, nil
+		}
+	}
+
+	return token{}, errorAt(start+1, "unexpected character %q", r)
+}
+
+// function to read a double quoted string, \" and \\ are the only escapes
+func (l *lexer) readString() (token, error) {
+	start := l.i
+	l.i++
+
+	var value strings.Builder
+	for l.i < len(l.src) {
+		r := l.src[l.i]
+		switch r {
+		case '"':
+			l.i++
+			return token{kind: tokenString, text: value.String(), pos: start + 1, width: l.i - start}, nil
+		case '\\':
+			if l.i+1 >= len(l.src) || (l.src[l.i+1] != '"' && l.src[l.i+1] != '\\') {
+				return token{}, errorAt(l.i+1, `invalid escape, only \" and \\ are allowed`)
+			}
+			value.WriteRune(l.src[l.i+1])
+			l.i += 2
+		default:
+			value.WriteRune(r)
+			l.i++
+		}
+	}
+
+	return token{}, errorAt(start+1, "unterminated string")
+}
+
+func (l *lexer) readNumber() (token, error) {
+	start := l.i
+	if l.src[l.i] == '-' {
+		l.i++
+	}
+
+	for l.i < len(l.src) && (unicode.IsDigit(l.src[l.i]) || l.src[l.i] == '.') {
+		l.i++
+	}
+
+	text := string(l.src[start:l.i])
+	if text == "-" {
+		return token{}, errorAt(start+1, "expected a number after '-'")
+	}
+
+	return token{kind: tokenNumber, text: text, pos: start + 1, width: l.i - start}, nil
+}
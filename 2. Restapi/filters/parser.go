@@ -0,0 +1,217 @@
+// File responsible for parsing a filter expression into a syntax tree
+//
+// The grammar, from the lowest to the highest precedence:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | primary
+//	primary    = "(" expr ")" | comparison
+//	comparison = field ( "=" | "!=" | ">" | ">=" | "<" | "<=" | "~" ) ( number | string )
+//
+// e.g. percentage > 80 and (address = "Paris" or name ~ "Ad*")
+//
+// "~" matches a text field against a case insensitive pattern where "*" stands for any text and "?" for one character
+
+package filters
+
+import "fmt"
+
+const (
+	// longest expression accepted, in characters
+	MaxLength = 1000
+
+	// deepest nesting of parentheses and "not" accepted
+	MaxDepth = 32
+)
+
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+}
+
+// function to parse an expression into a syntax tree without looking at the fields
+func Parse(src string) (Expr, error) {
+	if len([]rune(src)) > MaxLength {
+		return nil, errorAt(MaxLength+1, "the filter is longer than %d characters", MaxLength)
+	}
+
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, errorAt(1, "the filter is empty")
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errorAt(tok.pos, "unexpected %s, expected \"and\", \"or\" or the end of the filter", describe(tok))
+	}
+
+	return expr, nil
+}
+
+// function to parse and check an expression in one go, this is what the handlers use
+func Compile(src string) (Expr, error) {
+	expr, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Check(expr); err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokenEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		op := p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right, pos: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		op := p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right, pos: op.pos}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek().kind != tokenNot {
+		return p.parsePrimary()
+	}
+
+	not := p.advance()
+	if err := p.enter(not); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Not{Expr: expr, pos: not.pos}, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokenLParen:
+		p.advance()
+		if err := p.enter(tok); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, errorAt(closing.pos, "expected \")\" to close the \"(\" at position %d, got %s", tok.pos, describe(closing))
+		}
+		return expr, nil
+
+	case tokenIdent:
+		return p.parseComparison()
+	}
+
+	return nil, errorAt(tok.pos, "expected a field name or \"(\", got %s", describe(tok))
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	field := p.advance()
+
+	op := p.advance()
+	if op.kind != tokenOperator {
+		return nil, errorAt(op.pos, "expected an operator after %q, got %s", field.text, describe(op))
+	}
+
+	value := p.advance()
+	if value.kind != tokenNumber && value.kind != tokenString {
+		return nil, errorAt(value.pos, "expected a number or a quoted string after %q, got %s", op.text, describe(value))
+	}
+
+	return &Comparison{
+		FieldName: field.text,
+		Op:        op.text,
+		Literal:   value.text,
+		IsString:  value.kind == tokenString,
+		pos:       field.pos,
+		opPos:     op.pos,
+		valuePos:  value.pos,
+	}, nil
+}
+
+// function to keep track of the nesting, so that a hostile filter cannot blow the stack
+func (p *parser) enter(tok token) error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return errorAt(tok.pos, "the filter is nested deeper than %d levels", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// function to describe a token in an error message
+func describe(tok token) string {
+	switch tok.kind {
+	case tokenEOF:
+		return "the end of the filter"
+	case tokenString:
+		return fmt.Sprintf("the string %q", tok.text)
+	default:
+		return fmt.Sprintf("%q", tok.text)
+	}
+}
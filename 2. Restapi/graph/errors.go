@@ -0,0 +1,62 @@
+// File responsible for reporting the errors of the resolvers
+// They are classified like the REST errors, the kind and the failed rules are sent in the extensions of the GraphQL error
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"my-rest-api/controllers"
+	"my-rest-api/filters"
+)
+
+// Error is an error of a resolver, Extensions is picked up by graphql-go and sent along with the message
+type Error struct {
+	apiErr *controllers.APIError
+	err    error
+}
+
+func (e *Error) Error() string {
+	return e.apiErr.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// the extensions look like the problems of the REST api, e.g.
+// {"code": "validation", "errors": [{"field": "name", "rule": "required", "message": "is required"}]}
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": string(e.apiErr.Kind)}
+	if len(e.apiErr.Fields) > 0 {
+		extensions["errors"] = e.apiErr.Fields
+	}
+
+	var filterErr *filters.Error
+	if errors.As(e.err, &filterErr) {
+		extensions["position"] = filterErr.Position
+	}
+
+	return extensions
+}
+
+// function to classify the error of a resolver, nil stays nil
+// the cause of an internal error stays in the logs like in the REST api
+func toError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var graphErr *Error
+	if errors.As(err, &graphErr) {
+		return graphErr
+	}
+
+	apiErr := controllers.Classify(err)
+	if apiErr.Kind == controllers.KindInternal {
+		slog.ErrorContext(ctx, "graphql: internal error", "error", err)
+	}
+
+	return &Error{apiErr: apiErr, err: err}
+}
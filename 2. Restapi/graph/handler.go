@@ -0,0 +1,69 @@
+// File responsible for serving the GraphQL schema over HTTP
+
+package graph
+
+import (
+	"context"
+	"my-rest-api/controllers"
+	"my-rest-api/repository"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is the body of a GraphQL request, as sent by every GraphQL client
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// function to build the handler executing the GraphQL requests
+// every request gets its own loader, so the students are batched and cached for one request only
+// the answer is always a 200, the errors are listed in the "errors" of the result
+// the queries of one request may take up to requestTimeout, 0 means no limit
+// and a request which goes over the limits of the schema (MaxDepth, MaxFields) is not run at all
+func Handler(schema graphql.Schema, students repository.StudentRepository, requestTimeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request Request
+		if err := c.BodyParser(&request); err != nil {
+			return &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error(), Err: err}
+		}
+
+		// the user making the request is recorded in the audit log, like in the REST api
+		ctx, cancel := controllers.RequestContext(c, requestTimeout)
+		defer cancel()
+
+		result := Execute(WithLoader(ctx, NewStudentLoader(ctx, students)), schema, request)
+		return c.Status(http.StatusOK).JSON(result)
+	}
+}
+
+// function to run a request like graphql.Do, except that it is checked against the limits before it is validated
+// (the validation of a very large request is expensive already)
+func Execute(ctx context.Context, schema graphql.Schema, request Request) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"})})
+	if err == nil {
+		err = checkLimits(document)
+	}
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	if validation := graphql.ValidateDocument(&schema, document, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	})
+}
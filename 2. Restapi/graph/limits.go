@@ -0,0 +1,113 @@
+// File responsible for the limits of the GraphQL requests
+// A request is checked before it is validated and run, so that one request cannot make the api do an unbounded amount of work
+
+package graph
+
+import (
+	"fmt"
+	"my-rest-api/controllers"
+	"my-rest-api/repository"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// MaxIDs is the most IDs studentsByIds takes, as many as the largest page of students
+	MaxIDs = repository.MaxLimit
+
+	// MaxDepth is how deeply the selections of a request may be nested, the fields of the operation are at depth 1
+	MaxDepth = 10
+
+	// MaxFields is the most fields a request may select, the fields of a fragment count where it is defined
+	// and again every time it is spread
+	MaxFields = 500
+)
+
+// function to check a parsed request against the limits
+// the error is a bad request located at the selection which went over the limit
+func checkLimits(document *ast.Document) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	// the fragments are walked where they are defined as well, the validation goes through them even when they are not used
+	counter := &limitCounter{fragments: fragments, spreading: map[string]bool{}}
+	for _, definition := range document.Definitions {
+		var err error
+		switch definition := definition.(type) {
+		case *ast.OperationDefinition:
+			err = counter.count(definition.SelectionSet, 1)
+		case *ast.FragmentDefinition:
+			counter.spreading[definition.Name.Value] = true
+			err = counter.count(definition.SelectionSet, 1)
+			counter.spreading[definition.Name.Value] = false
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitCounter walks the selections of a request, the fragments are followed where they are spread
+type limitCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	spreading map[string]bool
+	fields    int
+}
+
+func (c *limitCounter) count(selections *ast.SelectionSet, depth int) error {
+	if selections == nil {
+		return nil
+	}
+
+	for _, selection := range selections.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if depth > MaxDepth {
+				return limitError(selection, fmt.Sprintf("the selections are nested more than %d levels deep", MaxDepth))
+			}
+
+			// the walk stops at the limit, so a request spreading its fragments over and over stays cheap to check
+			c.fields++
+			if c.fields > MaxFields {
+				return limitError(selection, fmt.Sprintf("the request selects more than %d fields", MaxFields))
+			}
+
+			if err := c.count(selection.SelectionSet, depth+1); err != nil {
+				return err
+			}
+		case *ast.InlineFragment:
+			if err := c.count(selection.SelectionSet, depth); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			// an unknown fragment is reported by the validation of the request
+			// but not a cycle of fragments, the validation of graphql-go never returns on one
+			name := selection.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok {
+				continue
+			}
+			if c.spreading[name] {
+				return limitError(selection, fmt.Sprintf("the fragment %s spreads itself", name))
+			}
+
+			c.spreading[name] = true
+			err := c.count(fragment.SelectionSet, depth)
+			c.spreading[name] = false
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func limitError(node ast.Node, detail string) error {
+	return gqlerrors.NewError(detail, []ast.Node{node}, "", nil, nil, &Error{apiErr: &controllers.APIError{Kind: controllers.KindBadRequest, Detail: detail}})
+}
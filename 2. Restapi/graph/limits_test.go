@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"fmt"
+	"my-rest-api/repository"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLimits(t *testing.T) {
+	students := &countingRepository{StudentRepository: repository.NewMemoryStudentRepository()}
+	schema, err := NewSchema(students)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ids := make([]interface{}, MaxIDs+1)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID().Hex()
+	}
+
+	data, errs := run(t, schema, students, `query($ids: [ID!]!) { studentsByIds(ids: $ids) { name } }`, map[string]interface{}{"ids": ids[:MaxIDs]})
+	assert.Empty(t, errs)
+	assert.Len(t, data["studentsByIds"], MaxIDs)
+
+	students.batches = nil
+	_, errs = run(t, schema, students, `query($ids: [ID!]!) { studentsByIds(ids: $ids) { name } }`, map[string]interface{}{"ids": ids})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "bad-request", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+	assert.Empty(t, students.batches, "nothing is looked up")
+
+	// the fields of __type are at depth 1, each ofType one level deeper
+	nested := func(levels int) string {
+		return `{ __type(name: "Student") { fields { type ` + strings.Repeat("{ ofType ", levels) + "{ name }" + strings.Repeat(" }", levels) + " } } }"
+	}
+	_, errs = run(t, schema, students, nested(MaxDepth-4), nil)
+	assert.Empty(t, errs)
+
+	_, errs = run(t, schema, students, nested(MaxDepth-3), nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "bad-request", errs[0]["extensions"].(map[string]interface{})["code"])
+		assert.NotEmpty(t, errs[0]["locations"], "the error points at the field too deep")
+	}
+
+	// every fragment spreads the previous one twice, the last one selects 2^10 fields
+	query := `query($id: ID!) { student(id: $id) { ...f10 } } fragment f0 on Student { name }`
+	for i := 1; i <= 10; i++ {
+		query += fmt.Sprintf(" fragment f%d on Student { ...f%d ...f%d }", i, i-1, i-1)
+	}
+	_, errs = run(t, schema, students, query, map[string]interface{}{"id": ids[0]})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "bad-request", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+
+	// and so is a cycle of fragments, used or not
+	for _, query := range []string{
+		`{ student(id: "628e5ac214322b31dac15601") { ...a } } fragment a on Student { name ...b } fragment b on Student { ...a }`,
+		`{ __typename } fragment a on Student { name ...b } fragment b on Student { ...a }`,
+	} {
+		_, errs = run(t, schema, students, query, nil)
+		if assert.Len(t, errs, 1) {
+			assert.Equal(t, "the fragment a spreads itself", errs[0]["message"])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// File responsible for batching the lookups of students made while resolving one GraphQL request
+// A query asking for many students by ID (with aliases, or through a list of IDs) costs a single query to the repository
+
+package graph
+
+import (
+	"context"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StudentLoader is a DataLoader of students by ID, it lives as long as the request it is created for
+// Load only queues the ID, the queued IDs are fetched together the first time one of the results is needed
+// and the students are then cached for the rest of the request
+type StudentLoader struct {
+	ctx      context.Context
+	students repository.StudentRepository
+
+	mu      sync.Mutex
+	pending []primitive.ObjectID
+	loaded  map[primitive.ObjectID]result
+}
+
+type result struct {
+	student models.Student
+	err     error
+}
+
+// function to create a loader fetching the students from the given repository
+func NewStudentLoader(ctx context.Context, students repository.StudentRepository) *StudentLoader {
+	return &StudentLoader{ctx: ctx, students: students, loaded: map[primitive.ObjectID]result{}}
+}
+
+// function to queue the lookup of a student, the returned thunk gives the student (or ErrNotFound) back
+// graphql-go calls the thunks once every field of the level has been resolved, which is what lets the lookups pile up
+func (l *StudentLoader) Load(id primitive.ObjectID) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.loaded[id]; !ok && !l.isPending(id) {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if l.isPending(id) {
+			l.fetch()
+		}
+
+		loaded := l.loaded[id]
+		if loaded.err != nil {
+			return nil, loaded.err
+		}
+		return loaded.student, nil
+	}
+}
+
+func (l *StudentLoader) isPending(id primitive.ObjectID) bool {
+	for _, pending := range l.pending {
+		if pending == id {
+			return true
+		}
+	}
+	return false
+}
+
+// function to fetch every queued student at once, the IDs the repository does not return are not found
+func (l *StudentLoader) fetch() {
+	ids := l.pending
+	l.pending = nil
+
+	students, err := l.students.GetMany(l.ctx, ids)
+
+	found := map[primitive.ObjectID]models.Student{}
+	for _, student := range students {
+		found[student.ID] = student
+	}
+
+	for _, id := range ids {
+		switch student, ok := found[id]; {
+		case err != nil:
+			l.loaded[id] = result{err: err}
+		case ok:
+			l.loaded[id] = result{student: student}
+		default:
+			l.loaded[id] = result{err: repository.ErrNotFound}
+		}
+	}
+}
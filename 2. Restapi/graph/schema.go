@@ -0,0 +1,284 @@
+// File responsible for the GraphQL schema of the students, its queries and its mutations
+// The resolvers go through the same repository and the same validator as the REST controllers
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"my-rest-api/controllers"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"my-rest-api/tracing"
+
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the validator of the model, the same rules as the REST bodies
+var validate = models.NewValidator()
+
+// key under which the loaders of a request are stored in its context
+type loaderKey struct{}
+
+// function to attach a student loader to the context of a request, the resolvers read it back with loaderFrom
+func WithLoader(ctx context.Context, loader *StudentLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+func loaderFrom(ctx context.Context, students repository.StudentRepository) *StudentLoader {
+	if loader, ok := ctx.Value(loaderKey{}).(*StudentLoader); ok {
+		return loader
+	}
+
+	// without a loader (a request not made through Handler) every lookup is a batch of its own
+	return NewStudentLoader(ctx, students)
+}
+
+// function to build the schema on top of a student repository
+// the changes made through the repository are expected to be recorded in the audit log, like the REST ones
+func NewSchema(students repository.StudentRepository) (graphql.Schema, error) {
+	studentType := objectType("Student", "A student record", models.Student{})
+	studentInput := inputType("StudentInput", "The attributes of a student which are sent by the clients", models.Student{})
+
+	pageType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "StudentPage",
+		Description: "One page of students, nextCursor is null on the last page",
+		Fields: graphql.Fields{
+			"items":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(studentType)))},
+			"count":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	versionArg := &graphql.ArgumentConfig{Type: graphql.Int, Description: "the version the student is expected to be at, like If-Match in the REST api"}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"student": &graphql.Field{
+				Type:        studentType,
+				Description: "a student by ID, null when it does not exist, the lookups of one request are batched",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Context, p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return report(p.Context, loaderFrom(p.Context, students).Load(id)), nil
+				},
+			},
+			"studentsByIds": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(studentType)),
+				Description: fmt.Sprintf("the students with the given IDs in the same order, null for the ones which are not found, %d IDs at most", MaxIDs),
+				Args:        graphql.FieldConfigArgument{"ids": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					raws := p.Args["ids"].([]interface{})
+					if len(raws) > MaxIDs {
+						return nil, toError(p.Context, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: fmt.Sprintf("%d IDs are asked for, %d at most are allowed", len(raws), MaxIDs)})
+					}
+
+					loader := loaderFrom(p.Context, students)
+
+					var thunks []func() (interface{}, error)
+					for _, raw := range raws {
+						id, err := parseID(p.Context, raw)
+						if err != nil {
+							return nil, err
+						}
+						thunks = append(thunks, loader.Load(id))
+					}
+
+					return func() (interface{}, error) {
+						found := make([]interface{}, len(thunks))
+						for i, thunk := range thunks {
+							found[i], _ = thunk()
+						}
+						return found, nil
+					}, nil
+				},
+			},
+			"students": &graphql.Field{
+				Type:        graphql.NewNonNull(pageType),
+				Description: "one page of students, filtered and sorted like GET /students",
+				Args: graphql.FieldConfigArgument{
+					"filter": {Type: graphql.String, Description: `a filter expression, e.g. percentage > 80 and name ~ "Ad*"`},
+					"sort":   {Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: `the fields to sort on, "-" sorts in descending order`},
+					"limit":  {Type: graphql.Int, Description: fmt.Sprintf("size of the page, %d by default and %d at most", repository.DefaultLimit, repository.MaxLimit)},
+					"after":  {Type: graphql.String, Description: "the nextCursor of the previous page"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					listQuery, err := parseListArgs(p.Args)
+					if err != nil {
+						return nil, toError(p.Context, err)
+					}
+
+					page, err := students.List(p.Context, listQuery)
+					if err != nil {
+						return nil, toError(p.Context, err)
+					}
+
+					var next interface{}
+					if page.NextCursor != "" {
+						next = page.NextCursor
+					}
+					return map[string]interface{}{"items": page.Students, "count": len(page.Students), "nextCursor": next}, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createStudent": &graphql.Field{
+				Type: graphql.NewNonNull(studentType),
+				Args: graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(studentInput)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					student, err := parseInput(p.Context, p.Args["input"])
+					if err != nil {
+						return nil, err
+					}
+
+					created, err := students.Create(p.Context, student)
+					return created, toError(p.Context, err)
+				},
+			},
+			"updateStudent": &graphql.Field{
+				Type: graphql.NewNonNull(studentType),
+				Args: graphql.FieldConfigArgument{
+					"id":      {Type: graphql.NewNonNull(graphql.ID)},
+					"input":   {Type: graphql.NewNonNull(studentInput)},
+					"version": versionArg,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Context, p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+
+					student, err := parseInput(p.Context, p.Args["input"])
+					if err != nil {
+						return nil, err
+					}
+
+					updated, err := students.Update(p.Context, id, student, parseVersion(p.Args["version"]))
+					return updated, toError(p.Context, err)
+				},
+			},
+			"deleteStudent": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "moves a student to the trash and gives its ID back",
+				Args: graphql.FieldConfigArgument{
+					"id":      {Type: graphql.NewNonNull(graphql.ID)},
+					"version": versionArg,
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Context, p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+
+					if _, err := students.Delete(p.Context, id, parseVersion(p.Args["version"])); err != nil {
+						return nil, toError(p.Context, err)
+					}
+					return id.Hex(), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation, Types: []graphql.Type{DateScalar}})
+}
+
+// function to wrap a thunk of the loader, a student which does not exist is null like in studentsByIds
+// (graphql-go drops the extensions of the errors coming out of a thunk, so only the unexpected errors are reported from here)
+func report(ctx context.Context, thunk func() (interface{}, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		student, err := thunk()
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return student, toError(ctx, err)
+	}
+}
+
+func parseID(ctx context.Context, raw interface{}) (primitive.ObjectID, error) {
+	value, _ := raw.(string)
+
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return id, toError(ctx, &controllers.APIError{Kind: controllers.KindInvalidID, Detail: fmt.Sprintf("%q is not a valid ID (24 hexadecimal characters)", value)})
+	}
+	return id, nil
+}
+
+// function to read the optional version argument, without it the writes do not check the version
+func parseVersion(raw interface{}) int64 {
+	if version, ok := raw.(int); ok {
+		return int64(version)
+	}
+	return repository.AnyVersion
+}
+
+// function to read a StudentInput into a student and check it against the rules of the model
+// the input goes through json like a REST body, so the attributes are read exactly the same way
+func parseInput(ctx context.Context, raw interface{}) (models.Student, error) {
+	var student models.Student
+
+	encoded, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(encoded, &student)
+	}
+	if err != nil {
+		return student, toError(ctx, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error(), Err: err})
+	}
+
+	_, span := tracing.Start(ctx, "validate student")
+	err = validate.Struct(&student)
+	tracing.End(span, err)
+	if err != nil {
+		return student, toError(ctx, err)
+	}
+
+	return student, nil
+}
+
+// function to turn the arguments of the students query into a list query, with the same checks as the REST query params
+func parseListArgs(args map[string]interface{}) (repository.ListQuery, error) {
+	var query repository.ListQuery
+
+	if filter, ok := args["filter"].(string); ok && filter != "" {
+		expr, err := filters.Compile(filter)
+		if err != nil {
+			return query, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error(), Err: err}
+		}
+		query.Filter = expr
+	}
+
+	if raw, ok := args["sort"].([]interface{}); ok {
+		keys := make([]string, len(raw))
+		for i, key := range raw {
+			keys[i], _ = key.(string)
+		}
+
+		sort, err := repository.ParseSort(keys)
+		if err != nil {
+			return query, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error()}
+		}
+		query.Sort = sort
+	}
+
+	if limit, ok := args["limit"].(int); ok {
+		if limit < 1 || limit > repository.MaxLimit {
+			return query, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: fmt.Sprintf("limit must be a number between 1 and %d", repository.MaxLimit)}
+		}
+		query.Limit = limit
+	}
+
+	query.Cursor, _ = args["after"].(string)
+	return query, nil
+}
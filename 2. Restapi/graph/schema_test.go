@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// repository counting the batched lookups
+type countingRepository struct {
+	repository.StudentRepository
+	batches [][]primitive.ObjectID
+}
+
+func (r *countingRepository) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]models.Student, error) {
+	r.batches = append(r.batches, ids)
+	return r.StudentRepository.GetMany(ctx, ids)
+}
+
+// function to run a request the way Handler does and decode its result
+func run(t *testing.T, schema graphql.Schema, students repository.StudentRepository, query string, variables map[string]interface{}) (map[string]interface{}, []map[string]interface{}) {
+	ctx := context.Background()
+	result := Execute(WithLoader(ctx, NewStudentLoader(ctx, students)), schema, Request{Query: query, Variables: variables})
+
+	raw, _ := json.Marshal(result)
+	var decoded struct {
+		Data   map[string]interface{}   `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded.Data, decoded.Errors
+}
+
+func TestSchema(t *testing.T) {
+	students := &countingRepository{StudentRepository: repository.NewMemoryStudentRepository()}
+	schema, err := NewSchema(students)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const create = `mutation($input: StudentInput!) { createStudent(input: $input) { id name dob version } }`
+
+	var ids []string
+	for _, name := range []string{"Ada", "Grace", "Linus"} {
+		data, errs := run(t, schema, students, create, map[string]interface{}{
+			"input": map[string]interface{}{"name": name, "dob": "2001-02-03", "percentage": 80.5, "address": "Paris", "description": "Go Developer"},
+		})
+		if !assert.Empty(t, errs) {
+			return
+		}
+
+		created := data["createStudent"].(map[string]interface{})
+		assert.Equal(t, name, created["name"])
+		assert.Equal(t, "2001-02-03", created["dob"])
+		assert.Equal(t, float64(1), created["version"])
+		ids = append(ids, created["id"].(string))
+	}
+
+	// the rules of the model are checked, and reported like the REST problems
+	_, errs := run(t, schema, students, create, map[string]interface{}{
+		"input": map[string]interface{}{"dob": "2999-01-01", "percentage": 80.5, "address": "Paris", "description": "Go Developer"},
+	})
+	if assert.Len(t, errs, 1) {
+		extensions := errs[0]["extensions"].(map[string]interface{})
+		assert.Equal(t, "validation", extensions["code"])
+		assert.Len(t, extensions["errors"], 2, "name is required and dob must be in the past")
+	}
+
+	// the lookups of one request are fetched in a single batch
+	students.batches = nil
+	data, errs := run(t, schema, students, `query($a: ID!, $b: ID!, $ids: [ID!]!) {
+		a: student(id: $a) { name }
+		b: student(id: $b) { name }
+		all: studentsByIds(ids: $ids) { name }
+	}`, map[string]interface{}{"a": ids[0], "b": ids[1], "ids": []interface{}{ids[2], primitive.NewObjectID().Hex(), ids[0]}})
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, data["a"])
+	assert.Equal(t, map[string]interface{}{"name": "Grace"}, data["b"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "Linus"}, nil, map[string]interface{}{"name": "Ada"}}, data["all"])
+	if assert.Len(t, students.batches, 1) {
+		assert.Len(t, students.batches[0], 4)
+	}
+
+	// the list is filtered, sorted and paginated like GET /students
+	data, errs = run(t, schema, students, `{ students(filter: "name != \"Grace\"", sort: ["-name"], limit: 1) { count items { name } nextCursor } }`, nil)
+	assert.Empty(t, errs)
+	page := data["students"].(map[string]interface{})
+	assert.Equal(t, float64(1), page["count"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "Linus"}}, page["items"])
+	assert.NotNil(t, page["nextCursor"])
+
+	data, errs = run(t, schema, students, `query($after: String) { students(filter: "name != \"Grace\"", sort: ["-name"], limit: 1, after: $after) { items { name } nextCursor } }`,
+		map[string]interface{}{"after": page["nextCursor"]})
+	assert.Empty(t, errs)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "Ada"}}, data["students"].(map[string]interface{})["items"])
+
+	_, errs = run(t, schema, students, `{ students(filter: "percentage > \"80\"") { count } }`, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "bad-request", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+
+	// the writes check the version like If-Match
+	_, errs = run(t, schema, students, `mutation($id: ID!) { updateStudent(id: $id, version: 7, input: {name: "Ada L", dob: "2001-02-03", percentage: 90, address: "London", description: "Go Developer"}) { version } }`,
+		map[string]interface{}{"id": ids[0]})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "precondition-failed", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+
+	data, errs = run(t, schema, students, `mutation($id: ID!) { updateStudent(id: $id, version: 1, input: {name: "Ada L", dob: "2001-02-03", percentage: 90, address: "London", description: "Go Developer"}) { name version } }`,
+		map[string]interface{}{"id": ids[0]})
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]interface{}{"name": "Ada L", "version": float64(2)}, data["updateStudent"])
+
+	data, errs = run(t, schema, students, `mutation($id: ID!) { deleteStudent(id: $id) }`, map[string]interface{}{"id": ids[0]})
+	assert.Empty(t, errs)
+	assert.Equal(t, ids[0], data["deleteStudent"])
+
+	data, errs = run(t, schema, students, `query($id: ID!) { student(id: $id) { name } }`, map[string]interface{}{"id": ids[0]})
+	assert.Empty(t, errs)
+	assert.Nil(t, data["student"], "a deleted student is not found")
+
+	_, errs = run(t, schema, students, `mutation($id: ID!) { deleteStudent(id: $id) }`, map[string]interface{}{"id": ids[0]})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "not-found", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+
+	_, errs = run(t, schema, students, `{ student(id: "42") { name } }`, nil)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "invalid-id", errs[0]["extensions"].(map[string]interface{})["code"])
+	}
+}
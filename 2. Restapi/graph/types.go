@@ -0,0 +1,181 @@
+// File responsible for describing the student model as GraphQL types, out of its json and validate tags
+// A field added to models.Student shows up in the GraphQL schema without any change in here
+
+package graph
+
+import (
+	"fmt"
+	"my-rest-api/models"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+	dateType     = reflect.TypeOf(models.Date{})
+)
+
+// DateScalar is a calendar date written as "2006-01-02", like the dates of the REST api
+var DateScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Date",
+	Description: "A calendar date written as YYYY-MM-DD",
+	Serialize: func(value interface{}) interface{} {
+		date, ok := value.(models.Date)
+		if !ok || date.IsZero() {
+			return nil
+		}
+		return date.String()
+	},
+	ParseValue: func(value interface{}) interface{} {
+		raw, ok := value.(string)
+		if !ok {
+			return nil
+		}
+
+		date, err := models.ParseDate(raw)
+		if err != nil {
+			return nil
+		}
+		return date
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		raw, ok := value.(*ast.StringValue)
+		if !ok {
+			return nil
+		}
+
+		date, err := models.ParseDate(raw.Value)
+		if err != nil {
+			return nil
+		}
+		return date
+	},
+})
+
+// modelField is a field of a model along with the name it gets in the GraphQL schema
+type modelField struct {
+	name  string
+	index int
+	field reflect.StructField
+	rules string
+}
+
+// function to list the fields of a model which are sent in json, under their json name
+// the "_id" of MongoDB is called "id" as it is the convention in GraphQL
+func modelFields(t reflect.Type) []modelField {
+	var fields []modelField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == "_id" {
+			name = "id"
+		}
+
+		fields = append(fields, modelField{name: name, index: i, field: field, rules: field.Tag.Get("validate")})
+	}
+
+	return fields
+}
+
+// function to build the output type of a model
+// the fields with a required rule and the ones set by the server (no rules, not a pointer) are never null
+func objectType(name string, description string, model interface{}) *graphql.Object {
+	fields := graphql.Fields{}
+	for _, f := range modelFields(reflect.TypeOf(model)) {
+		f := f
+
+		var output graphql.Output = scalarType(f.field.Type)
+		if strings.Contains(f.rules, "required") || (f.rules == "" && f.field.Type.Kind() != reflect.Ptr) {
+			output = graphql.NewNonNull(output)
+		}
+
+		fields[f.name] = &graphql.Field{
+			Type:        output,
+			Description: rulesDescription(f.rules),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return fieldValue(reflect.ValueOf(p.Source), f.index), nil
+			},
+		}
+	}
+
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Description: description, Fields: fields})
+}
+
+// function to build the input type of a model, made of the fields which carry validate rules like the REST bodies
+// the rules themselves are checked by the validator of the model once the input is read, so the fields are all nullable
+func inputType(name string, description string, model interface{}) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, f := range modelFields(reflect.TypeOf(model)) {
+		if f.rules == "" {
+			continue
+		}
+
+		fields[f.name] = &graphql.InputObjectFieldConfig{Type: scalarType(f.field.Type), Description: rulesDescription(f.rules)}
+	}
+
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Description: description, Fields: fields})
+}
+
+func rulesDescription(rules string) string {
+	if rules == "" {
+		return "set by the server"
+	}
+	return fmt.Sprintf("validate: %s", rules)
+}
+
+// function to find the GraphQL scalar of a go type
+func scalarType(t reflect.Type) *graphql.Scalar {
+	switch t {
+	case objectIDType:
+		return graphql.ID
+	case timeType:
+		return graphql.DateTime
+	case dateType:
+		return DateScalar
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return scalarType(t.Elem())
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	}
+
+	return graphql.String
+}
+
+// function to read a field of a model the way the scalars expect it, the IDs as hexadecimal strings
+func fieldValue(source reflect.Value, index int) interface{} {
+	if source.Kind() == reflect.Ptr {
+		source = source.Elem()
+	}
+
+	value := source.Field(index)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if id, ok := value.Interface().(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return value.Interface()
+}
@@ -0,0 +1,85 @@
+// File responsible for turning the students and the audit entries into their protobuf messages and back
+
+package grpcserver
+
+import (
+	"my-rest-api/controllers"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"my-rest-api/responses"
+	"my-rest-api/studentpb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// function to build the message of a student, the dates are written like in the REST api
+func toStudent(student models.Student) *studentpb.Student {
+	message := &studentpb.Student{
+		Id:          student.ID.Hex(),
+		RollNumber:  student.RollNumber,
+		Name:        student.Name,
+		Percentage:  student.Percentage,
+		Address:     student.Address,
+		Description: student.Description,
+		CreatedAt:   timestamppb.New(student.CreatedAt),
+		UpdatedAt:   timestamppb.New(student.UpdatedAt),
+		Version:     student.Version,
+	}
+
+	if !student.DOB.IsZero() {
+		message.Dob = student.DOB.String()
+	}
+	if student.DeletedAt != nil {
+		message.DeletedAt = timestamppb.New(*student.DeletedAt)
+	}
+
+	return message
+}
+
+// function to read the input of a client into a student and check it against the rules of the model
+// a dob which is not a date is reported like a failed rule, along with the other ones
+func fromInput(input *studentpb.StudentInput) (models.Student, error) {
+	student := models.Student{
+		RollNumber:  input.GetRollNumber(),
+		Name:        input.GetName(),
+		Percentage:  input.GetPercentage(),
+		Address:     input.GetAddress(),
+		Description: input.GetDescription(),
+	}
+
+	if input.GetDob() != "" {
+		dob, err := models.ParseDate(input.GetDob())
+		if err != nil {
+			return student, &controllers.APIError{Kind: controllers.KindValidation, Detail: "the student does not follow the rules of the model", Fields: []responses.FieldError{
+				{Field: "dob", Rule: "format", Param: "date", Message: err.Error()},
+			}}
+		}
+		student.DOB = dob
+	}
+
+	if err := validate.Struct(&student); err != nil {
+		return student, err
+	}
+
+	return student, nil
+}
+
+// function to build the event of a change of the feed, its id is where the feed is right after it
+func toEvent(change repository.Change) *studentpb.StudentEvent {
+	entry := change.Entry
+	fields := make([]string, len(entry.Changes))
+	for i, change := range entry.Changes {
+		fields[i] = change.Field
+	}
+
+	return &studentpb.StudentEvent{
+		Id:            change.Position.String(),
+		Action:        entry.Action,
+		StudentId:     entry.StudentID.Hex(),
+		Version:       entry.Version,
+		Actor:         entry.Actor,
+		At:            timestamppb.New(entry.At),
+		Student:       toStudent(entry.Snapshot),
+		ChangedFields: fields,
+	}
+}
@@ -0,0 +1,55 @@
+// File responsible for reporting the errors of the gRPC api
+// They are classified like the REST errors and sent as gRPC statuses, the failed rules go in a BadRequest detail
+
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"my-rest-api/controllers"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the code which goes with every kind of error
+var errorCodes = map[controllers.ErrorKind]codes.Code{
+	controllers.KindNotFound:           codes.NotFound,
+	controllers.KindInvalidID:          codes.InvalidArgument,
+	controllers.KindValidation:         codes.InvalidArgument,
+	controllers.KindBadRequest:         codes.InvalidArgument,
+	controllers.KindConflict:           codes.AlreadyExists,
+	controllers.KindPreconditionFailed: codes.FailedPrecondition,
+}
+
+// function to turn the error of a call into a status, nil stays nil
+// the cause of an internal error stays in the logs like in the REST api
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	apiErr := controllers.Classify(err)
+	code, ok := errorCodes[apiErr.Kind]
+	if !ok {
+		slog.ErrorContext(ctx, "grpc: internal error", "error", err)
+		code = codes.Internal
+	}
+
+	st := status.New(code, apiErr.Detail)
+	if len(apiErr.Fields) == 0 {
+		return st.Err()
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(apiErr.Fields))
+	for i, field := range apiErr.Fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message}
+	}
+
+	// the status is sent without the details rather than not at all
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
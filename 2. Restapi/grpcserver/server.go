@@ -0,0 +1,59 @@
+// File responsible for building the gRPC server out of the StudentService
+
+package grpcserver
+
+import (
+	"context"
+	"my-rest-api/studentpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Server is the gRPC server of the students along with its health checks
+type Server struct {
+	*grpc.Server
+
+	service *StudentService
+	checks  *health.Server
+}
+
+// function to build a gRPC server serving the students
+// it also answers the standard health checks and describes its services through reflection, for tools such as grpcurl
+func NewServer(service *StudentService) *Server {
+	server := grpc.NewServer()
+	studentpb.RegisterStudentServiceServer(server, service)
+
+	// the storage is owned by the rest of the process, the service is serving as long as the server is
+	checks := health.NewServer()
+	checks.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	checks.SetServingStatus(studentpb.StudentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, checks)
+
+	reflection.Register(server)
+
+	return &Server{Server: server, service: service, checks: checks}
+}
+
+// function to stop the server gracefully, the health checks report it as not serving anymore
+// and the Watch streams are ended so that the calls in progress can finish, the remaining ones are cut once the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.checks.Shutdown()
+	s.service.stopWatching()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,210 @@
+// File containing the StudentService of the gRPC api
+// The calls go through the same repository and the same validator as the REST controllers
+
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"my-rest-api/controllers"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"my-rest-api/studentpb"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// the validator of the model, the same rules as the REST bodies
+var validate = models.NewValidator()
+
+// metadata naming the user who makes the call, like the X-User header of the REST api
+const MetadataUser = "x-user"
+
+// StudentService serves the students over gRPC
+type StudentService struct {
+	studentpb.UnimplementedStudentServiceServer
+
+	students repository.StudentRepository
+	feed     *repository.ChangeFeed
+
+	// closed when the server shuts down, the Watch streams end then
+	stopping chan struct{}
+	once     sync.Once
+}
+
+// function to create the service on top of a student repository
+// the changes made through the students repository are expected to be recorded in the audit log, Watch follows the change feed
+func NewStudentService(students repository.StudentRepository, feed *repository.ChangeFeed) *StudentService {
+	return &StudentService{students: students, feed: feed, stopping: make(chan struct{})}
+}
+
+func (s *StudentService) stopWatching() {
+	s.once.Do(func() { close(s.stopping) })
+}
+
+// function to attach the user making the call to its context, it is recorded in the audit log along with the changes
+func callContext(ctx context.Context) context.Context {
+	var actor string
+	if values := metadata.ValueFromIncomingContext(ctx, MetadataUser); len(values) > 0 {
+		actor = values[0]
+	}
+	return repository.WithActor(ctx, actor)
+}
+
+// function to read a student identifier, the ID or an alternate identifier like "roll:A42" as in the REST routes
+func (s *StudentService) studentID(ctx context.Context, raw string) (primitive.ObjectID, error) {
+	identifier, ok := models.ParseStudentIdentifier(raw)
+	if !ok {
+		return primitive.NilObjectID, controllers.InvalidStudentIdentifier(raw)
+	}
+
+	return repository.ResolveStudentID(ctx, s.students, identifier, false)
+}
+
+// function to read the optional expected version of a write, without it the version is not checked
+func version(expected *int64) int64 {
+	if expected == nil {
+		return repository.AnyVersion
+	}
+	return *expected
+}
+
+func (s *StudentService) Get(ctx context.Context, request *studentpb.GetStudentRequest) (*studentpb.Student, error) {
+	id, err := s.studentID(ctx, request.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	student, err := s.students.Get(ctx, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toStudent(student), nil
+}
+
+// the list is filtered, sorted and paginated like GET /students
+func (s *StudentService) List(ctx context.Context, request *studentpb.ListStudentsRequest) (*studentpb.ListStudentsResponse, error) {
+	query := repository.ListQuery{Cursor: request.GetCursor(), Limit: int(request.GetLimit())}
+
+	if request.GetFilter() != "" {
+		expr, err := filters.Compile(request.GetFilter())
+		if err != nil {
+			return nil, toStatus(ctx, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error(), Err: err})
+		}
+		query.Filter = expr
+	}
+
+	if len(request.GetSort()) > 0 {
+		sort, err := repository.ParseSort(request.GetSort())
+		if err != nil {
+			return nil, toStatus(ctx, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: err.Error()})
+		}
+		query.Sort = sort
+	}
+
+	if query.Limit < 0 || query.Limit > repository.MaxLimit {
+		return nil, toStatus(ctx, &controllers.APIError{Kind: controllers.KindBadRequest, Detail: fmt.Sprintf("limit must be a number between 1 and %d", repository.MaxLimit)})
+	}
+
+	page, err := s.students.List(ctx, query)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	response := &studentpb.ListStudentsResponse{NextCursor: page.NextCursor}
+	for _, student := range page.Students {
+		response.Students = append(response.Students, toStudent(student))
+	}
+
+	return response, nil
+}
+
+func (s *StudentService) Create(ctx context.Context, request *studentpb.CreateStudentRequest) (*studentpb.Student, error) {
+	student, err := fromInput(request.GetStudent())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	created, err := s.students.Create(callContext(ctx), student)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toStudent(created), nil
+}
+
+func (s *StudentService) Update(ctx context.Context, request *studentpb.UpdateStudentRequest) (*studentpb.Student, error) {
+	id, err := s.studentID(ctx, request.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	student, err := fromInput(request.GetStudent())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	updated, err := s.students.Update(callContext(ctx), id, student, version(request.Version))
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toStudent(updated), nil
+}
+
+// a delete moves the student to the trash like DELETE /student/:id
+func (s *StudentService) Delete(ctx context.Context, request *studentpb.DeleteStudentRequest) (*emptypb.Empty, error) {
+	id, err := s.studentID(ctx, request.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	if _, err := s.students.Delete(callContext(ctx), id, version(request.Version)); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// the changes are read from the change feed, so the ones made through the REST and GraphQL apis (or without any api) are streamed as well
+// a client which reconnects with the id of the last event it got does not miss any change
+func (s *StudentService) Watch(request *studentpb.WatchStudentsRequest, stream studentpb.StudentService_WatchServer) error {
+	var from repository.FeedPosition
+	if request.GetAfterEventId() != "" {
+		position, ok := repository.ParseFeedPosition(request.GetAfterEventId())
+		if !ok {
+			return toStatus(stream.Context(), controllers.InvalidEventID(request.GetAfterEventId()))
+		}
+		from = position
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := s.feed.Follow(ctx, from, func(change repository.Change) error {
+		return stream.Send(toEvent(change))
+	})
+
+	// the client going away is the normal end of the stream, the server going away is one the client should recover from
+	switch {
+	case stream.Context().Err() != nil:
+		return nil
+	case ctx.Err() != nil:
+		return status.Error(codes.Unavailable, "the server is shutting down, watch again after the last event received")
+	}
+	return toStatus(ctx, err)
+}
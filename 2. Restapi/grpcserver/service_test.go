@@ -0,0 +1,187 @@
+package grpcserver
+
+import (
+	"context"
+	"my-rest-api/repository"
+	"my-rest-api/studentpb"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// an event id older than any event
+var beginning = primitive.NewObjectIDFromTimestamp(time.Unix(1, 0)).Hex()
+
+// function to serve the api over an in-memory connection, on top of empty in-memory stores
+func newTestClient(t *testing.T) (*grpc.ClientConn, *Server) {
+	audit := repository.NewMemoryAuditRepository()
+	students := repository.NewAuditedStudentRepository(repository.NewMemoryStudentRepository(), audit)
+	server := NewServer(NewStudentService(students, repository.NewChangeFeed(audit, nil, 10*time.Millisecond)))
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, server
+}
+
+func TestStudentService(t *testing.T) {
+	conn, _ := newTestClient(t)
+	client := studentpb.NewStudentServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "student.v1.StudentService"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.Status)
+	}
+
+	// the changes are watched from the beginning of the audit log, the server may only get to the call after the first changes
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	watch, err := client.Watch(watchCtx, &studentpb.WatchStudentsRequest{AfterEventId: beginning})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the rules of the model are checked, and every failed one is listed in the details
+	_, err = client.Create(ctx, &studentpb.CreateStudentRequest{Student: &studentpb.StudentInput{Dob: "2999-01-01", Percentage: 80.5, Address: "Paris", Description: "Go Developer"}})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Len(t, st.Details()[0].(*errdetails.BadRequest).FieldViolations, 2, "name is required and dob must be in the past")
+	}
+
+	_, err = client.Create(ctx, &studentpb.CreateStudentRequest{Student: &studentpb.StudentInput{Name: "Ada", Dob: "2001-02-30", Percentage: 80.5, Address: "Paris", Description: "Go Developer"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	userCtx := metadata.AppendToOutgoingContext(ctx, MetadataUser, "alice")
+	var ids []string
+	for _, name := range []string{"Ada", "Grace"} {
+		created, err := client.Create(userCtx, &studentpb.CreateStudentRequest{Student: &studentpb.StudentInput{RollNumber: name + "1", Name: name, Dob: "2001-02-03", Percentage: 80.5, Address: "Paris", Description: "Go Developer"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "2001-02-03", created.Dob)
+		assert.Equal(t, int64(1), created.Version)
+		ids = append(ids, created.Id)
+	}
+
+	student, err := client.Get(ctx, &studentpb.GetStudentRequest{Id: "roll:Grace1"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, ids[1], student.Id)
+	}
+
+	_, err = client.Get(ctx, &studentpb.GetStudentRequest{Id: "42"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the list is filtered, sorted and paginated like GET /students
+	page, err := client.List(ctx, &studentpb.ListStudentsRequest{Sort: []string{"-name"}, Limit: 1})
+	if assert.NoError(t, err) && assert.Len(t, page.Students, 1) {
+		assert.Equal(t, "Grace", page.Students[0].Name)
+		assert.NotEmpty(t, page.NextCursor)
+	}
+
+	_, err = client.List(ctx, &studentpb.ListStudentsRequest{Filter: "name ~"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the writes check the version like If-Match
+	stale := int64(7)
+	_, err = client.Update(ctx, &studentpb.UpdateStudentRequest{Id: ids[0], Version: &stale, Student: &studentpb.StudentInput{Name: "Ada L", Dob: "2001-02-03", Percentage: 90, Address: "London", Description: "Go Developer"}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Create(ctx, &studentpb.CreateStudentRequest{Student: &studentpb.StudentInput{RollNumber: "Ada1", Name: "Ada", Dob: "2001-02-03", Percentage: 80.5, Address: "Paris", Description: "Go Developer"}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	current := int64(1)
+	updated, err := client.Update(userCtx, &studentpb.UpdateStudentRequest{Id: ids[0], Version: &current, Student: &studentpb.StudentInput{Name: "Ada L", Dob: "2001-02-03", Percentage: 90, Address: "London", Description: "Go Developer"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), updated.Version)
+	}
+
+	_, err = client.Delete(userCtx, &studentpb.DeleteStudentRequest{Id: ids[0]})
+	assert.NoError(t, err)
+
+	_, err = client.Get(ctx, &studentpb.GetStudentRequest{Id: ids[0]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// every change made since the watch started is streamed in order
+	var events []*studentpb.StudentEvent
+	for len(events) < 4 {
+		event, err := watch.Recv()
+		if !assert.NoError(t, err) {
+			return
+		}
+		events = append(events, event)
+	}
+	assert.Equal(t, []string{"create", "create", "update", "delete"}, []string{events[0].Action, events[1].Action, events[2].Action, events[3].Action})
+	assert.Equal(t, "alice", events[2].Actor)
+	assert.Equal(t, ids[0], events[2].StudentId)
+	assert.Contains(t, events[2].ChangedFields, "name")
+	assert.NotNil(t, events[3].Student.DeletedAt)
+
+	// a client resuming after an event gets the ones which followed
+	// and again the ones written shortly before, it may not have seen them all
+	resumed, err := client.Watch(watchCtx, &studentpb.WatchStudentsRequest{AfterEventId: events[1].Id})
+	if assert.NoError(t, err) {
+		var ids []string
+		for len(ids) < 3 {
+			event, err := resumed.Recv()
+			if !assert.NoError(t, err) {
+				return
+			}
+			ids = append(ids, event.Id)
+		}
+		assert.Equal(t, []string{events[0].Id, events[2].Id, events[3].Id}, ids)
+	}
+
+	// the errors of a stream come with its first message
+	invalid, err := client.Watch(ctx, &studentpb.WatchStudentsRequest{AfterEventId: "42"})
+	if assert.NoError(t, err) {
+		_, err = invalid.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	conn, server := newTestClient(t)
+	client := studentpb.NewStudentServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	watch, err := client.Watch(ctx, &studentpb.WatchStudentsRequest{AfterEventId: beginning})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// making sure the stream is running before shutting down
+	_, err = client.Create(ctx, &studentpb.CreateStudentRequest{Student: &studentpb.StudentInput{Name: "Ada", Dob: "2001-02-03", Percentage: 80.5, Address: "Paris", Description: "Go Developer"}})
+	assert.NoError(t, err)
+	_, err = watch.Recv()
+	assert.NoError(t, err)
+
+	// the watch streams are ended rather than holding the shutdown until its deadline
+	assert.NoError(t, server.Shutdown(ctx))
+
+	_, err = watch.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
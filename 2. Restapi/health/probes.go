@@ -0,0 +1,194 @@
+// Package health answers the probes of the orchestrator: liveness, readiness and startup
+// Every probe is a set of named checks which are run together, the probe passes when all of them pass
+package health
+
+import (
+	"context"
+	"errors"
+	"my-rest-api/lifecycle"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// how long a single check may take before it is reported as failed
+const checkTimeout = 2 * time.Second
+
+// the status of a check, and of a whole probe
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// Check tells whether a component is healthy, it should give up once its context is done
+type Check func(ctx context.Context) error
+
+// Report is the answer of a probe, with the result of each of its checks
+type Report struct {
+	Status string                     `json:"status"`
+	Checks map[string]ComponentReport `json:"checks"`
+}
+
+// ComponentReport is the result of a single check, Error explains why it failed
+type ComponentReport struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Probe is a set of named checks
+type Probe struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// function to create a probe without any check, it always passes
+func NewProbe() *Probe {
+	return &Probe{checks: map[string]Check{}}
+}
+
+// function to add a check to the probe, a check registered again under the same name replaces the previous one
+func (p *Probe) Register(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checks[name] = check
+}
+
+// function to run every check at the same time and report on each of them
+func (p *Probe) Run(ctx context.Context) Report {
+	// the checks are picked under the lock, they may be registered while the probe runs
+	p.mu.RLock()
+	names := make([]string, 0, len(p.checks))
+	for name := range p.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = p.checks[name]
+	}
+	p.mu.RUnlock()
+
+	results := make([]ComponentReport, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusPass, Checks: map[string]ComponentReport{}}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status == StatusFail {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func run(ctx context.Context, check Check) ComponentReport {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := ComponentReport{Status: StatusPass, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status, result.Error = StatusFail, err.Error()
+	}
+
+	return result
+}
+
+// function to build the handler of the probe, it answers 200 when every check passes and 503 otherwise
+func (p *Probe) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := p.Run(c.UserContext())
+
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+		return c.Status(status).JSON(report)
+	}
+}
+
+// errors of the checks the probes start with
+var (
+	ErrStarting = errors.New("the application is still starting")
+	ErrStopping = errors.New("the application is shutting down")
+)
+
+// Probes are the three probes of the application
+// liveness only fails when the process should be restarted, readiness when it should not get traffic for now
+// and startup until every subsystem is started
+type Probes struct {
+	Liveness  *Probe
+	Readiness *Probe
+	Startup   *Probe
+
+	// set to 1 once every subsystem is started
+	started int32
+}
+
+// function to create the probes, the startup probe fails until Started has been run by the lifecycle
+func NewProbes() *Probes {
+	probes := &Probes{Liveness: NewProbe(), Readiness: NewProbe(), Startup: NewProbe()}
+
+	probes.Startup.Register("lifecycle", func(ctx context.Context) error {
+		if !probes.isStarted() {
+			return ErrStarting
+		}
+		return nil
+	})
+
+	return probes
+}
+
+func (p *Probes) isStarted() bool {
+	return atomic.LoadInt32(&p.started) == 1
+}
+
+// function to build the hook marking the end of the startup, it must be the last hook of the lifecycle
+// it also makes the readiness fail as soon as the lifecycle starts stopping, and being the last hook it is the first one stopped:
+// it waits drainDelay before the apis stop accepting connections, so that the orchestrator has the time to send the traffic elsewhere
+func (p *Probes) Started(lc *lifecycle.Lifecycle, drainDelay time.Duration) lifecycle.Hook {
+	p.Readiness.Register("lifecycle", func(ctx context.Context) error {
+		select {
+		case <-lc.Stopping():
+			return ErrStopping
+		default:
+		}
+
+		if !p.isStarted() {
+			return ErrStarting
+		}
+		return nil
+	})
+
+	return lifecycle.Hook{
+		Name: "startup probe",
+		OnStart: func(ctx context.Context) error {
+			atomic.StoreInt32(&p.started, 1)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			select {
+			case <-time.After(drainDelay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
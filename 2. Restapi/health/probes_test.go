@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"my-rest-api/lifecycle"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	probe := NewProbe()
+	assert.Equal(t, Report{Status: StatusPass, Checks: map[string]ComponentReport{}}, probe.Run(context.Background()))
+
+	probe.Register("cache", func(ctx context.Context) error { return nil })
+	probe.Register("database", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	// a check which does not answer in time fails without holding the probe
+	probe.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	report := probe.Run(ctx)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusPass, report.Checks["cache"].Status)
+	assert.Equal(t, ComponentReport{Status: StatusFail, LatencyMs: report.Checks["database"].LatencyMs, Error: "connection refused"}, report.Checks["database"])
+	assert.Equal(t, "context deadline exceeded", report.Checks["slow"].Error)
+	assert.GreaterOrEqual(t, report.Checks["slow"].LatencyMs, float64(10))
+}
+
+func TestProbeRegisteredWhileRunning(t *testing.T) {
+	probe := NewProbe()
+	probe.Register("database", func(ctx context.Context) error { return nil })
+
+	// the checks may be registered while the probe answers, which the race detector checks
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			probe.Register(fmt.Sprintf("check %d", i%5), func(ctx context.Context) error { return nil })
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, StatusPass, probe.Run(context.Background()).Status)
+	}
+	wg.Wait()
+}
+
+func TestProbesFollowTheLifecycle(t *testing.T) {
+	probes := NewProbes()
+	lc := lifecycle.New()
+	lc.Append(probes.Started(lc, 0))
+
+	ctx := context.Background()
+	assert.Equal(t, ErrStarting.Error(), probes.Startup.Run(ctx).Checks["lifecycle"].Error)
+	assert.Equal(t, StatusFail, probes.Readiness.Run(ctx).Status)
+	assert.Equal(t, StatusPass, probes.Liveness.Run(ctx).Status)
+
+	assert.NoError(t, lc.Start(ctx))
+	assert.Equal(t, StatusPass, probes.Startup.Run(ctx).Status)
+	assert.Equal(t, StatusPass, probes.Readiness.Run(ctx).Status)
+
+	// the readiness fails as soon as the application stops, while it is still alive
+	assert.NoError(t, lc.Stop(ctx))
+	assert.Equal(t, ErrStopping.Error(), probes.Readiness.Run(ctx).Checks["lifecycle"].Error)
+	assert.Equal(t, StatusPass, probes.Liveness.Run(ctx).Status)
+}
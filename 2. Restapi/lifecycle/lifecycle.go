@@ -0,0 +1,153 @@
+// Package lifecycle starts and stops the parts of the application in order
+// Every subsystem (a server, a database client, ...) registers a hook with its start and stop work, the hooks are started
+// in the order they were added and stopped in the reverse order, so that a part is stopped before the ones it depends on
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hook is the start and stop work of a subsystem, either function may be left out
+// OnStart must not block, a server starts serving in a goroutine and reports an unexpected end with Lifecycle.Fail
+// OnStop should give up once its context is done
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Lifecycle holds the hooks of the application
+type Lifecycle struct {
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+
+	failed   chan error
+	stopping chan struct{}
+	once     sync.Once
+}
+
+// function to create a lifecycle without any hook
+func New() *Lifecycle {
+	return &Lifecycle{failed: make(chan error, 1), stopping: make(chan struct{})}
+}
+
+// function to register the start and stop work of a subsystem
+// a hook added once the lifecycle is started is only started along with the next ones, never on its own
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hooks = append(l.hooks, hook)
+}
+
+// function to start the hooks in order
+// when one of them fails the ones already started are stopped again, in the reverse order, before the error is returned
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	hooks := l.hooks[l.started:]
+	l.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				err = fmt.Errorf("starting %s: %w", hook.Name, err)
+				if stopErr := l.Stop(ctx); stopErr != nil {
+					return fmt.Errorf("%w, then %v", err, stopErr)
+				}
+				return err
+			}
+		}
+
+		l.mu.Lock()
+		l.started++
+		l.mu.Unlock()
+	}
+
+	return nil
+}
+
+// function to stop the started hooks in the reverse order
+// every hook is stopped even when one of them fails, the errors are returned together
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.once.Do(func() { close(l.stopping) })
+
+	l.mu.Lock()
+	hooks := l.hooks[:l.started]
+	l.started = 0
+	l.mu.Unlock()
+
+	var failures []string
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hooks[i].OnStop == nil {
+			continue
+		}
+		if err := hooks[i].OnStop(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("stopping %s: %v", hooks[i].Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// function for a subsystem to report that it stopped on its own, e.g. a server which cannot accept connections anymore
+// Run stops the whole application on the first failure, the next ones are only logged
+func (l *Lifecycle) Fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+		slog.Error("lifecycle: subsystem failed", "error", err)
+	}
+}
+
+// Stopping is closed as soon as the application starts stopping, e.g. for the readiness checks to fail while it drains
+func (l *Lifecycle) Stopping() <-chan struct{} {
+	return l.stopping
+}
+
+// function to start the hooks and keep the application running until it receives SIGINT or SIGTERM, or a subsystem fails
+// the hooks are then stopped, and given at most shutdownTimeout to do so (0 means no limit)
+func (l *Lifecycle) Run(ctx context.Context, shutdownTimeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := l.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case runErr = <-l.failed:
+		slog.Error("shutting down", "error", runErr)
+	}
+
+	// the signal context is done already, stopping gets a context of its own
+	stopCtx := context.Background()
+	if shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		stopCtx, cancel = context.WithTimeout(stopCtx, shutdownTimeout)
+		defer cancel()
+	}
+
+	stopErr := l.Stop(stopCtx)
+	switch {
+	case runErr != nil && stopErr != nil:
+		return fmt.Errorf("%w, then %v", runErr, stopErr)
+	case runErr != nil:
+		return runErr
+	}
+	return stopErr
+}
@@ -0,0 +1,110 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// function to build a hook which writes down when it is started and stopped
+func recordingHook(name string, calls *[]string, startErr error, stopErr error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			*calls = append(*calls, "start "+name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			*calls = append(*calls, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	var calls []string
+	lc := New()
+	lc.Append(recordingHook("db", &calls, nil, nil))
+	lc.Append(Hook{Name: "nothing to do"})
+	lc.Append(recordingHook("api", &calls, nil, errors.New("still busy")))
+
+	assert.NoError(t, lc.Start(context.Background()))
+	assert.Equal(t, []string{"start db", "start api"}, calls)
+
+	select {
+	case <-lc.Stopping():
+		t.Fatal("the lifecycle is not stopping yet")
+	default:
+	}
+
+	// every hook is stopped, in the reverse order, even when one of them fails
+	calls = nil
+	err := lc.Stop(context.Background())
+	if assert.Error(t, err) {
+		assert.Equal(t, "stopping api: still busy", err.Error())
+	}
+	assert.Equal(t, []string{"stop api", "stop db"}, calls)
+	<-lc.Stopping()
+
+	// stopping again has nothing left to stop
+	calls = nil
+	assert.NoError(t, lc.Stop(context.Background()))
+	assert.Empty(t, calls)
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	var calls []string
+	lc := New()
+	lc.Append(recordingHook("db", &calls, nil, nil))
+	lc.Append(recordingHook("api", &calls, errors.New("address in use"), nil))
+	lc.Append(recordingHook("never", &calls, nil, nil))
+
+	// the hooks which were started are stopped again, the failed one is not
+	err := lc.Start(context.Background())
+	if assert.Error(t, err) {
+		assert.Equal(t, "starting api: address in use", err.Error())
+	}
+	assert.Equal(t, []string{"start db", "start api", "stop db"}, calls)
+}
+
+func TestRun(t *testing.T) {
+	var calls []string
+	lc := New()
+	lc.Append(recordingHook("db", &calls, nil, nil))
+
+	stopped := make(chan struct{})
+	lc.Append(Hook{
+		Name: "api",
+		OnStart: func(ctx context.Context) error {
+			go lc.Fail(errors.New("api: listener closed"))
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// the hooks get the shutdown deadline
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			close(stopped)
+			return nil
+		},
+	})
+
+	// a subsystem failing stops the whole application
+	err := lc.Run(context.Background(), time.Second)
+	if assert.Error(t, err) {
+		assert.Equal(t, "api: listener closed", err.Error())
+	}
+	<-stopped
+	assert.Equal(t, []string{"start db", "stop db"}, calls)
+
+	// the application is stopped as well when the context of Run is done, as it is on SIGINT and SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = nil
+	lc = New()
+	lc.Append(recordingHook("db", &calls, nil, nil))
+	assert.NoError(t, lc.Run(ctx, 0))
+	assert.Equal(t, []string{"start db", "stop db"}, calls)
+}
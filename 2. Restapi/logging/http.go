@@ -0,0 +1,87 @@
+// File responsible for the ID and the log line of every HTTP request
+
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"my-rest-api/middleware"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// header carrying the ID of a request, it is taken from the request when the caller sends one and always sent back
+const HeaderRequestID = "X-Request-ID"
+
+// the longest request ID taken from a caller, a longer one is replaced
+const maxRequestIDLength = 128
+
+// function to build the middleware logging every request of the app, it has to be registered with app.Use before the routes
+// the request gets its ID before anything else runs, the ID is handed to the handlers through c.UserContext
+// the line is written once the request is over, with the template of its route, its status, its latency
+// and the user making it (read from userHeader), the errors are logged with their real status
+func Middleware(logger *slog.Logger, userHeader string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		id := c.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		} else {
+			// the ID is copied since fiber reuses its memory once the request is over, and the context may outlive it
+			id = utils.CopyString(id)
+		}
+		c.Set(HeaderRequestID, id)
+
+		c.SetUserContext(WithRequestID(c.UserContext(), id))
+		outcome, err := middleware.Next(c)
+		if err != nil {
+			return err
+		}
+
+		level := slog.LevelInfo
+		if outcome.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// the context set by the handlers is used, so that the line carries the trace of the request too
+		logger.LogAttrs(c.UserContext(), level, "request",
+			slog.String("method", c.Method()),
+			slog.String("route", outcome.Route),
+			slog.String("path", c.Path()),
+			slog.Int("status", outcome.Status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("user", c.Get(userHeader)),
+		)
+
+		return nil
+	}
+}
+
+// function to tell whether the ID sent by a caller can be used, it has to be short and made of printable characters
+// so that it cannot break the log lines or the headers it is copied into
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// function to generate the ID of a request which came without one
+func newRequestID() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(raw)
+}
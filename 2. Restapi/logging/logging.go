@@ -0,0 +1,64 @@
+// Package logging writes the logs of the api as JSON lines, one object per line
+// A log line written with the context of a request (slog.InfoContext, ...) carries the ID of the request and its trace,
+// so that every line written while handling it can be found from the X-Request-ID header of the response
+// The personal data of the students is redacted, see models.IsRedacted
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"my-rest-api/models"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// key under which the ID of a request is stored in its context
+type requestIDKey struct{}
+
+// function to attach the ID of a request to a context, the log lines written with it carry it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// function to read the ID of the request a context belongs to, it is empty outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// function to create a logger writing JSON lines from the given level on
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(contextHandler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact})})
+}
+
+// function to hide the attributes which are personal data, wherever they are logged
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if models.IsRedacted(attr.Key) {
+		return slog.String(attr.Key, models.Redacted)
+	}
+	return attr
+}
+
+// contextHandler adds what the context tells about the request to every log line
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"my-rest-api/models"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// function to read the JSON lines written by a logger
+func lines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var decoded []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("%q is not a JSON line: %v", line, err)
+		}
+		decoded = append(decoded, fields)
+	}
+	out.Reset()
+	return decoded
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, slog.LevelInfo)
+
+	app := fiber.New()
+	app.Use(Middleware(logger, "X-User"))
+	app.Get("/student/:userId", func(c *fiber.Ctx) error {
+		if c.Params("userId") == "broken" {
+			return errors.New("broken")
+		}
+
+		// the lines written while handling the request carry its ID
+		logger.InfoContext(c.UserContext(), "handling")
+		return c.SendString("ok")
+	})
+
+	// the ID of the caller is kept
+	req := httptest.NewRequest("GET", "/student/1", nil)
+	req.Header.Set(HeaderRequestID, "abc-123")
+	req.Header.Set("X-User", "ada")
+	resp, _ := app.Test(req)
+	assert.Equal(t, "abc-123", resp.Header.Get(HeaderRequestID))
+
+	logged := lines(t, &out)
+	if assert.Len(t, logged, 2) {
+		assert.Equal(t, "handling", logged[0]["msg"])
+		assert.Equal(t, "abc-123", logged[0]["request_id"])
+
+		assert.Equal(t, "request", logged[1]["msg"])
+		assert.Equal(t, "INFO", logged[1]["level"])
+		assert.Equal(t, "abc-123", logged[1]["request_id"])
+		assert.Equal(t, "GET", logged[1]["method"])
+		assert.Equal(t, "/student/:userId", logged[1]["route"])
+		assert.Equal(t, "/student/1", logged[1]["path"])
+		assert.Equal(t, float64(200), logged[1]["status"])
+		assert.Equal(t, "ada", logged[1]["user"])
+		assert.Contains(t, logged[1], "latency_ms")
+	}
+
+	// an ID is generated for the requests which come without one, or with one which cannot be used
+	for _, sent := range []string{"", "two words", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest("GET", "/student/broken", nil)
+		if sent != "" {
+			req.Header.Set(HeaderRequestID, sent)
+		}
+		resp, _ := app.Test(req)
+
+		id := resp.Header.Get(HeaderRequestID)
+		assert.Len(t, id, 32)
+		assert.NotEqual(t, sent, id)
+
+		logged := lines(t, &out)
+		if assert.Len(t, logged, 1) {
+			assert.Equal(t, id, logged[0]["request_id"])
+			assert.Equal(t, "ERROR", logged[0]["level"], "the failures of the server are errors")
+			assert.Equal(t, float64(500), logged[0]["status"])
+		}
+	}
+
+	app.Test(httptest.NewRequest("GET", "/nowhere", nil))
+	if logged := lines(t, &out); assert.Len(t, logged, 1) {
+		assert.Equal(t, "unmatched", logged[0]["route"])
+		assert.Equal(t, float64(404), logged[0]["status"])
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, slog.LevelInfo)
+
+	dob, _ := models.ParseDate("2001-02-03")
+	student := models.Student{ID: primitive.NewObjectID(), Name: "Ada", DOB: dob, Address: "12 Analytical Street", CreatedAt: time.Now()}
+
+	logger.Info("student", "student", student, "address", "12 Analytical Street")
+	logger.Debug("below the level")
+
+	assert.NotContains(t, out.String(), "Analytical")
+	assert.NotContains(t, out.String(), "2001-02-03")
+
+	logged := lines(t, &out)
+	if assert.Len(t, logged, 1) {
+		assert.Equal(t, models.Redacted, logged[0]["address"])
+
+		fields := logged[0]["student"].(map[string]interface{})
+		assert.Equal(t, "Ada", fields["name"])
+		assert.Equal(t, student.ID.Hex(), fields["_id"])
+		assert.Equal(t, models.Redacted, fields["dob"])
+		assert.Equal(t, models.Redacted, fields["address"])
+	}
+}
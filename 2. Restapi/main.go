@@ -1,22 +1,131 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"my-rest-api/cache"
 	"my-rest-api/configs"
-	"my-rest-api/routes"
+	"my-rest-api/lifecycle"
+	"my-rest-api/logging"
+	"my-rest-api/metrics"
+	"my-rest-api/repository"
+	"my-rest-api/server"
+	"my-rest-api/tracing"
+	"os"
+	"time"
 
-	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 func main() {
-	// creating a fiber app
-	app := fiber.New()
+	// loading the startup configuration out of the defaults, the config file, the environment and the flags
+	commandLine, err := configs.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg, args := commandLine.Config, commandLine.Args
 
-	// connecting to the db
-	configs.ConnectDB()
+	if commandLine.PrintConfig {
+		if err := configs.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// connecting the routes
-	routes.UserRoute(app)
+	// everything is logged as JSON lines from here on, the lines of the log package included
+	slog.SetDefault(logging.New(os.Stdout, cfg.Level()))
 
-	// listening on port 6000
-	app.Listen(":6000")
+	// installing the exporter of the traces before anything makes spans
+	tracingHook, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// connecting to the db, this is the only place where connections are opened
+	// the commands and the connection pool are measured for the /metrics endpoint, and the commands are traced
+	monitor := configs.CommandMonitors(metrics.CommandMonitor(), tracing.CommandMonitor())
+	client, err := configs.ConnectDB(cfg.MongoURI, cfg.Timeouts.Connect, options.Client().SetMonitor(monitor).SetPoolMonitor(metrics.PoolMonitor()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the migration commands run and exit instead of serving the api
+	// "migrate up|down|status" manages the schema migrations, "migrate-dates [-dry-run]" reports on the dates stored as strings
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			defer client.Disconnect(context.Background())
+			migrate(client, cfg, args[1:])
+			return
+		case "migrate-dates":
+			defer client.Disconnect(context.Background())
+			migrateDates(client, cfg, args[1:])
+			return
+		default:
+			log.Fatalf("unknown command %q, expected migrate or migrate-dates", args[0])
+		}
+	}
+
+	// bringing the database up to date before anything reads from it
+	if cfg.MigrateOnStartup {
+		migrateUp(client, cfg)
+	}
+
+	// building the student storage on top of the collection
+	students := repository.NewMongoStudentRepository(configs.GetCollection(client, cfg.Database, "students"))
+
+	// the audit log of the changes made to the students lives in its own collection
+	audit := repository.NewMongoAuditRepository(configs.GetCollection(client, cfg.Database, "audit"))
+
+	// creating the full-text index used by the search endpoint and the index of the audit log
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := students.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := audit.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	// the subsystems are started in order and stopped the other way around on SIGINT or SIGTERM,
+	// so the database client is closed once the apis have drained their requests,
+	// and the spans still buffered are flushed at the very end, once nothing makes new ones
+	lc := lifecycle.New()
+	lc.Append(tracingHook)
+	lc.Append(lifecycle.Hook{Name: "mongodb", OnStop: client.Disconnect})
+
+	// the students read by ID are cached in the configured backend
+	studentCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if redisCache, ok := studentCache.(*cache.Redis); ok {
+		lc.Append(lifecycle.Hook{Name: "redis", OnStop: redisCache.Close})
+	}
+
+	// wiring the app together and listening on the configured ports
+	srv, err := server.NewServer(cfg, students, audit, studentCache)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.Register(lc)
+
+	// the api is only ready while it can reach the database
+	srv.Health.Readiness.Register("mongodb", func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	})
+
+	// the startup is over once every subsystem is started, this hook has to stay the last one
+	lc.Append(srv.Health.Started(lc, cfg.Timeouts.Drain))
+
+	if err := lc.Run(context.Background(), cfg.Timeouts.Shutdown); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -1,16 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"my-rest-api/cache"
+	"my-rest-api/configs"
 	"my-rest-api/controllers"
+	"my-rest-api/health"
+	"my-rest-api/lifecycle"
+	"my-rest-api/models"
+	"my-rest-api/repository"
+	"my-rest-api/responses"
+	"my-rest-api/routes"
+	"my-rest-api/server"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // This file consists of a series of tests in which every end point of the api is checked with various test cases
@@ -19,6 +49,81 @@ import (
 // global variable to store the objectId when a new user is created
 var objId string
 
+// the tests share one app backed by an in-memory store so that they do not need a running MongoDB
+var app = newTestApp()
+
+// function to build an app on top of empty in-memory stores
+// the responses are checked against the OpenAPI document, a response which is not documented fails with a 500
+func newTestApp() *fiber.App {
+	cfg := configs.Default()
+	cfg.ValidateResponses = true
+
+	// without retention everything in the trash can be purged right away
+	cfg.TrashRetention = 0
+
+	return mustNewServer(cfg, repository.NewMemoryStudentRepository(), repository.NewMemoryAuditRepository(), cache.NewLRU(cfg.Cache.Size, cfg.Cache.TTL)).App
+}
+
+// function to build a server for a test, the apps shared by the tests are built before any of them runs
+// so a mistake in the schema or in the document stops all of them
+func mustNewServer(cfg configs.Config, students repository.StudentRepository, audit repository.AuditRepository, studentCache cache.Cache) *server.Server {
+	srv, err := server.NewServer(cfg, students, audit, studentCache)
+	if err != nil {
+		panic(err)
+	}
+	return srv
+}
+
+// testClient sends the requests of a test, either to an app or to a server listening on base
+type testClient struct {
+	t    *testing.T
+	ctx  context.Context
+	base string
+	do   func(req *http.Request) (*http.Response, error)
+}
+
+// function to send the requests of a test to an app
+func appClient(t *testing.T, app *fiber.App) *testClient {
+	return &testClient{t: t, ctx: context.Background(), base: "http://example.com", do: func(req *http.Request) (*http.Response, error) {
+		return app.Test(req)
+	}}
+}
+
+// function to send the requests of a test to a running server, they are canceled along with ctx
+func serverClient(t *testing.T, ctx context.Context, base string) *testClient {
+	return &testClient{t: t, ctx: ctx, base: base, do: http.DefaultClient.Do}
+}
+
+// function to send a request, the body is sent as JSON unless the headers (pairs of name and value) say otherwise
+func (c *testClient) send(method string, route string, body string, headers ...string) *http.Response {
+	req, err := http.NewRequestWithContext(c.ctx, method, c.base+route, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// function to send a request and read the problem out of the response, it is empty when the response is not a problem
+func (c *testClient) problem(method string, route string, body string, headers ...string) (*http.Response, responses.Problem) {
+	resp := c.send(method, route, body, headers...)
+
+	var problem responses.Problem
+	if resp.Header.Get("Content-Type") == responses.ProblemContentType {
+		json.NewDecoder(resp.Body).Decode(&problem)
+	}
+	return resp, problem
+}
+
 func TestGetAllStudents(t *testing.T) {
 	tests := []struct {
 		description  string // description of the test case
@@ -40,10 +145,6 @@ func TestGetAllStudents(t *testing.T) {
 		},
 	}
 
-	app := fiber.New()
-
-	app.Get("/students", controllers.GetAllStudents)
-
 	for _, test := range tests {
 		// Create a new http request with the route from the test case
 		req := httptest.NewRequest(test.method, test.route, nil)
@@ -70,21 +171,39 @@ func TestCreateStudent(t *testing.T) {
 			description:  "get HTTP status 201",
 			method:       "POST",
 			route:        "/student",
-			jsonStr:      []byte(`{"name":"Spiderman","dob":"69 Dec 2002","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			jsonStr:      []byte(`{"name":"Spiderman","dob":"2002-12-09","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
 			expectedCode: 201,
 		},
 		{
 			description:  "get HTTP status 400, when invalid parameters given",
 			method:       "POST",
 			route:        "/student",
-			jsonStr:      []byte(`{"name":"Spiderman","dob":"69 Dec 2002","percentage": "99.99","address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			jsonStr:      []byte(`{"name":"Spiderman","dob":"2002-12-09","percentage": "99.99","address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when the dob is not a real date",
+			method:       "POST",
+			route:        "/student",
+			jsonStr:      []byte(`{"name":"Spiderman","dob":"2002-02-30","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when the dob is written the old way",
+			method:       "POST",
+			route:        "/student",
+			jsonStr:      []byte(`{"name":"Spiderman","dob":"69 Dec 2002","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when the dob is in the future",
+			method:       "POST",
+			route:        "/student",
+			jsonStr:      []byte(`{"name":"Spiderman","dob":"2999-01-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
 			expectedCode: 400,
 		},
 	}
 
-	app := fiber.New()
-	app.Post("/student", controllers.CreateStudent)
-
 	for i, test := range tests {
 		req := httptest.NewRequest(test.method, test.route, bytes.NewBuffer(test.jsonStr))
 		req.Header.Set("Content-Type", "application/json")
@@ -116,16 +235,13 @@ func TestGetStudent(t *testing.T) {
 			expectedCode: 200,
 		},
 		{
-			description:  "get HTTP status 500, when invalid object id specified",
+			description:  "get HTTP status 400, when invalid object id specified",
 			method:       "GET",
 			route:        "/student/ksdflj45ljk",
-			expectedCode: 500,
+			expectedCode: 400,
 		},
 	}
 
-	app := fiber.New()
-	app.Get("/student/:userId", controllers.GetAStudent)
-
 	for i, test := range tests {
 		var completeRoute string
 		if i == 0 {
@@ -155,28 +271,25 @@ func TestEditStudent(t *testing.T) {
 			description:  "get HTTP status 201",
 			method:       "PUT",
 			route:        "/student/",
-			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"61 Dec 2002","percentage": 99.88,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"2002-12-06","percentage": 99.88,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
 			expectedCode: 200,
 		},
 		{
 			description:  "get HTTP status 400, when invalid parameters given",
 			method:       "PUT",
 			route:        "/student/",
-			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"69 Dec 2002","percentage": 99.99,"addddress":"8194 NowayhomeCity","description":"Go Developer"}`),
+			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"2002-12-09","percentage": 99.99,"addddress":"8194 NowayhomeCity","description":"Go Developer"}`),
 			expectedCode: 400,
 		},
 		{
 			description:  "get HTTP status 400, when invalid userId given",
 			method:       "PUT",
 			route:        "/student/3bfdjn3f",
-			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"69 Dec 2002","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
-			expectedCode: 404,
+			jsonStr:      []byte(`{"name":"Spiderman XD","dob":"2002-12-09","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`),
+			expectedCode: 400,
 		},
 	}
 
-	app := fiber.New()
-	app.Put("/student/:userId", controllers.EditAStudent)
-
 	for i, test := range tests {
 		var completeRoute string
 		if i == 2 {
@@ -207,16 +320,13 @@ func TestDeleteStudent(t *testing.T) {
 			expectedCode: 200,
 		},
 		{
-			description:  "get HTTP status 404, when invalid object id specified",
+			description:  "get HTTP status 400, when invalid object id specified",
 			method:       "DELETE",
 			route:        "/student/ksdflj45ljk",
-			expectedCode: 404,
+			expectedCode: 400,
 		},
 	}
 
-	app := fiber.New()
-	app.Delete("/student/:userId", controllers.DeleteAStudent)
-
 	for i, test := range tests {
 		var completeRoute string
 		if i == 0 {
@@ -232,3 +342,1038 @@ func TestDeleteStudent(t *testing.T) {
 		assert.Equalf(t, test.expectedCode, resp.StatusCode, test.description)
 	}
 }
+
+// This test uses its own store, it walks through the students page by page using the cursor
+// and checks the different ways of filtering them
+func TestListStudentsQuery(t *testing.T) {
+	listApp := newTestApp()
+
+	for i, name := range []string{"Ada", "Bob", "Cid", "Dan", "Eve"} {
+		jsonStr := fmt.Sprintf(`{"name":"%s","dob":"%d-01-01","percentage": %d,"address":"Paris","description":"Go Developer"}`, name, 2000+i, 70+5*i)
+		req := httptest.NewRequest("POST", "/student", bytes.NewBufferString(jsonStr))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := listApp.Test(req)
+		assert.Equal(t, 201, resp.StatusCode)
+	}
+
+	// helper to fetch a page and return the names in it along with the next cursor
+	fetch := func(route string) (int, []string, string) {
+		resp, _ := listApp.Test(httptest.NewRequest("GET", route, nil))
+
+		var result struct {
+			Data struct {
+				Data []struct {
+					Name string `json:"name"`
+				} `json:"data"`
+				Pagination struct {
+					NextCursor string `json:"nextCursor"`
+				} `json:"pagination"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		var names []string
+		for _, student := range result.Data.Data {
+			names = append(names, student.Name)
+		}
+		return resp.StatusCode, names, result.Data.Pagination.NextCursor
+	}
+
+	code, names, next := fetch("/students?limit=2&sort=-percentage&percentage_gte=75")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Eve", "Dan"}, names)
+
+	firstCursor := next
+	code, names, next = fetch("/students?limit=2&sort=-percentage&percentage_gte=75&cursor=" + next)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Cid", "Bob"}, names)
+	assert.Equal(t, "", next, "no cursor is returned on the last page")
+
+	code, names, _ = fetch("/students?address=Paris&name_ne=Ada&sort=name&limit=1")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Bob"}, names)
+
+	code, names, _ = fetch("/students?sort=name&filter=" + url.QueryEscape(`percentage >= 80 and (name ~ "d*" or name = "Eve")`))
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Dan", "Eve"}, names)
+
+	code, names, next = fetch("/students?limit=2&sort=-dob&dob_lt=2004-01-01")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Dan", "Cid"}, names)
+
+	code, names, _ = fetch("/students?limit=2&sort=-dob&dob_lt=2004-01-01&cursor=" + next)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Bob", "Ada"}, names, "paging through students sorted by date")
+
+	code, names, _ = fetch("/students?sort=name&filter=" + url.QueryEscape(`dob >= "2003-01-01"`))
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"Dan", "Eve"}, names)
+
+	code, _, _ = fetch("/students?dob_gt=yesterday")
+	assert.Equal(t, 400, code, "a date filter with a text value")
+
+	code, _, _ = fetch("/students?filter=" + url.QueryEscape(`percentage >= "80"`))
+	assert.Equal(t, 400, code, "a filter expression with a type error")
+
+	code, _, _ = fetch("/students?sort=unknown")
+	assert.Equal(t, 400, code, "sorting on an unknown field")
+
+	code, _, _ = fetch("/students?percentage_gte=high")
+	assert.Equal(t, 400, code, "a number filter with a text value")
+
+	code, _, _ = fetch("/students?sort=name&cursor=" + firstCursor)
+	assert.Equal(t, 400, code, "a cursor created for another sort order")
+}
+
+// The percentage is stored as a float32, 99.99 is not a float64 the client could write
+// so the value it sends is rounded the same way before the students are compared with it
+func TestListStudentsByDecimalPercentage(t *testing.T) {
+	client := appClient(t, newTestApp())
+	for _, percentage := range []string{"99.99", "99.98"} {
+		resp := client.send("POST", "/student", `{"name":"Ada","dob":"2001-02-03","percentage": `+percentage+`,"address":"Paris","description":"Go Developer"}`)
+		assert.Equal(t, 201, resp.StatusCode)
+	}
+
+	for _, route := range []string{
+		"/students?percentage=99.99",
+		"/students?percentage_gte=99.99",
+		"/students?filter=" + url.QueryEscape("percentage = 99.99"),
+		"/students?filter=" + url.QueryEscape("percentage >= 99.99"),
+	} {
+		resp := client.send("GET", route, "")
+		assert.Equal(t, 200, resp.StatusCode, route)
+
+		var result struct {
+			Data struct {
+				Data []models.Student `json:"data"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if assert.Len(t, result.Data.Data, 1, route) {
+			assert.Equal(t, float32(99.99), result.Data.Data[0].Percentage, route)
+		}
+	}
+}
+
+// This test uses its own store, the best match comes first and carries highlighted snippets
+func TestSearchStudents(t *testing.T) {
+	searchApp := newTestApp()
+
+	for _, jsonStr := range []string{
+		`{"name":"Ada","dob":"2000-01-01","percentage": 90,"address":"Paris","description":"Go Developer"}`,
+		`{"name":"Bob","dob":"2000-01-01","percentage": 80,"address":"8194 Go Street","description":"Go developer living on <Go> street"}`,
+		`{"name":"Cid","dob":"2000-01-01","percentage": 70,"address":"London","description":"Rust Developer"}`,
+	} {
+		req := httptest.NewRequest("POST", "/student", bytes.NewBufferString(jsonStr))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := searchApp.Test(req)
+		assert.Equal(t, 201, resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Data []struct {
+				Student    struct{ Name string }
+				Highlights map[string]string
+			} `json:"data"`
+			Pagination struct {
+				NextCursor string `json:"nextCursor"`
+			} `json:"pagination"`
+		} `json:"data"`
+	}
+
+	resp, _ := searchApp.Test(httptest.NewRequest("GET", "/students/search?limit=1&q=go", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data.Data, 1) {
+		assert.Equal(t, "Bob", result.Data.Data[0].Student.Name, "the address weighs more than the description")
+		assert.Equal(t, "8194 <em>Go</em> Street", result.Data.Data[0].Highlights["address"])
+		assert.Equal(t, "<em>Go</em> developer living on &lt;<em>Go</em>&gt; street", result.Data.Data[0].Highlights["description"])
+	}
+
+	next := result.Data.Pagination.NextCursor
+	result.Data.Pagination.NextCursor = ""
+
+	resp, _ = searchApp.Test(httptest.NewRequest("GET", "/students/search?limit=1&q=go&cursor="+next, nil))
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&result)
+	if assert.Len(t, result.Data.Data, 1) {
+		assert.Equal(t, "Ada", result.Data.Data[0].Student.Name)
+	}
+	assert.Equal(t, "", result.Data.Pagination.NextCursor, "no cursor is returned on the last page")
+
+	resp, _ = searchApp.Test(httptest.NewRequest("GET", "/students/search", nil))
+	assert.Equal(t, 400, resp.StatusCode, "searching without a text")
+}
+
+// This test uses its own store, a student is patched with both kinds of patch documents
+func TestPatchStudent(t *testing.T) {
+	patchApp := newTestApp()
+
+	req := httptest.NewRequest("POST", "/student", bytes.NewBufferString(`{"name":"Spiderman","dob":"2002-12-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := patchApp.Test(req)
+
+	var created map[string]map[string]map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	route := "/student/" + created["data"]["data"]["InsertedID"]
+
+	tests := []struct {
+		description  string
+		contentType  string
+		jsonStr      string
+		expectedCode int
+		expectedName string
+	}{
+		{
+			description:  "get HTTP status 200, merge patch changes only the name",
+			contentType:  "application/merge-patch+json",
+			jsonStr:      `{"name":"Peter Parker"}`,
+			expectedCode: 200,
+			expectedName: "Peter Parker",
+		},
+		{
+			description:  "get HTTP status 200, json patch with a passing test operation",
+			contentType:  "application/json-patch+json",
+			jsonStr:      `[{"op":"test","path":"/name","value":"Peter Parker"},{"op":"replace","path":"/name","value":"Spidey"}]`,
+			expectedCode: 200,
+			expectedName: "Spidey",
+		},
+		{
+			description:  "get HTTP status 400, json patch with a failing test operation",
+			contentType:  "application/json-patch+json",
+			jsonStr:      `[{"op":"test","path":"/name","value":"Peter Parker"},{"op":"replace","path":"/name","value":"Miles"}]`,
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when the merged student is invalid",
+			contentType:  "application/merge-patch+json",
+			jsonStr:      `{"name":null}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when an unknown field is added",
+			contentType:  "application/merge-patch+json",
+			jsonStr:      `{"addddress":"Queens"}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 400, when a field managed by the server is changed",
+			contentType:  "application/merge-patch+json",
+			jsonStr:      `{"createdAt":"yesterday"}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "get HTTP status 415, when the body is plain json",
+			contentType:  "application/json",
+			jsonStr:      `{"name":"Miles"}`,
+			expectedCode: 415,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", route, bytes.NewBufferString(test.jsonStr))
+		req.Header.Set("Content-Type", test.contentType)
+
+		resp, _ := patchApp.Test(req)
+		assert.Equalf(t, test.expectedCode, resp.StatusCode, test.description)
+
+		if test.expectedCode == 200 {
+			var result map[string]map[string]map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&result)
+			assert.Equalf(t, test.expectedName, result["data"]["data"]["name"], test.description)
+			assert.Equalf(t, "8194 NowayhomeCity", result["data"]["data"]["address"], test.description)
+		}
+	}
+}
+
+// This test uses its own store, the ETag of a student is used for conditional reads and writes
+func TestConditionalRequests(t *testing.T) {
+	conditionalApp := newTestApp()
+
+	req := httptest.NewRequest("POST", "/student", bytes.NewBufferString(`{"name":"Spiderman","dob":"2002-12-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := conditionalApp.Test(req)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+
+	var created map[string]map[string]map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	route := "/student/" + created["data"]["data"]["InsertedID"]
+	body := `{"name":"Spiderman XD","dob":"2002-12-01","percentage": 99.88,"address":"8194 NowayhomeCity","description":"Go Developer"}`
+
+	tests := []struct {
+		description  string
+		method       string
+		header       string
+		value        string
+		expectedCode int
+		expectedETag string
+	}{
+		{description: "get HTTP status 200 with the ETag", method: "GET", expectedCode: 200, expectedETag: `"1"`},
+		{description: "get HTTP status 304, when the client has the current version", method: "GET", header: "If-None-Match", value: `"1"`, expectedCode: 304, expectedETag: `"1"`},
+		{description: "get HTTP status 200, when the client has another version", method: "GET", header: "If-None-Match", value: `"7", "8"`, expectedCode: 200, expectedETag: `"1"`},
+		{description: "get HTTP status 200, when updating the current version", method: "PUT", header: "If-Match", value: `"1"`, expectedCode: 200, expectedETag: `"2"`},
+		{description: "get HTTP status 412, when updating a stale version", method: "PUT", header: "If-Match", value: `"1"`, expectedCode: 412},
+		{description: "get HTTP status 412, when the ETag is weak", method: "PUT", header: "If-Match", value: `W/"2"`, expectedCode: 412},
+		{description: "get HTTP status 200, when any version is accepted", method: "PUT", header: "If-Match", value: `*`, expectedCode: 200, expectedETag: `"3"`},
+		{description: "get HTTP status 412, when patching a stale version", method: "PATCH", header: "If-Match", value: `"2"`, expectedCode: 412},
+		{description: "get HTTP status 200, when patching the current version", method: "PATCH", header: "If-Match", value: `"2", "3"`, expectedCode: 200, expectedETag: `"4"`},
+		{description: "get HTTP status 412, when deleting a stale version", method: "DELETE", header: "If-Match", value: `"3"`, expectedCode: 412},
+		{description: "get HTTP status 200, when deleting the current version", method: "DELETE", header: "If-Match", value: `"4"`, expectedCode: 200},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, route, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if test.method == "PATCH" {
+			req = httptest.NewRequest(test.method, route, bytes.NewBufferString(`{"percentage": 50}`))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+		}
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+
+		resp, _ := conditionalApp.Test(req)
+		assert.Equalf(t, test.expectedCode, resp.StatusCode, test.description)
+		if test.expectedETag != "" {
+			assert.Equalf(t, test.expectedETag, resp.Header.Get("ETag"), test.description)
+		}
+	}
+}
+
+// Two instances share the store and have their own cache, the preconditions are checked against the stored student
+// a student cached by one instance before the other changed it must neither be answered with a 304 nor make a write fail
+func TestConditionalRequestsAcrossInstances(t *testing.T) {
+	cfg := configs.Default()
+	cfg.ValidateResponses = true
+	students, audit := repository.NewMemoryStudentRepository(), repository.NewMemoryAuditRepository()
+	first := appClient(t, mustNewServer(cfg, students, audit, cache.NewLRU(cfg.Cache.Size, cfg.Cache.TTL)).App)
+	second := appClient(t, mustNewServer(cfg, students, audit, cache.NewLRU(cfg.Cache.Size, cfg.Cache.TTL)).App)
+
+	var created map[string]map[string]map[string]string
+	json.NewDecoder(first.send("POST", "/student", `{"name":"Ada","dob":"2001-02-03","percentage": 80,"address":"Paris","description":"Go Developer"}`).Body).Decode(&created)
+	route := "/student/" + created["data"]["data"]["InsertedID"]
+	body := `{"name":"Ada","dob":"2001-02-03","percentage": 90,"address":"Paris","description":"Go Developer"}`
+
+	// the second instance caches the version 1, then the first one writes the version 2
+	assert.Equal(t, 200, second.send("GET", route, "").StatusCode)
+	assert.Equal(t, `"2"`, first.send("PUT", route, body, "If-Match", `"1"`).Header.Get("ETag"))
+
+	resp := second.send("GET", route, "", "If-None-Match", `"1"`)
+	assert.Equal(t, 200, resp.StatusCode, "a client with the version 1 is sent the version 2")
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	resp = second.send("PUT", route, body, "If-Match", `"1", "2"`)
+	assert.Equal(t, 200, resp.StatusCode, "the stored version is one of the candidates")
+	assert.Equal(t, `"3"`, resp.Header.Get("ETag"))
+
+	// the first instance has not cached the student, the write through the second one left the store at the version 3
+	assert.Equal(t, 200, first.send("GET", route, "").StatusCode)
+	assert.Equal(t, 200, second.send("PUT", route, body, "If-Match", "*").StatusCode)
+	assert.Equal(t, 412, first.send("PUT", route, body, "If-Match", `"2", "3"`).StatusCode, "the version 3 is still cached by the first instance, but the version 4 is stored")
+}
+
+// This test uses its own store, a deleted student goes to the trash from where it is restored or purged
+func TestTrash(t *testing.T) {
+	trashApp := newTestApp()
+
+	var ids []string
+	for _, name := range []string{"Ada", "Bob"} {
+		req := httptest.NewRequest("POST", "/student", bytes.NewBufferString(`{"name":"`+name+`","dob":"2000-01-01","percentage": 90,"address":"Paris","description":"Go Developer"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := trashApp.Test(req)
+
+		var created map[string]map[string]map[string]string
+		json.NewDecoder(resp.Body).Decode(&created)
+		ids = append(ids, created["data"]["data"]["InsertedID"])
+	}
+
+	// helper to count the students of a list endpoint
+	count := func(route string) int {
+		resp, _ := trashApp.Test(httptest.NewRequest("GET", route, nil))
+
+		var result struct {
+			Data struct {
+				Data []interface{} `json:"data"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return len(result.Data.Data)
+	}
+
+	for _, id := range ids {
+		resp, _ := trashApp.Test(httptest.NewRequest("DELETE", "/student/"+id, nil))
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+
+	assert.Equal(t, 0, count("/students"), "deleted students are hidden from the list")
+	assert.Equal(t, 2, count("/students/trash"), "deleted students are listed in the trash")
+
+	resp, _ := trashApp.Test(httptest.NewRequest("GET", "/student/"+ids[0], nil))
+	assert.NotEqual(t, 200, resp.StatusCode, "a deleted student cannot be fetched")
+
+	resp, _ = trashApp.Test(httptest.NewRequest("POST", "/student/"+ids[0]+"/restore", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, _ = trashApp.Test(httptest.NewRequest("POST", "/student/"+ids[0]+"/restore", nil))
+	assert.Equal(t, 404, resp.StatusCode, "a student which is not in the trash cannot be restored")
+
+	resp, _ = trashApp.Test(httptest.NewRequest("GET", "/student/"+ids[0], nil))
+	assert.Equal(t, 200, resp.StatusCode, "a restored student can be fetched again")
+
+	// the tests run without retention, so everything in the trash is purged
+	resp, _ = trashApp.Test(httptest.NewRequest("DELETE", "/students/trash", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 0, count("/students/trash"))
+	assert.Equal(t, 1, count("/students"))
+
+	resp, _ = trashApp.Test(httptest.NewRequest("POST", "/student/"+ids[1]+"/restore", nil))
+	assert.Equal(t, 404, resp.StatusCode, "a purged student is gone for good")
+}
+
+// This test uses its own store, every change is recorded with who made it and can be rolled back
+func TestHistoryAndRevert(t *testing.T) {
+	client := appClient(t, newTestApp())
+
+	resp := client.send("POST", "/student", `{"name":"Spiderman","dob":"2002-12-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`, "X-User", "alice")
+	var created map[string]map[string]map[string]string
+	json.NewDecoder(resp.Body).Decode(&created)
+	route := "/student/" + created["data"]["data"]["InsertedID"]
+
+	resp = client.send("PUT", route, `{"name":"Spiderman XD","dob":"2002-12-01","percentage": 99.99,"address":"Queens","description":"Go Developer"}`, "X-User", "bob")
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp = client.send("POST", route+"/revert/1", "", "X-User", "carol")
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var reverted map[string]map[string]map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&reverted)
+	assert.Equal(t, "Spiderman", reverted["data"]["data"]["name"])
+	assert.Equal(t, "8194 NowayhomeCity", reverted["data"]["data"]["address"])
+	assert.Equal(t, 3.0, reverted["data"]["data"]["version"], "a revert is a new version")
+
+	resp = client.send("GET", route+"/history", "")
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var history struct {
+		Data struct {
+			Data []struct {
+				Version int64
+				Action  string
+				Actor   string
+				Changes []struct {
+					Field  string
+					Before interface{}
+					After  interface{}
+				}
+			} `json:"data"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&history)
+
+	entries := history.Data.Data
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, []int64{3, 2, 1}, []int64{entries[0].Version, entries[1].Version, entries[2].Version}, "the latest change comes first")
+		assert.Equal(t, []string{"revert", "update", "create"}, []string{entries[0].Action, entries[1].Action, entries[2].Action})
+		assert.Equal(t, []string{"carol", "bob", "alice"}, []string{entries[0].Actor, entries[1].Actor, entries[2].Actor})
+
+		if assert.Len(t, entries[1].Changes, 2) {
+			assert.Equal(t, "name", entries[1].Changes[0].Field)
+			assert.Equal(t, "Spiderman", entries[1].Changes[0].Before)
+			assert.Equal(t, "Spiderman XD", entries[1].Changes[0].After)
+			assert.Equal(t, "address", entries[1].Changes[1].Field)
+		}
+	}
+
+	resp = client.send("POST", route+"/revert/42", "")
+	assert.Equal(t, 404, resp.StatusCode, "reverting to a version which does not exist")
+
+	resp = client.send("POST", route+"/revert/latest", "")
+	assert.Equal(t, 400, resp.StatusCode, "reverting to a version which is not a number")
+
+	// the change of a delete is the deletion itself
+	resp = client.send("DELETE", route, "", "X-User", "dave")
+	assert.Equal(t, 200, resp.StatusCode)
+	resp = client.send("GET", route+"/history", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&history)
+	if entries := history.Data.Data; assert.Len(t, entries, 4) && assert.Len(t, entries[0].Changes, 1) {
+		assert.Equal(t, "deletedAt", entries[0].Changes[0].Field)
+		assert.Nil(t, entries[0].Changes[0].Before)
+		assert.NotNil(t, entries[0].Changes[0].After)
+	}
+
+	// the state left by the deletion is not written back as a live user, the restore is the way back
+	resp = client.send("POST", route+"/restore", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	resp, problem := client.problem("POST", route+"/revert/4", "")
+	assert.Equal(t, 400, resp.StatusCode, "reverting to a deletion")
+	assert.Contains(t, problem.Detail, "version 4")
+
+	resp = client.send("GET", "/student/"+primitive.NewObjectID().Hex()+"/history", "")
+	assert.Equal(t, 404, resp.StatusCode, "an unknown user has no history")
+
+	// a user stored before the audit log existed has an empty history
+	students := repository.NewMemoryStudentRepository()
+	dob, _ := models.ParseDate("2002-12-01")
+	existing, _ := students.Create(context.Background(), models.Student{Name: "Spiderman", DOB: dob, Percentage: 99.99, Address: "Queens", Description: "Go Developer"})
+	resp = appClient(t, mustNewServer(configs.Default(), students, repository.NewMemoryAuditRepository(), nil).App).send("GET", "/student/"+existing.ID.Hex()+"/history", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&history)
+	assert.Empty(t, history.Data.Data)
+}
+
+// This test checks that the errors are sent as application/problem+json with the failed rules listed field by field
+func TestProblemResponses(t *testing.T) {
+	client := appClient(t, newTestApp())
+
+	// the body is checked against the OpenAPI document before the rules of the model
+	resp, problem := client.problem("POST", "/student", `{"dob":"2999-01-01","address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, responses.ProblemContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "/problems/validation", problem.Type)
+	assert.Equal(t, 400, problem.Status)
+	assert.Equal(t, "/student", problem.Instance)
+	assert.ElementsMatch(t, []responses.FieldError{
+		{Field: "name", Rule: "required", Message: "is required"},
+		{Field: "percentage", Rule: "required", Message: "is required"},
+	}, problem.Errors)
+
+	resp, problem = client.problem("POST", "/student", `{"name":"Spiderman","dob":"2999-01-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "/problems/validation", problem.Type)
+	assert.Equal(t, []responses.FieldError{
+		{Field: "dob", Rule: "past", Message: "must be a date in the past, no earlier than 1900-01-01"},
+	}, problem.Errors)
+
+	resp, problem = client.problem("POST", "/student", `{"name":"Spiderman","dob":"2002-12-09","percentage": "99.99","address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 400, resp.StatusCode)
+	if assert.Len(t, problem.Errors, 1, "a value of the wrong type is reported on its field") {
+		assert.Equal(t, "percentage", problem.Errors[0].Field)
+		assert.Equal(t, "type", problem.Errors[0].Rule)
+	}
+
+	resp, problem = client.problem("GET", "/student/"+primitive.NewObjectID().Hex(), "")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "/problems/not-found", problem.Type)
+
+	resp, problem = client.problem("GET", "/students?filter="+url.QueryEscape(`percentage >= "80"`), "")
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "/problems/bad-request", problem.Type)
+	assert.Equal(t, 15, problem.Position, "the position of the mistake in the filter")
+	assert.Equal(t, `percentage >= "80"`, problem.Filter)
+
+	resp, problem = client.problem("GET", "/not-found", "")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, responses.ProblemContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "about:blank", problem.Type, "the errors of fiber itself only carry their status")
+}
+
+// This test checks the identifiers accepted in the routes, a malformed one never reaches the handlers
+func TestStudentIdentifiers(t *testing.T) {
+	client := appClient(t, newTestApp())
+
+	resp := client.send("POST", "/student", `{"rollNumber":"A42","name":"Spiderman","dob":"2002-12-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	resp, problem := client.problem("POST", "/student", `{"rollNumber":"A42","name":"Venom","dob":"2002-12-01","percentage": 50,"address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 409, resp.StatusCode, "the roll numbers are unique")
+	assert.Equal(t, "/problems/conflict", problem.Type)
+
+	resp = client.send("GET", "/student/roll:A42", "")
+	assert.Equal(t, 200, resp.StatusCode, "a student can be found by roll number")
+
+	resp = client.send("PUT", "/student/roll:A42", `{"rollNumber":"A42","name":"Spiderman XD","dob":"2002-12-01","percentage": 99.99,"address":"Queens","description":"Go Developer"}`)
+	assert.Equal(t, 200, resp.StatusCode, "a student can be updated by roll number")
+
+	resp, problem = client.problem("GET", "/student/roll:B7", "")
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "/problems/not-found", problem.Type)
+
+	for _, route := range []string{"/student/ksdflj45ljk", "/student/grade:1", "/student/roll:", "/student/ksdflj45ljk/history", "/student/ksdflj45ljk/revert/1"} {
+		method := "GET"
+		if strings.HasSuffix(route, "/revert/1") {
+			method = "POST"
+		}
+
+		resp, problem = client.problem(method, route, "")
+		assert.Equalf(t, 400, resp.StatusCode, "%s %s", method, route)
+		assert.Equalf(t, "/problems/invalid-id", problem.Type, "%s %s", method, route)
+	}
+
+	resp = client.send("DELETE", "/student/ksdflj45ljk", "")
+	assert.Equal(t, 400, resp.StatusCode, "nothing is deleted when the ID is malformed")
+
+	// a deleted student is only found by roll number to be restored
+	resp = client.send("DELETE", "/student/roll:A42", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	resp = client.send("GET", "/student/roll:A42", "")
+	assert.Equal(t, 404, resp.StatusCode)
+	resp = client.send("POST", "/student/roll:A42/restore", "")
+	assert.Equal(t, 200, resp.StatusCode, "a deleted student is restored by roll number")
+	resp = client.send("POST", "/student/roll:A42/restore", "")
+	assert.Equal(t, 404, resp.StatusCode, "a student which is not deleted is not in the trash")
+}
+
+// set to write the OpenAPI document generated from the routes into routes/openapi.json, once its changes are intended:
+// go test -run TestOpenAPIDocument -update-spec
+var updateSpec = flag.Bool("update-spec", false, "write the generated OpenAPI document into routes/openapi.json")
+
+// This test fails when the documentation of the routes and the committed OpenAPI document drift apart,
+// or when the routes registered in the app and the committed document do
+func TestOpenAPIDocument(t *testing.T) {
+	generated, err := json.MarshalIndent(routes.GenerateSpec(), "", "  ")
+	if !assert.NoError(t, err) {
+		return
+	}
+	generated = append(generated, '\n')
+
+	if *updateSpec {
+		if err := os.WriteFile("routes/openapi.json", generated, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	committed, err := os.ReadFile("routes/openapi.json")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the first line which differs is enough to find the change, the documents are thousands of lines long
+	committedLines, generatedLines := strings.Split(string(committed), "\n"), strings.Split(string(generated), "\n")
+	for i := 0; i < len(committedLines) || i < len(generatedLines); i++ {
+		var was, is string
+		if i < len(committedLines) {
+			was = committedLines[i]
+		}
+		if i < len(generatedLines) {
+			is = generatedLines[i]
+		}
+		if was != is {
+			t.Errorf("the documentation of the routes changed at line %d of routes/openapi.json:\n  committed: %s\n  generated: %s\nreview the changes and commit them with -update-spec", i+1, was, is)
+			break
+		}
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, json.Unmarshal(body, &spec))
+	assert.Equal(t, "3.1.0", spec.OpenAPI)
+
+	// every route of the app is documented, with its path params
+	registered := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		// HEAD is added by fiber along with every GET
+		if route.Method == "HEAD" {
+			continue
+		}
+
+		path := route.Path
+		for _, param := range route.Params {
+			path = strings.Replace(path, ":"+param, "{"+param+"}", 1)
+		}
+		operation := route.Method + " " + path
+		registered[operation] = true
+
+		documented, ok := spec.Paths[path][strings.ToLower(route.Method)]
+		if !assert.Truef(t, ok, "%s is not documented", operation) {
+			continue
+		}
+
+		var pathParams []string
+		for _, param := range documented.Parameters {
+			if param.In == "path" {
+				pathParams = append(pathParams, param.Name)
+			}
+		}
+		assert.ElementsMatchf(t, route.Params, pathParams, "path params of %s", operation)
+	}
+
+	// and nothing else is
+	operationIDs := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method, operation := range item {
+			assert.Truef(t, registered[strings.ToUpper(method)+" "+path], "%s %s is documented but not registered", strings.ToUpper(method), path)
+			assert.Falsef(t, operationIDs[operation.OperationID], "operationId %s is used twice", operation.OperationID)
+			operationIDs[operation.OperationID] = true
+		}
+	}
+
+	// every schema which is referenced exists
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(body), -1) {
+		assert.Containsf(t, spec.Components.Schemas, ref[1], "schema %s is referenced but not defined", ref[1])
+	}
+
+	// the rules of the student are taken from its validate tags
+	var input struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Validate string `json:"x-validate"`
+		} `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(spec.Components.Schemas["StudentInput"], &input))
+	assert.ElementsMatch(t, []string{"name", "dob", "percentage", "address", "description"}, input.Required)
+	assert.NotContains(t, input.Properties, "createdAt", "createdAt is set by the server")
+	assert.Equal(t, "required,past", input.Properties["dob"].Validate)
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	page, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(page), `fetch("/openapi.json")`)
+}
+
+// This test checks that the requests which do not follow the OpenAPI document are rejected before reaching the handlers
+func TestOpenAPIValidation(t *testing.T) {
+	client := appClient(t, newTestApp())
+
+	resp, problem := client.problem("GET", "/students?limit=0", "")
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "/problems/validation", problem.Type)
+	assert.Equal(t, []responses.FieldError{{Field: "limit", Rule: "minimum", Param: "1", Message: "must be at least 1"}}, problem.Errors)
+
+	resp, problem = client.problem("GET", "/students/search", "")
+	assert.Equal(t, 400, resp.StatusCode, "the search needs words")
+	assert.Equal(t, []responses.FieldError{{Field: "q", Rule: "required", Message: "is required"}}, problem.Errors)
+
+	resp, problem = client.problem("POST", "/student", `{"rollNumber":"A-42","name":"Spiderman","dob":"2002-13-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.ElementsMatch(t, []string{"rollNumber pattern", "dob format"}, []string{problem.Errors[0].Field + " " + problem.Errors[0].Rule, problem.Errors[1].Field + " " + problem.Errors[1].Rule})
+
+	resp, problem = client.problem("POST", "/student", `{"name":"Spiderman"}`, "Content-Type", "text/plain")
+	assert.Equal(t, 415, resp.StatusCode)
+	assert.Equal(t, "/problems/unsupported-media-type", problem.Type)
+
+	resp, problem = client.problem("POST", "/student", `{"name":`)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, "/problems/bad-request", problem.Type)
+
+	resp = client.send("POST", "/student", `{"rollNumber":"A42","name":"Spiderman","dob":"2002-12-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`)
+	assert.Equal(t, 201, resp.StatusCode)
+
+	resp = client.send("PATCH", "/student/roll:A42", `{"rollNumber":null}`, "Content-Type", "application/merge-patch+json")
+	assert.Equal(t, 200, resp.StatusCode, "null removes an attribute in a merge patch")
+
+	resp, problem = client.problem("POST", "/student/"+primitive.NewObjectID().Hex()+"/revert/0", "")
+	assert.Equal(t, 400, resp.StatusCode, "the versions start at 1")
+	assert.Equal(t, "/problems/invalid-id", problem.Type)
+}
+
+// This test goes through the GraphQL endpoint, the changes made through it are validated and audited like the REST ones
+func TestGraphQL(t *testing.T) {
+	client := appClient(t, newTestApp())
+
+	send := func(query string, variables map[string]interface{}) (int, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+		resp := client.send("POST", "/graphql", string(body), "X-User", "frontend")
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	code, result := send(`mutation($input: StudentInput!) { createStudent(input: $input) { id name } }`, map[string]interface{}{
+		"input": map[string]interface{}{"name": "Spiderman", "dob": "2002-12-01", "percentage": 99.99, "address": "8194 NowayhomeCity", "description": "Go Developer"},
+	})
+	assert.Equal(t, 200, code)
+	assert.Nil(t, result["errors"])
+	id := result["data"].(map[string]interface{})["createStudent"].(map[string]interface{})["id"].(string)
+
+	// the student created through GraphQL is the same as a REST one
+	resp := client.send("GET", "/student/"+id+"/history", "")
+	var history struct {
+		Data struct {
+			Data []models.AuditEntry `json:"data"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&history)
+	if assert.Len(t, history.Data.Data, 1) {
+		assert.Equal(t, "frontend", history.Data.Data[0].Actor)
+	}
+
+	code, result = send(`query($id: ID!) { student(id: $id) { name dob percentage } }`, map[string]interface{}{"id": id})
+	assert.Equal(t, 200, code)
+	assert.Equal(t, map[string]interface{}{"name": "Spiderman", "dob": "2002-12-01", "percentage": 99.99}, result["data"].(map[string]interface{})["student"])
+
+	code, result = send(`{ students(limit: 500) { count } }`, nil)
+	assert.Equal(t, 200, code, "the errors of a GraphQL request are in its result")
+	assert.NotEmpty(t, result["errors"])
+
+	resp = client.send("POST", "/graphql", `{"variables":{}}`)
+	assert.Equal(t, 400, resp.StatusCode, "the query is required")
+}
+
+// This test uses its own server, the probes report on every check and answer 503 when one of them fails
+func TestProbes(t *testing.T) {
+	cfg := configs.Default()
+	cfg.ValidateResponses = true
+	srv := mustNewServer(cfg, repository.NewMemoryStudentRepository(), repository.NewMemoryAuditRepository(), nil)
+
+	probe := func(route string) (int, health.Report) {
+		resp, _ := srv.App.Test(httptest.NewRequest("GET", route, nil))
+
+		var report health.Report
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+
+	code, report := probe("/healthz")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, health.StatusPass, report.Status)
+
+	// the startup is over once every hook of the lifecycle is started
+	lc := lifecycle.New()
+	lc.Append(srv.Health.Started(lc, 0))
+
+	code, report = probe("/startupz")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, health.ErrStarting.Error(), report.Checks["lifecycle"].Error)
+
+	assert.NoError(t, lc.Start(context.Background()))
+	code, _ = probe("/startupz")
+	assert.Equal(t, 200, code)
+
+	srv.Health.Readiness.Register("mongodb", func(ctx context.Context) error { return nil })
+	code, report = probe("/readyz")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"lifecycle", "mongodb"}, sortedKeys(report.Checks))
+
+	srv.Health.Readiness.Register("mongodb", func(ctx context.Context) error { return errors.New("server selection timeout") })
+	code, report = probe("/readyz")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, health.StatusFail, report.Checks["mongodb"].Status)
+	assert.Equal(t, health.StatusPass, report.Checks["lifecycle"].Status)
+
+	// the api is not ready anymore as soon as it starts stopping, while it is still alive
+	srv.Health.Readiness.Register("mongodb", func(ctx context.Context) error { return nil })
+	assert.NoError(t, lc.Stop(context.Background()))
+	code, report = probe("/readyz")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, health.ErrStopping.Error(), report.Checks["lifecycle"].Error)
+
+	code, _ = probe("/healthz")
+	assert.Equal(t, 200, code)
+}
+
+func sortedKeys(checks map[string]health.ComponentReport) []string {
+	keys := make([]string, 0, len(checks))
+	for key := range checks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The metrics are labelled with the route templates of the api
+func TestMetrics(t *testing.T) {
+	app.Test(httptest.NewRequest("GET", "/student/"+primitive.NewObjectID().Hex(), nil))
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `student_api_http_requests_total{method="GET",route="/student/:userId",status="404"}`)
+
+	// the unknown paths share one series, next to the tracing middleware
+	app.Test(httptest.NewRequest("GET", "/nowhere", nil))
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `student_api_http_requests_total{method="GET",route="unmatched",status="404"}`)
+}
+
+func TestRequestID(t *testing.T) {
+	// the ID sent by the caller is sent back, the others get one
+	req := httptest.NewRequest("GET", "/students", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	resp, _ := app.Test(req)
+	assert.Equal(t, "req-42", resp.Header.Get("X-Request-ID"))
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/nowhere", nil))
+	assert.Regexp(t, "^[0-9a-f]{32}$", resp.Header.Get("X-Request-ID"))
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	req := httptest.NewRequest("POST", "/student", strings.NewReader(`{"name":"Spiderman","dob":"2999-01-01","percentage": 99.99,"address":"8194 NowayhomeCity","description":"Go Developer"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, _ := app.Test(req)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	// the request continues the trace of the caller, and the validation of the body is a span within it
+	request, validation := spans["POST /student"], spans["validate student"]
+	if assert.NotNil(t, request) && assert.NotNil(t, validation) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+		assert.Equal(t, request.SpanContext().SpanID(), validation.Parent().SpanID())
+		assert.Equal(t, codes.Error, validation.Status().Code)
+		assert.Equal(t, codes.Unset, request.Status().Code, "a mistake of the client is not a failure of the server")
+	}
+}
+
+// function to find an address nobody listens on, for the tests which start the whole lifecycle
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// a Server-Sent Event, the data is an audit entry
+type serverSentEvent struct {
+	ID    string
+	Name  string
+	Entry models.AuditEntry
+}
+
+// function to read the next event of a stream, the messages which are not events (retry, comments) are skipped
+func readEvent(r *bufio.Reader) (serverSentEvent, error) {
+	var event serverSentEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return event, err
+		}
+
+		field, value, _ := strings.Cut(strings.TrimSuffix(line, "\n"), ": ")
+		switch field {
+		case "":
+			if event.Name != "" {
+				return event, nil
+			}
+		case "id":
+			event.ID = value
+		case "event":
+			event.Name = value
+		case "data":
+			if err := json.Unmarshal([]byte(value), &event.Entry); err != nil {
+				return event, err
+			}
+		}
+	}
+}
+
+func TestStudentEvents(t *testing.T) {
+	cfg := configs.Default()
+	cfg.ValidateResponses = true
+	cfg.ListenAddr, cfg.GRPCAddr = freeAddr(t), freeAddr(t)
+
+	srv := mustNewServer(cfg, repository.NewMemoryStudentRepository(), repository.NewMemoryAuditRepository(), nil)
+	lc := lifecycle.New()
+	srv.Register(lc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !assert.NoError(t, lc.Start(ctx)) {
+		return
+	}
+	defer lc.Stop(ctx)
+	client := serverClient(t, ctx, "http://"+cfg.ListenAddr)
+
+	// function to open a stream of events, the headers (pairs of name and value) are sent along
+	open := func(route string, headers ...string) (*http.Response, *bufio.Reader) {
+		resp := client.send("GET", route, "", headers...)
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	// the streams which cannot be followed are rejected before they start
+	resp, _ := open("/students/events?lastEventId=42")
+	assert.Equal(t, 400, resp.StatusCode)
+	resp, _ = open("/students/events?actions=rename")
+	assert.Equal(t, 400, resp.StatusCode)
+	resp, _ = open("/students/events?nickname=Ada")
+	assert.Equal(t, 400, resp.StatusCode)
+	resp, _ = open("/students/events/ws")
+	assert.Equal(t, 426, resp.StatusCode)
+
+	// the creations and deletions of the students living in Paris, as Server-Sent Events
+	resp, parisEvents := open("/students/events?actions=create,delete&address=Paris")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// every change leaving a student above 90, over a WebSocket
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, "ws://"+cfg.ListenAddr+"/students/events/ws?filter="+url.QueryEscape("percentage > 90"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var created map[string]map[string]map[string]string
+	resp = client.send("POST", "/student", `{"name":"Ada","dob":"2001-02-03","percentage": 80,"address":"Paris","description":"Go Developer"}`)
+	json.NewDecoder(resp.Body).Decode(&created)
+	ada := created["data"]["data"]["InsertedID"]
+
+	client.send("POST", "/student", `{"name":"Grace","dob":"2001-02-03","percentage": 95,"address":"London","description":"Go Developer"}`)
+	assert.Equal(t, 200, client.send("PUT", "/student/"+ada, `{"name":"Ada","dob":"2001-02-03","percentage": 99,"address":"Paris","description":"Go Developer"}`).StatusCode)
+	assert.Equal(t, 200, client.send("DELETE", "/student/"+ada, "").StatusCode)
+
+	var sse []serverSentEvent
+	for i := 0; i < 2; i++ {
+		event, err := readEvent(parisEvents)
+		if !assert.NoError(t, err) {
+			return
+		}
+		sse = append(sse, event)
+	}
+	assert.Equal(t, "create", sse[0].Name)
+	assert.Equal(t, "delete", sse[1].Name)
+	assert.Equal(t, sse[0].Entry.ID.Hex(), sse[0].ID, "the history is polled, the position of an event is the ID of its audit entry alone")
+	assert.Equal(t, "Ada", sse[1].Entry.Snapshot.Name)
+
+	var messages []string
+	for i := 0; i < 3; i++ {
+		var event controllers.WebSocketEvent
+		if !assert.NoError(t, ws.ReadJSON(&event)) {
+			return
+		}
+		assert.Equal(t, event.ID.Hex(), event.EventID)
+		messages = append(messages, event.Snapshot.Name+" "+event.Action)
+	}
+	assert.Equal(t, []string{"Grace create", "Ada update", "Ada delete"}, messages)
+
+	// a client resuming after the first event gets every change made since, right away
+	_, resumed := open("/students/events", controllers.HeaderLastEventID, sse[0].ID)
+	var names []string
+	for i := 0; i < 3; i++ {
+		event, err := readEvent(resumed)
+		if !assert.NoError(t, err) {
+			return
+		}
+		names = append(names, event.Name)
+	}
+	assert.Equal(t, []string{"create", "update", "delete"}, names)
+
+	// the streams end when the server shuts down, the WebSocket is told why
+	assert.NoError(t, lc.Stop(ctx))
+
+	_, err = readEvent(parisEvents)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+}
@@ -0,0 +1,50 @@
+// File responsible for the metrics of the cache of the students
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Number of students looked up in the cache, by result (hit or miss).",
+	}, []string{"result"})
+
+	cacheLoads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_loads_total",
+		Help:      "Number of students loaded from the database after a miss, the concurrent misses of a student count once.",
+	})
+
+	cacheErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_errors_total",
+		Help:      "Number of operations of the cache which failed, by operation (get, set or delete).",
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(cacheLookups, cacheLoads, cacheErrors)
+}
+
+// function to count a lookup in the cache
+func CacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(result).Inc()
+}
+
+// function to count a load from the database made to fill the cache
+func CacheLoad() {
+	cacheLoads.Inc()
+}
+
+// function to count a failed operation of the cache, the request itself goes on without the cache
+func CacheError(operation string) {
+	cacheErrors.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,59 @@
+// File responsible for the metrics of the HTTP requests
+
+package metrics
+
+import (
+	"my-rest-api/middleware"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle the HTTP requests, by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests being handled.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(httpRequests, httpDuration, httpInFlight)
+}
+
+// Middleware measures every request of the app, it has to be registered with app.Use before the routes
+// the requests are labelled with the template of their route (e.g. /student/:userId) rather than their path
+// and the unknown paths share one series, the errors are counted under their real status
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	httpInFlight.Inc()
+	defer httpInFlight.Dec()
+
+	outcome, err := middleware.Next(c)
+	if err != nil {
+		return err
+	}
+
+	// the method is copied since fiber reuses its memory once the request is over, and the labels are kept
+	labels := prometheus.Labels{"route": outcome.Route, "method": utils.CopyString(c.Method()), "status": strconv.Itoa(outcome.Status)}
+	httpRequests.With(labels).Inc()
+	httpDuration.With(labels).Observe(time.Since(start).Seconds())
+
+	return nil
+}
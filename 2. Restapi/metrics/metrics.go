@@ -0,0 +1,34 @@
+// Package metrics exposes the metrics of the api in the Prometheus format
+// The collectors live in their own registry, which is served at /metrics along with the metrics of the go runtime
+package metrics
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// the prefix of the metrics of the api itself
+const namespace = "student_api"
+
+// Registry holds every metric served at /metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// function to build the handler serving the metrics in the text format of Prometheus
+func Handler() fiber.Handler {
+	handler := fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+	return func(c *fiber.Ctx) error {
+		handler(c.Context())
+		return nil
+	}
+}
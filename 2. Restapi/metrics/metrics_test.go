@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"my-rest-api/middleware"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMiddleware(t *testing.T) {
+	// an error handler giving the errors of the handlers a status of its own, the errors of fiber keep theirs
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return c.Status(fiberErr.Code).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusTeapot).SendString(err.Error())
+	}})
+	app.Use(Middleware)
+	app.Get("/student/:userId", func(c *fiber.Ctx) error {
+		if c.Params("userId") == "broken" {
+			return errors.New("broken")
+		}
+		return c.SendString("ok")
+	})
+	app.Get("/metrics", Handler())
+
+	ok := httpRequests.WithLabelValues("/student/:userId", "GET", "200")
+	failed := httpRequests.WithLabelValues("/student/:userId", "GET", "418")
+	unmatched := httpRequests.WithLabelValues(middleware.UnmatchedRoute, "GET", "404")
+	before := []float64{testutil.ToFloat64(ok), testutil.ToFloat64(failed), testutil.ToFloat64(unmatched)}
+
+	// the requests are counted under the template of their route, and the errors under the status the error handler gives them
+	for _, path := range []string{"/student/1", "/student/2", "/student/broken", "/nowhere", "/nowhere/else"} {
+		app.Test(httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, before[0]+2, testutil.ToFloat64(ok))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(failed))
+	assert.Equal(t, before[2]+2, testutil.ToFloat64(unmatched), "the unknown paths share one series")
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpInFlight))
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), `student_api_http_request_duration_seconds_bucket{method="GET",route="/student/:userId",status="200",le="0.005"}`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestMongoMonitors(t *testing.T) {
+	commands, pool := CommandMonitor(), PoolMonitor()
+	ctx := context.Background()
+
+	commands.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", DurationNanos: 2e6}})
+	commands.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", DurationNanos: 1e6}})
+	assert.Equal(t, 2, testutil.CollectAndCount(mongoCommands), "one series per command and outcome")
+
+	for _, eventType := range []string{event.ConnectionCreated, event.ConnectionCreated, event.GetSucceeded, event.GetSucceeded, event.ConnectionReturned, event.ConnectionClosed} {
+		pool.Event(&event.PoolEvent{Type: eventType, Address: "db:27017"})
+	}
+	pool.Event(&event.PoolEvent{Type: event.GetFailed, Address: "db:27017", Reason: event.ReasonTimedOut})
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(mongoConnections.WithLabelValues("db:27017", "open")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(mongoConnections.WithLabelValues("db:27017", "in_use")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(mongoCheckoutFailures.WithLabelValues("db:27017", event.ReasonTimedOut)))
+}
@@ -0,0 +1,82 @@
+// File responsible for the metrics of MongoDB, out of the monitors of the driver
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	mongoCommands = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongodb_command_duration_seconds",
+		Help:      "Time taken by the commands sent to MongoDB, by command and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"command", "outcome"})
+
+	mongoConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mongodb_pool_connections",
+		Help:      "Number of connections of the pool of a MongoDB server, by state (open or in_use).",
+	}, []string{"address", "state"})
+
+	mongoCheckoutFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongodb_pool_checkout_failures_total",
+		Help:      "Number of times a connection could not be taken from the pool, by reason.",
+	}, []string{"address", "reason"})
+
+	mongoPoolClears = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongodb_pool_cleared_total",
+		Help:      "Number of times the pool of a MongoDB server was cleared, after an error of the server.",
+	}, []string{"address"})
+)
+
+func init() {
+	Registry.MustRegister(mongoCommands, mongoConnections, mongoCheckoutFailures, mongoPoolClears)
+}
+
+// the outcomes of a command
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+// function to build the command monitor recording the duration of every command, to set with options.Client().SetMonitor
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoCommands.WithLabelValues(e.CommandName, outcomeSuccess).Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoCommands.WithLabelValues(e.CommandName, outcomeFailure).Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+	}
+}
+
+// function to build the pool monitor keeping the gauges of the connections up to date, to set with options.Client().SetPoolMonitor
+func PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoConnections.WithLabelValues(e.Address, "open").Inc()
+			case event.ConnectionClosed:
+				mongoConnections.WithLabelValues(e.Address, "open").Dec()
+			case event.GetSucceeded:
+				mongoConnections.WithLabelValues(e.Address, "in_use").Inc()
+			case event.ConnectionReturned:
+				mongoConnections.WithLabelValues(e.Address, "in_use").Dec()
+			case event.GetFailed:
+				mongoCheckoutFailures.WithLabelValues(e.Address, e.Reason).Inc()
+			case event.PoolCleared:
+				mongoPoolClears.WithLabelValues(e.Address).Inc()
+			}
+		},
+	}
+}
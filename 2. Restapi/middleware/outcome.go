@@ -0,0 +1,45 @@
+// File responsible for what the middlewares observing the requests (logs, metrics, traces) know of one once it is over
+
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// the route of the requests which match no route, so that the unknown paths are all reported as one
+const UnmatchedRoute = "unmatched"
+
+// Outcome is how the app handled a request
+type Outcome struct {
+	// the template of the route which handled the request (e.g. /student/:userId), UnmatchedRoute when none did
+	Route   string
+	Matched bool
+
+	// the status sent, the one of the error when the handlers failed
+	Status int
+
+	// the error returned by the handlers, it is already rendered
+	Err error
+}
+
+// function to run the handlers following a middleware and tell how they handled the request
+// the middleware has to be registered with app.Use before the routes: fiber merges the ones registered that way
+// into a single route, which is still the current one after c.Next when no route matched
+// the errors are rendered with the error handler of the app right away, so that the outcome has their real status
+// the error returned is the one of the error handler, the middleware returns it as it is
+func Next(c *fiber.Ctx) (Outcome, error) {
+	own := c.Route()
+
+	err := c.Next()
+	if err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			return Outcome{}, err
+		}
+	}
+
+	outcome := Outcome{Route: UnmatchedRoute, Status: c.Response().StatusCode(), Err: err}
+	if c.Route() != own {
+		outcome.Route, outcome.Matched = c.Route().Path, true
+	}
+	return outcome, nil
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNext(t *testing.T) {
+	// an error handler giving the errors of the handlers a status of its own, the errors of fiber keep theirs
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return c.Status(fiberErr.Code).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusTeapot).SendString(err.Error())
+	}})
+
+	var outcome Outcome
+	app.Use(func(c *fiber.Ctx) error {
+		var err error
+		outcome, err = Next(c)
+		return err
+	})
+	app.Get("/student/:userId", func(c *fiber.Ctx) error {
+		if c.Params("userId") == "broken" {
+			return errors.New("broken")
+		}
+		return c.SendString("ok")
+	})
+
+	tests := []struct {
+		path     string
+		route    string
+		matched  bool
+		status   int
+		hasError bool
+	}{
+		{path: "/student/1", route: "/student/:userId", matched: true, status: 200},
+		{path: "/student/broken", route: "/student/:userId", matched: true, status: fiber.StatusTeapot, hasError: true},
+		{path: "/nowhere", route: UnmatchedRoute, status: 404, hasError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			resp, _ := app.Test(httptest.NewRequest("GET", test.path, nil))
+			assert.Equal(t, test.status, resp.StatusCode, "the error is rendered before the outcome is known")
+			assert.Equal(t, test.route, outcome.Route)
+			assert.Equal(t, test.matched, outcome.Matched)
+			assert.Equal(t, test.status, outcome.Status)
+			assert.Equal(t, test.hasError, outcome.Err != nil)
+		})
+	}
+}
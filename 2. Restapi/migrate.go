@@ -0,0 +1,158 @@
+// File containing the command line of the migrations
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"my-rest-api/configs"
+	"my-rest-api/migrations"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const migrateUsage = `usage: migrate <command> [-to version]
+
+  up       apply the pending migrations, up to the given version when -to is set
+  down     revert the latest migration, or every migration above the given version when -to is set
+  status   list the migrations and whether they have been applied`
+
+// function to create the runner of the migrations of the Records database
+func newMigrationRunner(client *mongo.Client, cfg configs.Config) *migrations.Runner {
+	store := migrations.NewMongoStore(configs.GetCollection(client, cfg.Database, "migrations"))
+
+	runner, err := migrations.NewRunner(store, client.Database(cfg.Database), migrations.All)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return runner
+}
+
+// function responsible for the "migrate up|down|status" command
+func migrate(client *mongo.Client, cfg configs.Config, args []string) {
+	if len(args) < 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	to := flags.Int("to", -1, "target version")
+	flags.Parse(args[1:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	runner := newMigrationRunner(client, cfg)
+
+	switch args[0] {
+	case "up":
+		target := *to
+		if target < 0 {
+			target = 0
+		}
+
+		applied, err := runner.Up(ctx, target)
+		printMigrations("applied", applied)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "down":
+		target := *to
+		if target < 0 {
+			// reverting only the latest applied migration
+			statuses, err := runner.Status(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			target = 0
+			latest := -1
+			for i, status := range statuses {
+				if status.Applied {
+					latest = i
+				}
+			}
+			if latest < 0 {
+				fmt.Println("no migration to revert")
+				return
+			}
+			if latest > 0 {
+				target = statuses[latest-1].Version
+			}
+		}
+
+		reverted, err := runner.Down(ctx, target)
+		printMigrations("reverted", reverted)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-30s %s\n", status.Version, status.Name, appliedAt)
+		}
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+// function to apply the pending migrations when the api starts
+func migrateUp(client *mongo.Client, cfg configs.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	applied, err := newMigrationRunner(client, cfg).Up(ctx, 0)
+	printMigrations("applied", applied)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printMigrations(verb string, done []migrations.Migration) {
+	if len(done) == 0 {
+		fmt.Printf("no migration %s\n", verb)
+	}
+
+	for _, migration := range done {
+		fmt.Printf("%s migration %d %s\n", verb, migration.Version, migration.Name)
+	}
+}
+
+// function responsible for running the date migration from the command line and printing its report
+func migrateDates(client *mongo.Client, cfg configs.Config, args []string) {
+	flags := flag.NewFlagSet("migrate-dates", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would be converted")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := migrations.ConvertStudentDates(ctx, configs.GetCollection(client, cfg.Database, "students"), *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Failures) > 0 {
+		log.Printf("%d values could not be converted, they are listed in the report", len(report.Failures))
+	}
+}
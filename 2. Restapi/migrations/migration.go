@@ -0,0 +1,53 @@
+// File containing the versioned migrations of the Records database and the list of them which is applied in order
+
+package migrations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// returned when another instance holds the lock of the migrations
+	ErrLocked = errors.New("the migrations are locked by another instance")
+
+	// returned when the lock expired or was taken over while migrating, the migrations are stopped
+	ErrLockLost = errors.New("the migrations lock was lost while migrating")
+
+	// returned when a migration has to be reverted but has no down step
+	ErrIrreversible = errors.New("the migration cannot be reverted")
+)
+
+// Migration changes the shape of the database from the previous version to its own
+// Up applies the change and Down takes it back, both are given the whole database
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is stored for every migration which has been applied
+type Record struct {
+	Version   int       `json:"version" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	AppliedAt time.Time `json:"appliedAt" bson:"appliedAt"`
+}
+
+// Status tells whether a migration has been applied and when
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// All lists the migrations of the Records database, a new migration is appended with the next version
+// the versions which have been released must never be changed or reused
+var All = []Migration{
+	{Version: 1, Name: "typed student dates", Up: upStudentDates, Down: downStudentDates},
+	{Version: 2, Name: "stored roll numbers", Up: upStudentRollNumbers, Down: downStudentRollNumbers},
+}
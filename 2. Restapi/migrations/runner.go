@@ -0,0 +1,231 @@
+// File responsible for applying and reverting the migrations in order
+
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// how long the lock is held without being renewed, it is renewed every third of it while migrating
+// so it only expires when the instance migrating went away
+const LockTTL = time.Minute
+
+// Runner applies the migrations to a database while holding the lock of the store
+type Runner struct {
+	store      Store
+	db         *mongo.Database
+	migrations []Migration
+
+	// identifies this instance in the lock
+	owner string
+
+	// LockTTL, shorter in the tests
+	lockTTL time.Duration
+}
+
+// function to create a runner, the migrations are sorted by version
+// two migrations with the same version, or a version lower than 1, are rejected
+func NewRunner(store Store, db *mongo.Database, migrations []Migration) (*Runner, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, migration := range sorted {
+		if migration.Version < 1 {
+			return nil, fmt.Errorf("migration %q has version %d, versions start at 1", migration.Name, migration.Version)
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("migrations %q and %q share the version %d", sorted[i-1].Name, migration.Name, migration.Version)
+		}
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration %d %q has no up step", migration.Version, migration.Name)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), primitive.NewObjectID().Hex())
+
+	return &Runner{store: store, db: db, migrations: sorted, owner: owner, lockTTL: LockTTL}, nil
+}
+
+// function to list every known migration along with whether it has been applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(r.migrations))
+	for i, migration := range r.migrations {
+		statuses[i] = Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			statuses[i].Applied, statuses[i].AppliedAt = true, &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+// function to apply, in order, the migrations which have not been applied yet up to the target version
+// a target of 0 applies all of them, the migrations applied before an error stay applied
+func (r *Runner) Up(ctx context.Context, target int) ([]Migration, error) {
+	done := []Migration{}
+
+	err := r.locked(ctx, func(ctx context.Context, applied map[int]Record) error {
+		for _, migration := range r.migrations {
+			if target > 0 && migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := context.Cause(ctx); err != nil {
+				return err
+			}
+
+			log.Printf("applying migration %d %s", migration.Version, migration.Name)
+			if err := migration.Up(ctx, r.db); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, stepError(ctx, err))
+			}
+
+			record := Record{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC().Truncate(time.Millisecond)}
+			if err := r.store.MarkApplied(ctx, record); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// function to revert, latest first, the applied migrations above the target version
+func (r *Runner) Down(ctx context.Context, target int) ([]Migration, error) {
+	done := []Migration{}
+
+	err := r.locked(ctx, func(ctx context.Context, applied map[int]Record) error {
+		for i := len(r.migrations) - 1; i >= 0; i-- {
+			migration := r.migrations[i]
+			if migration.Version <= target {
+				break
+			}
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := context.Cause(ctx); err != nil {
+				return err
+			}
+
+			if migration.Down == nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+			}
+
+			log.Printf("reverting migration %d %s", migration.Version, migration.Name)
+			if err := migration.Down(ctx, r.db); err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, stepError(ctx, err))
+			}
+
+			if err := r.store.MarkReverted(ctx, migration.Version); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// function to run a step while holding the lock, the applied migrations are read once the lock is taken
+// the lock is renewed while the step runs, the context of the step is canceled with ErrLockLost when it cannot be
+func (r *Runner) locked(ctx context.Context, step func(ctx context.Context, applied map[int]Record) error) error {
+	if err := r.store.Lock(ctx, r.owner, r.lockTTL); err != nil {
+		return err
+	}
+
+	// releasing the lock even when the context of the migration is over
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := r.store.Unlock(unlockCtx, r.owner); err != nil {
+			log.Printf("could not release the migrations lock: %v", err)
+		}
+	}()
+
+	// the renewals are over by the time the lock is released
+	ctx, cancel := context.WithCancelCause(ctx)
+	renewing := make(chan struct{})
+	go func() {
+		defer close(renewing)
+		r.renew(ctx, cancel)
+	}()
+	defer func() {
+		cancel(nil)
+		<-renewing
+	}()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	return step(ctx, applied)
+}
+
+// function to renew the lock every third of its ttl until the context is done
+// a renewal which fails for another reason is tried again at the next tick, the lock is only lost once it expired
+func (r *Runner) renew(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(r.lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.store.Renew(ctx, r.owner, r.lockTTL)
+		if errors.Is(err, ErrLockLost) {
+			cancel(ErrLockLost)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not renew the migrations lock: %v", err)
+		}
+	}
+}
+
+// function to tell why a migration failed, the lost lock rather than the cancellation it caused
+func stepError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	records, err := r.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Record{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,164 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The runner is checked against the in-memory store with migrations which only write down what they did
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+
+	var steps []string
+	step := func(name string) func(context.Context, *mongo.Database) error {
+		return func(context.Context, *mongo.Database) error {
+			steps = append(steps, name)
+			return nil
+		}
+	}
+
+	store := NewMemoryStore()
+	runner, err := NewRunner(store, nil, []Migration{
+		{Version: 2, Name: "second", Up: step("up 2"), Down: step("down 2")},
+		{Version: 1, Name: "first", Up: step("up 1"), Down: step("down 1")},
+		{Version: 3, Name: "third", Up: step("up 3")},
+	})
+	assert.NoError(t, err)
+
+	applied, err := runner.Up(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.Equal(t, []string{"up 1", "up 2"}, steps, "the migrations are applied in order up to the target")
+
+	applied, err = runner.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, []string{"up 1", "up 2", "up 3"}, steps, "the applied migrations are not run again")
+
+	statuses, err := runner.Status(ctx)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.Truef(t, status.Applied, "migration %d is applied", status.Version)
+	}
+
+	_, err = runner.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrIrreversible, "a migration without a down step stops the rollback")
+
+	store.MarkReverted(ctx, 3)
+	steps = nil
+	reverted, err := runner.Down(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 2)
+	assert.Equal(t, []string{"down 2", "down 1"}, steps, "the migrations are reverted latest first")
+
+	records, _ := store.Applied(ctx)
+	assert.Empty(t, records)
+}
+
+func TestRunnerStopsOnError(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("boom")
+
+	store := NewMemoryStore()
+	runner, _ := NewRunner(store, nil, []Migration{
+		{Version: 1, Name: "first", Up: func(context.Context, *mongo.Database) error { return nil }},
+		{Version: 2, Name: "broken", Up: func(context.Context, *mongo.Database) error { return failure }},
+		{Version: 3, Name: "third", Up: func(context.Context, *mongo.Database) error { return nil }},
+	})
+
+	applied, err := runner.Up(ctx, 0)
+	assert.ErrorIs(t, err, failure)
+	assert.Len(t, applied, 1)
+
+	records, _ := store.Applied(ctx)
+	assert.Len(t, records, 1, "only the migrations before the error are recorded")
+
+	// the lock is released even though the migration failed
+	assert.NoError(t, store.Lock(ctx, "someone else", time.Minute))
+}
+
+func TestRunnerLock(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewMemoryStore()
+	runner, _ := NewRunner(store, nil, []Migration{
+		{Version: 1, Name: "first", Up: func(context.Context, *mongo.Database) error { return nil }},
+	})
+
+	assert.NoError(t, store.Lock(ctx, "another instance", time.Minute))
+	_, err := runner.Up(ctx, 0)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// a lock which has expired is taken over, the instance holding it is assumed to have crashed
+	store.lockedUntil = time.Now().Add(-time.Second)
+	applied, err := runner.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+}
+
+func TestRunnerRenewsTheLock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	// the migration takes several times the ttl of the lock, which nobody else can take meanwhile
+	var stolen error
+	runner, _ := NewRunner(store, nil, []Migration{
+		{Version: 1, Name: "slow", Up: func(ctx context.Context, db *mongo.Database) error {
+			for i := 0; i < 5; i++ {
+				time.Sleep(20 * time.Millisecond)
+				if err := store.Lock(ctx, "another instance", time.Minute); err == nil {
+					stolen = errors.New("the lock was taken over while migrating")
+				}
+			}
+			return nil
+		}},
+	})
+	runner.lockTTL = 30 * time.Millisecond
+
+	applied, err := runner.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.NoError(t, stolen)
+}
+
+func TestRunnerStopsOnceTheLockIsLost(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	// the lock is taken over during the first migration, e.g. after the instance was paused for longer than the ttl
+	runner, _ := NewRunner(store, nil, []Migration{
+		{Version: 1, Name: "paused", Up: func(ctx context.Context, db *mongo.Database) error {
+			store.mu.Lock()
+			store.owner = "another instance"
+			store.mu.Unlock()
+
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{Version: 2, Name: "second", Up: func(context.Context, *mongo.Database) error { return nil }},
+	})
+	runner.lockTTL = 30 * time.Millisecond
+
+	applied, err := runner.Up(ctx, 0)
+	assert.ErrorIs(t, err, ErrLockLost)
+	assert.Empty(t, applied)
+
+	// the lock of the other instance is left alone
+	assert.ErrorIs(t, store.Lock(ctx, "someone else", time.Minute), ErrLocked)
+}
+
+func TestNewRunnerRejectsDuplicateVersions(t *testing.T) {
+	up := func(context.Context, *mongo.Database) error { return nil }
+
+	_, err := NewRunner(NewMemoryStore(), nil, []Migration{{Version: 1, Name: "a", Up: up}, {Version: 1, Name: "b", Up: up}})
+	assert.Error(t, err)
+
+	_, err = NewRunner(NewMemoryStore(), nil, All)
+	assert.NoError(t, err, "the migrations of the Records database are valid")
+}
@@ -0,0 +1,183 @@
+// File containing the storages which keep track of the applied migrations and of the lock
+
+package migrations
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store records which migrations have been applied and makes sure only one instance migrates at a time
+type Store interface {
+	// the applied migrations, lowest version first
+	Applied(ctx context.Context) ([]Record, error)
+	MarkApplied(ctx context.Context, record Record) error
+	MarkReverted(ctx context.Context, version int) error
+
+	// the lock expires after ttl so that an instance which crashed while migrating does not block the others forever
+	Lock(ctx context.Context, owner string, ttl time.Duration) error
+	// Renew pushes the expiry of a lock the owner still holds, ErrLockLost means it does not anymore
+	Renew(ctx context.Context, owner string, ttl time.Duration) error
+	Unlock(ctx context.Context, owner string) error
+}
+
+// ID of the document holding the lock, the records use the version as their ID
+const lockID = "lock"
+
+// MongoStore keeps the records and the lock in the "migrations" collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// function to create a store on top of the migrations collection
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Applied(ctx context.Context) ([]Record, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	// leaving the lock document out
+	results, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	if err := results.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (s *MongoStore) MarkApplied(ctx context.Context, record Record) error {
+	_, err := s.collection.InsertOne(ctx, record)
+	return err
+}
+
+func (s *MongoStore) MarkReverted(ctx context.Context, version int) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
+
+func (s *MongoStore) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	now := time.Now().UTC()
+
+	// taking over the lock only when it has expired, when it is held the upsert
+	// tries to insert a second lock document and fails on the duplicate ID
+	filter := bson.M{"_id": lockID, "lockedUntil": bson.M{"$lt": now}}
+	update := bson.M{"$set": bson.M{"owner": owner, "lockedAt": now, "lockedUntil": now.Add(ttl)}}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+
+	return err
+}
+
+func (s *MongoStore) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	now := time.Now().UTC()
+
+	filter := bson.M{"_id": lockID, "owner": owner, "lockedUntil": bson.M{"$gte": now}}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lockedUntil": now.Add(ttl)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+func (s *MongoStore) Unlock(ctx context.Context, owner string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+	return err
+}
+
+// MemoryStore keeps the records and the lock in memory, it is meant for the tests
+type MemoryStore struct {
+	mu          sync.Mutex
+	records     map[int]Record
+	owner       string
+	lockedUntil time.Time
+}
+
+// function to create an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[int]Record{}}
+}
+
+func (s *MemoryStore) Applied(ctx context.Context) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []Record{}
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+
+	return records, nil
+}
+
+func (s *MemoryStore) MarkApplied(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Version] = record
+	return nil
+}
+
+func (s *MemoryStore) MarkReverted(ctx context.Context, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, version)
+	return nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.owner != "" && now.Before(s.lockedUntil) {
+		return ErrLocked
+	}
+
+	s.owner, s.lockedUntil = owner, now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.owner != owner || !now.Before(s.lockedUntil) {
+		return ErrLockLost
+	}
+
+	s.lockedUntil = now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Unlock(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.owner == owner {
+		s.owner, s.lockedUntil = "", time.Time{}
+	}
+
+	return nil
+}
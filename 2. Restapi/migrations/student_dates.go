@@ -0,0 +1,196 @@
+// File containing the migration which turns the dates of the students, stored as free-form strings, into real datetimes
+
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"my-rest-api/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// layout of time.Now().String(), which is how createdAt used to be stored (without the monotonic clock suffix)
+const legacyTimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// DateFailure describes a value which could not be converted, the document is left as it is for that attribute
+type DateFailure struct {
+	ID    primitive.ObjectID `json:"id"`
+	Field string             `json:"field"`
+	Value string             `json:"value"`
+	Error string             `json:"error"`
+}
+
+// DateReport sums up a run of the migration
+type DateReport struct {
+	Scanned   int           `json:"scanned"`
+	Converted int           `json:"converted"`
+	Failures  []DateFailure `json:"failures"`
+}
+
+// the attributes of an old student document which the migration looks at
+type legacyStudent struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	DOB       bson.RawValue      `bson:"dob"`
+	CreatedAt bson.RawValue      `bson:"createdat"`
+}
+
+// function to convert the dob strings into dates and the old "createdat" strings into "createdAt" datetimes
+// nothing is written when dryRun is set, the report tells what would have been converted
+// running it again is harmless, the documents which were already converted are not matched anymore
+func ConvertStudentDates(ctx context.Context, students *mongo.Collection, dryRun bool) (DateReport, error) {
+	report := DateReport{Failures: []DateFailure{}}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"dob": bson.M{"$type": "string"}},
+		bson.M{"createdat": bson.M{"$exists": true}},
+	}}
+
+	results, err := students.Find(ctx, filter)
+	if err != nil {
+		return report, err
+	}
+	defer results.Close(ctx)
+
+	for results.Next(ctx) {
+		var student legacyStudent
+		if err := results.Decode(&student); err != nil {
+			return report, err
+		}
+		report.Scanned++
+
+		set, unset := bson.M{}, bson.M{}
+		fail := func(field string, value string, err error) {
+			report.Failures = append(report.Failures, DateFailure{ID: student.ID, Field: field, Value: value, Error: err.Error()})
+		}
+
+		if student.DOB.Type == bsontype.String {
+			value := student.DOB.StringValue()
+			if dob, err := models.ParseLegacyDate(value); err != nil {
+				fail("dob", value, err)
+			} else {
+				set["dob"] = dob
+			}
+		}
+
+		if student.CreatedAt.Type == bsontype.String {
+			value := student.CreatedAt.StringValue()
+			if createdAt, err := parseLegacyTimestamp(value); err != nil {
+				fail("createdat", value, err)
+			} else {
+				set["createdAt"] = createdAt
+				unset["createdat"] = ""
+			}
+		} else if student.CreatedAt.Type != 0 {
+			// anything else in the old attribute cannot be a creation time, there is nothing to keep
+			unset["createdat"] = ""
+		}
+
+		if len(set) == 0 && len(unset) == 0 {
+			continue
+		}
+		report.Converted++
+
+		if dryRun {
+			continue
+		}
+
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+
+		if _, err := students.UpdateOne(ctx, bson.M{"_id": student.ID}, update); err != nil {
+			return report, err
+		}
+	}
+
+	return report, results.Err()
+}
+
+// function to read a timestamp written by time.Now().String(), e.g.
+// "2023-02-18 16:12:01.123456789 +0530 IST m=+0.012345678"
+func parseLegacyTimestamp(value string) (time.Time, error) {
+	if i := strings.Index(value, " m="); i >= 0 {
+		value = value[:i]
+	}
+
+	parsed, err := time.Parse(legacyTimestampLayout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a timestamp written by time.Now().String()", value)
+	}
+
+	return parsed.UTC().Truncate(time.Millisecond), nil
+}
+
+// up step of the typed student dates migration
+// the values which cannot be understood are only logged, they are left for a person to fix
+func upStudentDates(ctx context.Context, db *mongo.Database) error {
+	report, err := ConvertStudentDates(ctx, db.Collection("students"), false)
+	if err != nil {
+		return err
+	}
+
+	for _, failure := range report.Failures {
+		log.Printf("student %s: could not convert %s %q: %s", failure.ID.Hex(), failure.Field, failure.Value, failure.Error)
+	}
+
+	return nil
+}
+
+// down step of the typed student dates migration, the dates are written back as strings
+// the dob keeps the YYYY-MM-DD layout and createdat the layout of time.Time.String()
+func downStudentDates(ctx context.Context, db *mongo.Database) error {
+	students := db.Collection("students")
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"dob": bson.M{"$type": "date"}},
+		bson.M{"createdAt": bson.M{"$exists": true}},
+		bson.M{"updatedAt": bson.M{"$exists": true}},
+	}}
+
+	results, err := students.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer results.Close(ctx)
+
+	for results.Next(ctx) {
+		var student struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			DOB       bson.RawValue      `bson:"dob"`
+			CreatedAt bson.RawValue      `bson:"createdAt"`
+		}
+		if err := results.Decode(&student); err != nil {
+			return err
+		}
+
+		set := bson.M{}
+		if student.DOB.Type == bsontype.DateTime {
+			set["dob"] = student.DOB.Time().UTC().Format(models.DateLayout)
+		}
+		if student.CreatedAt.Type == bsontype.DateTime {
+			set["createdat"] = student.CreatedAt.Time().UTC().String()
+		}
+
+		update := bson.M{"$unset": bson.M{"createdAt": "", "updatedAt": ""}}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+
+		if _, err := students.UpdateOne(ctx, bson.M{"_id": student.ID}, update); err != nil {
+			return err
+		}
+	}
+
+	return results.Err()
+}
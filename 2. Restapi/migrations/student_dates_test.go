@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLegacyTimestamp(t *testing.T) {
+	parsed, err := parseLegacyTimestamp("2023-02-18 16:12:01.123456789 +0530 IST m=+0.012345678")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, time.February, 18, 10, 42, 1, 123000000, time.UTC), parsed)
+
+	parsed, err = parseLegacyTimestamp(time.Date(2023, time.March, 1, 8, 0, 0, 0, time.UTC).String())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, time.March, 1, 8, 0, 0, 0, time.UTC), parsed)
+
+	_, err = parseLegacyTimestamp("yesterday")
+	assert.Error(t, err)
+}
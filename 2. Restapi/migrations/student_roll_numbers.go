@@ -0,0 +1,25 @@
+// File containing the migration which stores an empty roll number on the students written without one
+
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// up step of the stored roll numbers migration
+// a student without the attribute is not matched by {"rollNumber": ""} nor by {"rollNumber": {"$gt": ""}}, so it would be
+// left out of the filters on the roll number and of the pages after the first one when sorting on it
+// the empty roll numbers are left out of the unique index by its partial filter
+func upStudentRollNumbers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("students").UpdateMany(ctx, bson.M{"rollNumber": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"rollNumber": ""}})
+	return err
+}
+
+// down step of the stored roll numbers migration, the empty roll numbers are removed again
+func downStudentRollNumbers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("students").UpdateMany(ctx, bson.M{"rollNumber": ""}, bson.M{"$unset": bson.M{"rollNumber": ""}})
+	return err
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStudentRollNumbers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	// function to read the filter and the update sent by the last migration step
+	sent := func(mt *mtest.T) (bson.Raw, bson.Raw) {
+		update := mt.GetStartedEvent().Command.Lookup("updates", "0")
+		return update.Document().Lookup("q").Document(), update.Document().Lookup("u").Document()
+	}
+
+	mt.Run("up", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}, {Key: "nModified", Value: 2}})
+		if !assert.NoError(mt, upStudentRollNumbers(context.Background(), mt.DB)) {
+			return
+		}
+
+		filter, update := sent(mt)
+		assert.Equal(mt, `{"rollNumber": {"$exists": false}}`, filter.String())
+		assert.Equal(mt, `{"$set": {"rollNumber": ""}}`, update.String())
+	})
+
+	mt.Run("down", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}, {Key: "nModified", Value: 2}})
+		if !assert.NoError(mt, downStudentRollNumbers(context.Background(), mt.DB)) {
+			return
+		}
+
+		filter, update := sent(mt)
+		assert.Equal(mt, `{"rollNumber": ""}`, filter.String())
+		assert.Equal(mt, `{"$unset": {"rollNumber": ""}}`, update.String())
+	})
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The structure of an entry of the audit log, one is written for every change made to a student
+// The snapshot is the student as it was right after the change, it is what a revert goes back to
+
+type AuditEntry struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	StudentID primitive.ObjectID `json:"studentId" bson:"studentId"`
+	Version   int64              `json:"version" bson:"version"`
+	Action    string             `json:"action" bson:"action"`
+	Actor     string             `json:"actor" bson:"actor"`
+	At        time.Time          `json:"at" bson:"at"`
+	Changes   []FieldChange      `json:"changes" bson:"changes"`
+	Snapshot  Student            `json:"snapshot" bson:"snapshot"`
+}
+
+// The change of a single attribute, Before is empty when the student was created
+
+type FieldChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// the actions recorded in the audit log
+// a purge is not recorded, only the change feed tells about it when it watches the students
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionPatch   = "patch"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+	ActionPurge   = "purge"
+)
+
+// every action which can happen to a student, in the order of its life
+var Actions = []string{ActionCreate, ActionUpdate, ActionPatch, ActionDelete, ActionRestore, ActionRevert, ActionPurge}
+
+// function to list the attributes which differ between two states of a student
+// only the attributes set by the clients are compared, the ones managed by the server (version, timestamps, ...)
+// change on every write and are already part of the entry
+// the deletion is the exception, it is the whole change of a delete or a restore
+func Diff(before Student, after Student) []FieldChange {
+	changes := []FieldChange{}
+	for _, field := range StudentFields {
+		if field.Editable && !field.Equal(before, after) {
+			changes = append(changes, FieldChange{Field: field.Name, Before: field.Value(before), After: field.Value(after)})
+		}
+	}
+
+	if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+		changes = append(changes, FieldChange{Field: "deletedAt", Before: deletedAt(before), After: deletedAt(after)})
+	}
+
+	return changes
+}
+
+// the time a student was deleted at, nil when it is not deleted
+func deletedAt(student Student) interface{} {
+	if student.DeletedAt == nil {
+		return nil
+	}
+	return *student.DeletedAt
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A calendar date without a time of day, such as a date of birth
+// It is written as "2006-01-02" in json and stored as a datetime at midnight UTC in the database
+
+type Date struct {
+	time.Time
+}
+
+// layout of a date in the api
+const DateLayout = "2006-01-02"
+
+// the layouts which were used for dates before they were typed, only accepted when reading old documents
+var LegacyDateLayouts = []string{DateLayout, "2 Jan 2006", "2 January 2006", "Jan 2, 2006", "January 2, 2006", "2-Jan-2006"}
+
+// function to build a date, the time of day is dropped
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// function to read a date written in the api layout
+// impossible dates such as "2002-02-30" are rejected
+func ParseDate(value string) (Date, error) {
+	parsed, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return Date{}, fmt.Errorf("%q is not a valid date, expected YYYY-MM-DD", value)
+	}
+
+	return Date{parsed}, nil
+}
+
+// function to read a date in any of the layouts used before dates were typed
+func ParseLegacyDate(value string) (Date, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range LegacyDateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return Date{parsed}, nil
+		}
+	}
+
+	return Date{}, fmt.Errorf("%q is not a date in any of the known layouts", value)
+}
+
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("a date must be a string formatted as YYYY-MM-DD")
+	}
+
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
+
+func (d Date) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if d.IsZero() {
+		return bson.MarshalValue(nil)
+	}
+
+	return bson.MarshalValue(primitive.NewDateTimeFromTime(d.Time))
+}
+
+// the documents written before dates were typed still hold strings until they are migrated, they are read as well
+// a string which is not a date at all is read as an empty date rather than failing the whole list,
+// the migration reports these documents so that they can be fixed by hand
+func (d *Date) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+
+	switch t {
+	case bsontype.DateTime:
+		*d = Date{raw.Time().UTC()}
+	case bsontype.String:
+		parsed, _ := ParseLegacyDate(raw.StringValue())
+		*d = parsed
+	case bsontype.Null, bsontype.Undefined:
+		*d = Date{}
+	default:
+		return fmt.Errorf("cannot read a date out of a %s", t)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Describing the fields of the student model so that queries (filters, sorting, ...) can be checked against it
+// The description is built from the struct tags, so adding a field to the model is enough to make it queryable
+
+type FieldKind int
+
+const (
+	StringField FieldKind = iota
+	NumberField
+	TimeField
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	dateType = reflect.TypeOf(Date{})
+)
+
+type Field struct {
+	Name     string    // name of the attribute in json (and in the api)
+	Key      string    // name of the attribute in the database
+	Kind     FieldKind // type of the values stored in the attribute
+	Editable bool      // whether clients can set the attribute, the validated ones are, the rest is managed by the server
+	index    int
+	bits     int // precision of the numbers, a float32 is stored widened to a double and only equals the literals rounded the same way
+}
+
+// every queryable field of the student model, in declaration order
+// the "_id" field is left out because it is handled separately by the storage
+var StudentFields = describeFields(reflect.TypeOf(Student{}))
+
+// function to find a field by the name used in the api
+func LookupField(name string) (Field, bool) {
+	for _, field := range StudentFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// function to read the value of a field out of a student
+// numbers are always returned as float64 and dates as time.Time so that they compare the same way everywhere
+func (f Field) Value(student Student) interface{} {
+	value := reflect.ValueOf(student).Field(f.index)
+
+	switch f.Kind {
+	case NumberField:
+		if value.CanFloat() {
+			return value.Float()
+		}
+		return float64(value.Int())
+	case TimeField:
+		if date, ok := value.Interface().(Date); ok {
+			return date.Time
+		}
+		return value.Interface().(time.Time)
+	default:
+		return value.String()
+	}
+}
+
+// function to tell whether a field has the same value in two students
+func (f Field) Equal(a Student, b Student) bool {
+	return CompareValues(f.Value(a), f.Value(b)) == 0
+}
+
+// function to read a value sent by a client (in a query param, a filter, ...) as a value of the field
+// dates are written as "2006-01-02" or as RFC 3339 timestamps
+func (f Field) ParseValue(raw string) (interface{}, error) {
+	switch f.Kind {
+	case NumberField:
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s expects a number, got %q", f.Name, raw)
+		}
+		return f.RoundNumber(number), nil
+
+	case TimeField:
+		if date, err := ParseDate(raw); err == nil {
+			return date.Time, nil
+		}
+		if timestamp, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return timestamp.UTC(), nil
+		}
+		return nil, fmt.Errorf("%s expects a date such as 2006-01-02 or 2006-01-02T15:04:05Z, got %q", f.Name, raw)
+	}
+
+	return raw, nil
+}
+
+// function to round a number sent by a client to the precision of the field, e.g. 99.99 is 99.98999786376953 in a float32
+// otherwise an equality with a value the client wrote itself never matches
+func (f Field) RoundNumber(number float64) float64 {
+	if f.bits == 32 {
+		return float64(float32(number))
+	}
+	return number
+}
+
+// function to compare two values of the same kind, the way mongo orders them
+// strings are compared byte by byte, numbers and times by their value
+func CompareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case float64:
+		b, _ := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	case time.Time:
+		b, _ := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// function to copy the value of a field from one student to another
+func (f Field) Copy(dst *Student, src Student) {
+	reflect.ValueOf(dst).Elem().Field(f.index).Set(reflect.ValueOf(src).Field(f.index))
+}
+
+// function to list the editable fields whose value differs between two students
+func ChangedFields(before Student, after Student) []Field {
+	var changed []Field
+	for _, field := range StudentFields {
+		if field.Editable && !field.Equal(before, after) {
+			changed = append(changed, field)
+		}
+	}
+
+	return changed
+}
+
+func describeFields(t reflect.Type) []Field {
+	var fields []Field
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+
+		name := tagName(structField.Tag.Get("json"))
+		if name == "" || name == "-" {
+			name = structField.Name
+		}
+
+		// the mongo driver lowercases the field name when there is no bson tag
+		key := tagName(structField.Tag.Get("bson"))
+		if key == "" {
+			key = strings.ToLower(structField.Name)
+		}
+
+		if key == "_id" {
+			continue
+		}
+
+		var kind FieldKind
+		bits := 64
+		switch structField.Type.Kind() {
+		case reflect.Struct:
+			if structField.Type != timeType && structField.Type != dateType {
+				continue
+			}
+			kind = TimeField
+		case reflect.Float32:
+			kind, bits = NumberField, 32
+		case reflect.Float64, reflect.Int, reflect.Int32, reflect.Int64:
+			kind = NumberField
+		case reflect.String:
+			kind = StringField
+		default:
+			continue
+		}
+
+		_, editable := structField.Tag.Lookup("validate")
+
+		fields = append(fields, Field{Name: name, Key: key, Kind: kind, Editable: editable, index: i, bits: bits})
+	}
+
+	return fields
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
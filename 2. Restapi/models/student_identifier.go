@@ -0,0 +1,34 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The identifiers of a student in the apis, its ID or its roll number written "roll:<roll number>", e.g. "roll:A42"
+// The pattern is the one documented for the clients, the roll numbers follow the rules of the RollNumber attribute
+
+const StudentIdentifierPattern = `^([0-9a-fA-F]{24}|roll:[a-zA-Z0-9]{1,20})$`
+
+var studentIdentifier = regexp.MustCompile(StudentIdentifierPattern)
+
+type StudentIdentifier struct {
+	ID         primitive.ObjectID // set when the student is identified by its ID
+	RollNumber string             // set when it is identified by its roll number
+}
+
+// function to read a student identifier, false when it follows neither form
+func ParseStudentIdentifier(raw string) (StudentIdentifier, bool) {
+	if !studentIdentifier.MatchString(raw) {
+		return StudentIdentifier{}, false
+	}
+
+	if rollNumber, found := strings.CutPrefix(raw, "roll:"); found {
+		return StudentIdentifier{RollNumber: rollNumber}, true
+	}
+
+	id, err := primitive.ObjectIDFromHex(raw)
+	return StudentIdentifier{ID: id}, err == nil
+}
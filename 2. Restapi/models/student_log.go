@@ -0,0 +1,48 @@
+package models
+
+import (
+	"log/slog"
+	"reflect"
+)
+
+// Describing how a student is written in the logs, the personal data (the fields tagged log:"redact") is hidden
+// A student passed to a logger shows up with its json names, e.g. {"_id": ..., "name": "Ada", "dob": "[redacted]"}
+
+// the value written in place of a redacted field
+const Redacted = "[redacted]"
+
+// the json names of the redacted fields of the student model
+var redactedFields = describeRedacted(reflect.TypeOf(Student{}))
+
+func describeRedacted(t reflect.Type) map[string]bool {
+	redacted := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.Tag.Get("log") == "redact" {
+			redacted[tagName(field.Tag.Get("json"))] = true
+		}
+	}
+	return redacted
+}
+
+// function to tell whether an attribute of a student is kept out of the logs, by its json name
+// the loggers also use it to hide the attributes logged on their own, e.g. slog.String("address", ...)
+func IsRedacted(name string) bool {
+	return redactedFields[name]
+}
+
+// LogValue makes the loggers write a student with its personal data redacted
+func (s Student) LogValue() slog.Value {
+	value := reflect.ValueOf(s)
+
+	var attrs []slog.Attr
+	for i := 0; i < value.NumField(); i++ {
+		name := tagName(value.Type().Field(i).Tag.Get("json"))
+		if IsRedacted(name) {
+			attrs = append(attrs, slog.String(name, Redacted))
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, value.Field(i).Interface()))
+	}
+
+	return slog.GroupValue(attrs...)
+}
@@ -1,13 +1,33 @@
 package models
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 // The structure of the user model which is stored in the database
-// This doesnt include ID just because MongoDB creates it automatically for us
+// The ID is left empty on creation because MongoDB (or the in-memory store) assigns it for us
+// The dates are stored as real datetimes, the dob is written as "2006-01-02" in json
+// The roll number is optional, when it is set no other student can have the same one
+// it is stored even when it is empty, so that the filters and the sorting on it see every student
+// The fields tagged log:"redact" are personal data, they are never written in the logs (see student_log.go)
 
 type Student struct {
-	Name        string  `json:"name,omitempty" validate:"required"`
-	DOB         string  `json:"dob,omitempty" validate:"required"`
-	Percentage  float32 `json:"percentage,omitempty" validate:"required"`
-	Address     string  `json:"address,omitempty" validate:"required"`
-	Description string  `json:"description,omitempty" validate:"required"`
-	CreatedAt   string  `json:"createdAt,omitempty"`
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	RollNumber  string             `json:"rollNumber,omitempty" bson:"rollNumber" validate:"omitempty,alphanum,max=20"`
+	Name        string             `json:"name,omitempty" validate:"required"`
+	DOB         Date               `json:"dob" validate:"required,past" log:"redact"`
+	Percentage  float32            `json:"percentage,omitempty" validate:"required"`
+	Address     string             `json:"address,omitempty" validate:"required" log:"redact"`
+	Description string             `json:"description,omitempty" validate:"required"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt,omitempty"`
+
+	// incremented on every write, it is sent to the clients as the ETag of the student
+	// documents written before versioning existed do not have it and are read as version 0
+	Version int64 `json:"version" bson:"version,omitempty"`
+
+	// set when the student is moved to the trash, deleted students are hidden until they are restored or purged
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
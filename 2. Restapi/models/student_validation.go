@@ -0,0 +1,34 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// earliest date of birth which is accepted, anything before is a typo
+var earliestDOB = NewDate(1900, time.January, 1)
+
+// function to build the validator used for the models
+// on top of the built-in rules it knows how to read a Date and the "past" rule which only accepts dates before today
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+
+	// the errors name the fields the way the clients write them, e.g. "dob" rather than "DOB"
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return tagName(field.Tag.Get("json"))
+	})
+
+	// a Date is validated as the time it wraps, so that "required" rejects the zero date
+	validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(Date).Time
+	}, Date{})
+
+	validate.RegisterValidation("past", func(fl validator.FieldLevel) bool {
+		value, ok := fl.Field().Interface().(time.Time)
+		return ok && value.Before(time.Now()) && !value.Before(earliestDOB.Time)
+	})
+
+	return validate
+}
@@ -0,0 +1,136 @@
+// File containing the part of the OpenAPI 3.1 document model which the api uses
+// Only the fields which are filled somewhere are declared, everything else is left out of the document
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// version of the specification the documents follow
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path, keyed by lowercase method
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Style       string  `json:"style,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// function to create an empty document
+func NewDocument(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// function to read a document written as JSON, e.g. one committed along with the code
+func Parse(raw []byte) (*Document, error) {
+	var document Document
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("openapi: the document cannot be read: %w", err)
+	}
+	if document.OpenAPI != Version {
+		return nil, fmt.Errorf("openapi: the document follows version %q, expected %q", document.OpenAPI, Version)
+	}
+
+	return &document, nil
+}
+
+// function to add an operation to the document, the path is written the fiber way ("/student/:userId")
+func (d *Document) AddOperation(method string, path string, operation Operation) {
+	path = PathTemplate(path)
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+
+	(*item)[strings.ToLower(method)] = &operation
+}
+
+// function to list the operations of the document as "METHOD /path" entries, sorted
+func (d *Document) Operations() []string {
+	var operations []string
+	for path, item := range d.Paths {
+		for method := range *item {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(operations)
+	return operations
+}
+
+// function to turn a fiber path into an OpenAPI path template, ":userId" becomes "{userId}"
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?") + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,38 @@
+// File responsible for serving the document and the page documenting the api
+
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+//go:embed docs.html
+var docsPage string
+
+// function to build the handler sending the document, it is encoded once
+func Handler(document *Document) fiber.Handler {
+	raw, err := json.Marshal(document)
+
+	return func(c *fiber.Ctx) error {
+		if err != nil {
+			return err
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return c.Send(raw)
+	}
+}
+
+// function to build the handler sending the docs page, which reads the document from specURL
+func DocsHandler(specURL string) fiber.Handler {
+	page := strings.ReplaceAll(docsPage, "{{SPEC_URL}}", specURL)
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(page)
+	}
+}
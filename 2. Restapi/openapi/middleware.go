@@ -0,0 +1,244 @@
+// File responsible for enforcing the document on the requests, and in tests on the responses, of the api
+// The middleware of a route runs before its handlers, a request which does not follow the document never reaches them
+
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrUnsupportedMediaType is returned when a body is sent with a content type the operation does not accept
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// RequestError is a request which does not follow its operation
+// In tells which part of the request is wrong: "path", "query", "header" or "body"
+// a body which cannot be decoded at all comes without violations
+type RequestError struct {
+	In         string
+	Detail     string
+	Violations []Violation
+}
+
+func (e *RequestError) Error() string {
+	if len(e.Violations) == 0 {
+		return e.Detail
+	}
+
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Detail, strings.Join(messages, ", "))
+}
+
+// ResponseError is a response which does not follow its operation, it is a bug of the api
+type ResponseError struct {
+	Operation  string
+	Status     int
+	Detail     string
+	Violations []Violation
+}
+
+func (e *ResponseError) Error() string {
+	messages := []string{e.Detail}
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.String())
+	}
+	return fmt.Sprintf("the %d response of %s does not follow the api documentation: %s", e.Status, e.Operation, strings.Join(messages, ", "))
+}
+
+// function to build the middleware enforcing the operation registered for the method and the path (written the fiber way)
+// when checkResponses is set the responses are checked as well, which is meant for the tests as it costs a decoding of every response
+func (d *Document) Validator(method string, path string, checkResponses bool) fiber.Handler {
+	item, ok := d.Paths[PathTemplate(path)]
+	if !ok || (*item)[strings.ToLower(method)] == nil {
+		panic(fmt.Sprintf("openapi: %s %s is not documented", method, path))
+	}
+	operation := (*item)[strings.ToLower(method)]
+	name := method + " " + path
+
+	return func(c *fiber.Ctx) error {
+		if err := d.checkRequest(c, operation); err != nil {
+			return err
+		}
+
+		if !checkResponses {
+			return c.Next()
+		}
+
+		// the errors are rendered right away so that the problem responses are checked too
+		if err := c.Next(); err != nil {
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		return d.checkResponse(c, name, operation)
+	}
+}
+
+func (d *Document) checkRequest(c *fiber.Ctx, operation *Operation) error {
+	for _, in := range []string{"path", "query", "header"} {
+		var violations []Violation
+		for _, parameter := range operation.Parameters {
+			if parameter.In == in {
+				violations = append(violations, d.checkParameter(c, operation, parameter)...)
+			}
+		}
+
+		if len(violations) > 0 {
+			return &RequestError{In: in, Detail: fmt.Sprintf("the %s parameters do not follow the api documentation", in), Violations: violations}
+		}
+	}
+
+	if operation.RequestBody == nil {
+		return nil
+	}
+
+	body := c.Body()
+	if len(body) == 0 {
+		if operation.RequestBody.Required {
+			return &RequestError{In: "body", Detail: "the request body is required"}
+		}
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	media, ok := operation.RequestBody.Content[contentType]
+	if !ok {
+		accepted := make([]string, 0, len(operation.RequestBody.Content))
+		for name := range operation.RequestBody.Content {
+			accepted = append(accepted, name)
+		}
+		return fmt.Errorf("%w: the body must be sent as %s", ErrUnsupportedMediaType, strings.Join(accepted, " or "))
+	}
+
+	if !isJSON(contentType) {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return &RequestError{In: "body", Detail: fmt.Sprintf("the request body is not valid JSON: %s", err.Error())}
+	}
+
+	if violations := d.Check(media.Schema, value); len(violations) > 0 {
+		return &RequestError{In: "body", Detail: "the request body does not follow the api documentation", Violations: violations}
+	}
+
+	return nil
+}
+
+// function to check one parameter, the raw strings of the path, the query and the headers are converted to the type of their schema first
+func (d *Document) checkParameter(c *fiber.Ctx, operation *Operation, parameter Parameter) []Violation {
+	// an exploded object gathers all the query params which are not declared on their own, e.g. ?percentage_gte=80
+	if parameter.In == "query" && parameter.Explode != nil && *parameter.Explode && parameter.Schema.Type == "object" {
+		declared := map[string]bool{}
+		for _, other := range operation.Parameters {
+			declared[other.Name] = other.In == "query"
+		}
+
+		object := map[string]interface{}{}
+		c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+			if !declared[string(key)] {
+				object[string(key)] = string(value)
+			}
+		})
+		return d.Check(parameter.Schema, object)
+	}
+
+	var raw string
+	var present bool
+	switch parameter.In {
+	case "path":
+		raw = c.Params(parameter.Name)
+		present = raw != ""
+	case "query":
+		raw = c.Query(parameter.Name)
+		present = c.Context().QueryArgs().Has(parameter.Name)
+	case "header":
+		raw = c.Get(parameter.Name)
+		present = raw != ""
+	}
+
+	if !present {
+		if parameter.Required {
+			return []Violation{{Field: parameter.Name, Keyword: "required", Message: "is required"}}
+		}
+		return nil
+	}
+
+	var value interface{} = raw
+	switch types := schemaTypes(parameter.Schema); {
+	case len(types) == 0:
+	case types[0] == "integer" || types[0] == "number":
+		if number, err := strconv.ParseFloat(raw, 64); err == nil {
+			value = number
+		}
+	case types[0] == "boolean":
+		if boolean, err := strconv.ParseBool(raw); err == nil {
+			value = boolean
+		}
+	}
+
+	violations := d.Check(parameter.Schema, value)
+	for i := range violations {
+		violations[i].Field = join(parameter.Name, violations[i].Field)
+	}
+	return violations
+}
+
+func (d *Document) checkResponse(c *fiber.Ctx, name string, operation *Operation) error {
+	status := c.Response().StatusCode()
+
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = operation.Responses["default"]
+	}
+	if !ok {
+		return &ResponseError{Operation: name, Status: status, Detail: "the status is not documented"}
+	}
+
+	// a streamed body (e.g. server-sent events) is only written once the handler is over, reading it here would wait for its end
+	streamed := c.Response().IsBodyStream()
+	if len(response.Content) == 0 {
+		if streamed || len(c.Response().Body()) > 0 {
+			return &ResponseError{Operation: name, Status: status, Detail: "the response is documented without a body"}
+		}
+		return nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(string(c.Response().Header.ContentType()))
+	media, ok := response.Content[contentType]
+	if !ok {
+		return &ResponseError{Operation: name, Status: status, Detail: fmt.Sprintf("the content type %q is not documented", contentType)}
+	}
+
+	if !isJSON(contentType) || streamed {
+		return nil
+	}
+
+	body := c.Response().Body()
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return &ResponseError{Operation: name, Status: status, Detail: fmt.Sprintf("the body is not valid JSON: %s", err.Error())}
+	}
+
+	if violations := d.Check(media.Schema, value); len(violations) > 0 {
+		return &ResponseError{Operation: name, Status: status, Detail: "the body does not match its schema", Violations: violations}
+	}
+
+	return nil
+}
+
+// function to tell whether a media type holds JSON, e.g. application/json or application/merge-patch+json
+func isJSON(contentType string) bool {
+	return contentType == fiber.MIMEApplicationJSON || strings.HasSuffix(contentType, "+json")
+}
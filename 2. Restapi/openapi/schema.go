@@ -0,0 +1,247 @@
+// File responsible for describing the go structs as JSON schemas, out of their json and validate tags
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"my-rest-api/models"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Schema is a JSON Schema (2020-12, as used by OpenAPI 3.1)
+// Type is either a single type or a list of types, e.g. ["string", "null"]
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Examples             []interface{}      `json:"examples,omitempty"`
+
+	// the raw validate tag of a field, so that the clients can see the exact rules the server applies
+	Validate string `json:"x-validate,omitempty"`
+}
+
+// function to read a schema, a list of types is read as a []string like in the generated schemas
+func (s *Schema) UnmarshalJSON(raw []byte) error {
+	type plain Schema
+	var schema struct {
+		plain
+		Type json.RawMessage `json:"type,omitempty"`
+	}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return err
+	}
+	*s = Schema(schema.plain)
+
+	if len(schema.Type) == 0 {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(schema.Type, &single); err == nil {
+		s.Type = single
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(schema.Type, &types); err != nil {
+		return fmt.Errorf("the type of a schema is a string or a list of strings, got %s", schema.Type)
+	}
+	s.Type = types
+	return nil
+}
+
+// pattern of the IDs generated by MongoDB
+const ObjectIDPattern = "^[0-9a-fA-F]{24}$"
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+	dateType     = reflect.TypeOf(models.Date{})
+)
+
+// function to point at a schema of the components
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// function to describe an object made of the given properties, all of them required
+func Object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+
+	return schema
+}
+
+// function to register the schema of a struct in the components, under the given name
+// a struct whose fields carry validate rules is a model, the fields without rules are set by the server and marked read-only
+// the structs it refers to have to be registered before it to be referenced, otherwise they are inlined
+func (d *Document) Register(name string, v interface{}) *Schema {
+	d.Components.Schemas[name] = d.structSchema(reflect.TypeOf(v), false)
+	return Ref(name)
+}
+
+// function to register the schema of the attributes of a model which are sent by the clients, the ones with validate rules
+func (d *Document) RegisterInput(name string, v interface{}) *Schema {
+	d.Components.Schemas[name] = d.structSchema(reflect.TypeOf(v), true)
+	return Ref(name)
+}
+
+func (d *Document) structSchema(t reflect.Type, inputOnly bool) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	model := false
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("validate") != "" {
+			model = true
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		rules := field.Tag.Get("validate")
+		if inputOnly && rules == "" {
+			continue
+		}
+
+		property := d.typeSchema(field.Type)
+		if rules != "" {
+			if applyRules(property, rules) {
+				schema.Required = append(schema.Required, name)
+			}
+		} else if model {
+			property.ReadOnly = true
+		}
+
+		schema.Properties[name] = property
+	}
+
+	return schema
+}
+
+// function to describe a go type, the registered structs are referenced
+func (d *Document) typeSchema(t reflect.Type) *Schema {
+	switch t {
+	case objectIDType:
+		return &Schema{Type: "string", Pattern: ObjectIDPattern}
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case dateType:
+		return &Schema{Type: "string", Format: "date", Examples: []interface{}{"2002-12-01"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := d.typeSchema(t.Elem())
+		if typeName, ok := schema.Type.(string); ok {
+			schema.Type = []string{typeName, "null"}
+		}
+		return schema
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer()
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return ArrayOf(d.typeSchema(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.typeSchema(t.Elem())}
+	case reflect.Struct:
+		for name := range d.Components.Schemas {
+			if name == t.Name() {
+				return Ref(name)
+			}
+		}
+		return d.structSchema(t, false)
+	}
+
+	// interface{} can hold anything
+	return &Schema{}
+}
+
+// function to translate the validate rules of a field into JSON schema keywords
+// it returns whether the field is required
+func applyRules(schema *Schema, rules string) bool {
+	schema.Validate = rules
+
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+
+		switch tag {
+		case "required":
+			required = true
+		case "alphanum":
+			schema.Pattern = "^[a-zA-Z0-9]*$"
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		case "past":
+			schema.Description = "a date in the past, no earlier than 1900-01-01"
+		case "min", "max":
+			bound, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+
+			if schema.Type == "string" {
+				length := int(bound)
+				if tag == "min" {
+					schema.MinLength = &length
+				} else {
+					schema.MaxLength = &length
+				}
+			} else if tag == "min" {
+				schema.Minimum = &bound
+			} else {
+				schema.Maximum = &bound
+			}
+		}
+	}
+
+	return required
+}
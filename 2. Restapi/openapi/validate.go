@@ -0,0 +1,220 @@
+// File responsible for checking JSON values against the schemas of a document
+// Only the keywords which the schemas of the api use are checked
+
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Violation is a value which does not follow its schema
+type Violation struct {
+	Field   string // where the value is, e.g. "percentage", "limit" or "data.changes[0].field"
+	Keyword string // the keyword of the schema which is broken, e.g. "required"
+	Param   string // the value of the keyword, e.g. "number" for "type"
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.Message
+	}
+	return v.Field + " " + v.Message
+}
+
+// the compiled patterns of the schemas, they are compiled the first time they are used
+var patterns sync.Map
+
+// function to check a decoded JSON value (as read by encoding/json into an interface{}) against a schema
+func (d *Document) Check(schema *Schema, value interface{}) []Violation {
+	var violations []Violation
+	d.check(schema, value, "", &violations)
+	return violations
+}
+
+func (d *Document) check(schema *Schema, value interface{}, field string, violations *[]Violation) {
+	if schema == nil {
+		return
+	}
+
+	if schema.Ref != "" {
+		d.check(d.resolve(schema.Ref), value, field, violations)
+		return
+	}
+
+	report := func(keyword string, param string, message string, args ...interface{}) {
+		*violations = append(*violations, Violation{Field: field, Keyword: keyword, Param: param, Message: fmt.Sprintf(message, args...)})
+	}
+
+	actual := jsonType(value)
+	if types := schemaTypes(schema); len(types) > 0 && !matchesType(types, value) {
+		expected := strings.Join(types, " or ")
+		report("type", expected, "must be a %s, got a %s", expected, actual)
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			values := fmt.Sprint(schema.Enum)
+			report("enum", strings.Trim(values, "[]"), "must be one of %s", values)
+		}
+	}
+
+	if len(schema.OneOf) > 0 {
+		matched := 0
+		for _, option := range schema.OneOf {
+			if len(d.Check(option, value)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			report("oneOf", "", "must match exactly one of %d schemas, matches %d", len(schema.OneOf), matched)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if schema.Format != "" && !matchesFormat(schema.Format, v) {
+			report("format", schema.Format, "must be a %s", formatNames[schema.Format])
+		}
+		if schema.Pattern != "" && !pattern(schema.Pattern).MatchString(v) {
+			report("pattern", schema.Pattern, "must match %s", schema.Pattern)
+		}
+		length := len([]rune(v))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			report("minLength", strconv.Itoa(*schema.MinLength), "must be at least %d characters long", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			report("maxLength", strconv.Itoa(*schema.MaxLength), "must be at most %d characters long", *schema.MaxLength)
+		}
+
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			report("minimum", fmt.Sprint(*schema.Minimum), "must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			report("maximum", fmt.Sprint(*schema.Maximum), "must be at most %v", *schema.Maximum)
+		}
+
+	case []interface{}:
+		for i, item := range v {
+			d.check(schema.Items, item, fmt.Sprintf("%s[%d]", field, i), violations)
+		}
+
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*violations = append(*violations, Violation{Field: join(field, name), Keyword: "required", Message: "is required"})
+			}
+		}
+
+		for name, property := range v {
+			if propertySchema, ok := schema.Properties[name]; ok {
+				d.check(propertySchema, property, join(field, name), violations)
+			} else {
+				d.check(schema.AdditionalProperties, property, join(field, name), violations)
+			}
+		}
+	}
+}
+
+// function to find a schema of the components from its reference
+func (d *Document) resolve(ref string) *Schema {
+	schema, ok := d.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	if !ok {
+		panic(fmt.Sprintf("openapi: the schema %s is referenced but not registered", ref))
+	}
+	return schema
+}
+
+func join(field string, name string) string {
+	if field == "" || name == "" {
+		return field + name
+	}
+	return field + "." + name
+}
+
+func pattern(expr string) *regexp.Regexp {
+	if compiled, ok := patterns.Load(expr); ok {
+		return compiled.(*regexp.Regexp)
+	}
+
+	compiled := regexp.MustCompile(expr)
+	patterns.Store(expr, compiled)
+	return compiled
+}
+
+// function to list the types a schema accepts, none means any type
+func schemaTypes(schema *Schema) []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := jsonType(value)
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// function to name the JSON type of a decoded value, a number without a fraction is an integer
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// what the formats look like, for the messages
+var formatNames = map[string]string{
+	"date":      "date formatted as YYYY-MM-DD",
+	"date-time": "date and time formatted as RFC 3339",
+}
+
+func matchesFormat(format string, value string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	}
+
+	// the formats which are not known are only annotations
+	return true
+}
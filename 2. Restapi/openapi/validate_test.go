@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type pet struct {
+	Name string   `json:"name" validate:"required,max=5"`
+	Kind string   `json:"kind" validate:"required,oneof=cat dog"`
+	Tags []string `json:"tags,omitempty" validate:"omitempty"`
+}
+
+func decode(t *testing.T, raw string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestCheck(t *testing.T) {
+	doc := NewDocument(Info{Title: "pets", Version: "1"})
+	doc.Register("Pet", pet{})
+	doc.Components.Schemas["Visit"] = Object(map[string]*Schema{
+		"pet": Ref("Pet"),
+		"at":  {Type: "string", Format: "date-time"},
+		"day": {Type: "string", Format: "date"},
+	})
+
+	tests := []struct {
+		description string
+		schema      string
+		value       string
+		expected    []Violation
+	}{
+		{"a valid pet", "Pet", `{"name":"Rex","kind":"dog","tags":["good"]}`, nil},
+		{"missing attributes", "Pet", `{}`, []Violation{
+			{Field: "name", Keyword: "required", Message: "is required"},
+			{Field: "kind", Keyword: "required", Message: "is required"},
+		}},
+		{"wrong type", "Pet", `{"name":5,"kind":"dog"}`, []Violation{
+			{Field: "name", Keyword: "type", Param: "string", Message: "must be a string, got a integer"},
+		}},
+		{"rules of the validate tags", "Pet", `{"name":"Rexxxxx","kind":"bird"}`, []Violation{
+			{Field: "name", Keyword: "maxLength", Param: "5", Message: "must be at most 5 characters long"},
+			{Field: "kind", Keyword: "enum", Param: "cat dog", Message: "must be one of [cat dog]"},
+		}},
+		{"items of an array", "Pet", `{"name":"Rex","kind":"dog","tags":["good", 1]}`, []Violation{
+			{Field: "tags[1]", Keyword: "type", Param: "string", Message: "must be a string, got a integer"},
+		}},
+		{"referenced schema and formats", "Visit", `{"pet":{"name":"Rex"},"at":"2020-01-01","day":"2002-02-30"}`, []Violation{
+			{Field: "pet.kind", Keyword: "required", Message: "is required"},
+			{Field: "at", Keyword: "format", Param: "date-time", Message: "must be a date and time formatted as RFC 3339"},
+			{Field: "day", Keyword: "format", Param: "date", Message: "must be a date formatted as YYYY-MM-DD"},
+		}},
+		{"not an object", "Visit", `[]`, []Violation{
+			{Keyword: "type", Param: "object", Message: "must be a object, got a array"},
+		}},
+	}
+
+	for _, test := range tests {
+		violations := doc.Check(Ref(test.schema), decode(t, test.value))
+		assert.ElementsMatchf(t, test.expected, violations, test.description)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	doc := NewDocument(Info{Title: "pets", Version: "1"})
+	doc.Register("Pet", pet{})
+	doc.AddOperation("POST", "/pets/:owner", Operation{
+		OperationID: "createPet",
+		Parameters: []Parameter{
+			{Name: "owner", In: "path", Required: true, Schema: &Schema{Type: "string", Pattern: "^[a-z]+$"}},
+			{Name: "count", In: "query", Schema: &Schema{Type: "integer", Minimum: new(float64)}},
+		},
+		RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: Ref("Pet")}}},
+		Responses: map[string]Response{
+			"201": {Description: "created", Content: map[string]MediaType{"application/json": {Schema: Ref("Pet")}}},
+		},
+	})
+
+	var failed error
+	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
+		failed = err
+		return fiber.DefaultErrorHandler(c, err)
+	}})
+
+	// the handler answers with the pet it gets, or with a pet missing its kind when asked to
+	app.Post("/pets/:owner", doc.Validator("POST", "/pets/:owner", true), func(c *fiber.Ctx) error {
+		if c.Query("broken") != "" {
+			return c.Status(201).JSON(fiber.Map{"name": "Rex"})
+		}
+		if c.Query("status") != "" {
+			return c.SendStatus(204)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(201).Send(c.Body())
+	})
+
+	send := func(route string, contentType string, body string) int {
+		failed = nil
+		req := httptest.NewRequest("POST", route, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, _ := app.Test(req)
+		return resp.StatusCode
+	}
+
+	var requestErr *RequestError
+	var responseErr *ResponseError
+	pet := `{"name":"Rex","kind":"dog"}`
+
+	assert.Equal(t, 201, send("/pets/ada", "application/json", pet))
+	assert.Nil(t, failed)
+
+	send("/pets/Ada", "application/json", pet)
+	if assert.True(t, errors.As(failed, &requestErr), "a path parameter breaking its pattern") {
+		assert.Equal(t, "path", requestErr.In)
+		assert.Equal(t, "owner", requestErr.Violations[0].Field)
+	}
+
+	send("/pets/ada?count=-1", "application/json", pet)
+	if assert.True(t, errors.As(failed, &requestErr), "a query parameter below its minimum") {
+		assert.Equal(t, "query", requestErr.In)
+		assert.Equal(t, Violation{Field: "count", Keyword: "minimum", Param: "0", Message: "must be at least 0"}, requestErr.Violations[0])
+	}
+
+	send("/pets/ada?count=many", "application/json", pet)
+	if assert.True(t, errors.As(failed, &requestErr), "a query parameter which is not a number") {
+		assert.Equal(t, "type", requestErr.Violations[0].Keyword)
+	}
+
+	send("/pets/ada", "application/json", `{"name":"Rex"}`)
+	if assert.True(t, errors.As(failed, &requestErr), "a body breaking its schema") {
+		assert.Equal(t, "body", requestErr.In)
+		assert.Equal(t, "kind", requestErr.Violations[0].Field)
+	}
+
+	send("/pets/ada", "application/json", `{"name":`)
+	if assert.True(t, errors.As(failed, &requestErr), "a body which is not JSON") {
+		assert.Empty(t, requestErr.Violations)
+	}
+
+	send("/pets/ada", "text/plain", pet)
+	assert.True(t, errors.Is(failed, ErrUnsupportedMediaType))
+
+	assert.Equal(t, 500, send("/pets/ada?broken=1", "application/json", pet))
+	if assert.True(t, errors.As(failed, &responseErr), "a response breaking its schema") {
+		assert.Equal(t, "kind", responseErr.Violations[0].Field)
+	}
+
+	assert.Equal(t, 500, send("/pets/ada?status=1", "application/json", pet))
+	if assert.True(t, errors.As(failed, &responseErr), "a status which is not documented") {
+		assert.Equal(t, 204, responseErr.Status)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := NewDocument(Info{Title: "pets", Version: "1"})
+	doc.Register("Pet", pet{})
+	doc.Components.Schemas["Name"] = &Schema{Type: []string{"string", "null"}}
+
+	raw, _ := json.Marshal(doc)
+	parsed, err := Parse(raw)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the document reads back as it was generated, a list of types included
+	assert.Equal(t, doc, parsed)
+	assert.Empty(t, parsed.Check(Ref("Name"), nil))
+	assert.NotEmpty(t, parsed.Check(Ref("Name"), 42.0))
+
+	_, err = Parse([]byte(`{"openapi":"3.0.3"}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"openapi":"3.1.0","components":{"schemas":{"Pet":{"type":42}}}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,345 @@
+// File containing the storage of the audit log and the StudentRepository decorator which fills it
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"my-rest-api/models"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// error returned when a student has no audit entry for the requested version
+var ErrAuditEntryNotFound = errors.New("audit entry not found")
+
+// AuditRepository stores the audit entries of the students
+type AuditRepository interface {
+	// Record stores a new entry
+	Record(ctx context.Context, entry models.AuditEntry) error
+
+	// History returns every entry of a student, the latest first
+	History(ctx context.Context, studentID primitive.ObjectID) ([]models.AuditEntry, error)
+
+	// Get returns the entry which brought a student to the given version
+	Get(ctx context.Context, studentID primitive.ObjectID, version int64) (models.AuditEntry, error)
+
+	// Since returns at most limit entries with an ID after the given one, in the order of their IDs
+	// the IDs are generated by the instances of the api, so an entry may be written after some with later IDs
+	// and the readers have to go over the latest entries again (see ChangeFeed)
+	Since(ctx context.Context, after primitive.ObjectID, limit int) ([]models.AuditEntry, error)
+}
+
+// keys of the values the audit needs from the request context
+type auditContextKey int
+
+const (
+	actorKey auditContextKey = iota
+	actionKey
+)
+
+// function to remember who is making the changes, the audited repository records it along with them
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// function to record the next write under another action than the default one of the method, e.g. a revert
+func WithAuditAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, actionKey, action)
+}
+
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+func actionFrom(ctx context.Context, fallback string) string {
+	if action, ok := ctx.Value(actionKey).(string); ok && action != "" {
+		return action
+	}
+	return fallback
+}
+
+// AuditedStudentRepository writes an audit entry for every change made through the wrapped repository
+type AuditedStudentRepository struct {
+	StudentRepository
+	audit AuditRepository
+}
+
+// making sure the decorator keeps satisfying the interface
+var _ StudentRepository = (*AuditedStudentRepository)(nil)
+
+// function to wrap a student repository so that every change made through it is audited
+func NewAuditedStudentRepository(students StudentRepository, audit AuditRepository) *AuditedStudentRepository {
+	return &AuditedStudentRepository{StudentRepository: students, audit: audit}
+}
+
+func (r *AuditedStudentRepository) Create(ctx context.Context, student models.Student) (models.Student, error) {
+	created, err := r.StudentRepository.Create(ctx, student)
+	if err == nil {
+		r.record(ctx, models.ActionCreate, models.Student{}, created)
+	}
+
+	return created, err
+}
+
+func (r *AuditedStudentRepository) Update(ctx context.Context, id primitive.ObjectID, student models.Student, version int64) (models.Student, error) {
+	var updated models.Student
+	before, err := r.pinned(ctx, id, version, func(version int64) (err error) {
+		updated, err = r.StudentRepository.Update(ctx, id, student, version)
+		return err
+	})
+	if err == nil {
+		r.record(ctx, models.ActionUpdate, before, updated)
+	}
+
+	return updated, err
+}
+
+func (r *AuditedStudentRepository) Patch(ctx context.Context, id primitive.ObjectID, student models.Student, fields []models.Field, version int64) (models.Student, error) {
+	var patched models.Student
+	before, err := r.pinned(ctx, id, version, func(version int64) (err error) {
+		patched, err = r.StudentRepository.Patch(ctx, id, student, fields, version)
+		return err
+	})
+
+	// a patch which does not change anything does not bump the version and is not recorded
+	if err == nil && patched.Version != before.Version {
+		r.record(ctx, models.ActionPatch, before, patched)
+	}
+
+	return patched, err
+}
+
+func (r *AuditedStudentRepository) Delete(ctx context.Context, id primitive.ObjectID, version int64) (models.Student, error) {
+	var deleted models.Student
+	before, err := r.pinned(ctx, id, version, func(version int64) (err error) {
+		deleted, err = r.StudentRepository.Delete(ctx, id, version)
+		return err
+	})
+	if err == nil {
+		r.record(ctx, models.ActionDelete, before, deleted)
+	}
+
+	return deleted, err
+}
+
+func (r *AuditedStudentRepository) Restore(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	restored, err := r.StudentRepository.Restore(ctx, id)
+	if err != nil {
+		return restored, err
+	}
+
+	// a restore only takes the deletedAt away, the other attributes are the same as before
+	// the deleted student cannot be read anymore, when it was deleted is found in the entry of its deletion
+	before := restored
+	if deletion, err := r.audit.Get(ctx, id, restored.Version-1); err == nil {
+		before.DeletedAt = deletion.Snapshot.DeletedAt
+	}
+	r.record(ctx, models.ActionRestore, before, restored)
+
+	return restored, nil
+}
+
+// how many times a write is made again when the student was changed between reading it and writing it
+const pinnedWriteRetries = 3
+
+// function to make a write on the student as it was just read, which is returned as the state the write replaced
+// the write is pinned to the version which was read, so it fails rather than replacing a state which was not read
+// when the caller did not ask for a version, a concurrent change only makes the student be read again
+func (r *AuditedStudentRepository) pinned(ctx context.Context, id primitive.ObjectID, version int64, write func(version int64) error) (models.Student, error) {
+	for attempt := 0; ; attempt++ {
+		before, err := r.StudentRepository.Get(ctx, id)
+		if err != nil {
+			return models.Student{}, err
+		}
+
+		expected := version
+		if expected == AnyVersion {
+			expected = before.Version
+		}
+
+		err = write(expected)
+		if errors.Is(err, ErrVersionConflict) && version == AnyVersion && attempt < pinnedWriteRetries {
+			continue
+		}
+		return before, err
+	}
+}
+
+// function to write an audit entry for a change which already happened
+// a failure is only logged, the change itself cannot be undone anymore
+func (r *AuditedStudentRepository) record(ctx context.Context, action string, before models.Student, after models.Student) {
+	entry := models.AuditEntry{
+		StudentID: after.ID,
+		Version:   after.Version,
+		Action:    actionFrom(ctx, action),
+		Actor:     actorFrom(ctx),
+		At:        now(),
+		Changes:   models.Diff(before, after),
+		Snapshot:  after,
+	}
+
+	if err := r.audit.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "could not record a change in the audit log", "action", action, "student_id", after.ID.Hex(), "error", err)
+	}
+}
+
+// MongoAuditRepository stores the audit entries in their own collection
+type MongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+var _ AuditRepository = (*MongoAuditRepository)(nil)
+
+// function to create an audit repository on top of an existing collection
+func NewMongoAuditRepository(collection *mongo.Collection) *MongoAuditRepository {
+	return &MongoAuditRepository{collection: collection}
+}
+
+// function to create the index used to look up the history of a student
+func (r *MongoAuditRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "studentId", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetName("audit_student_version"),
+	})
+	return err
+}
+
+func (r *MongoAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+func (r *MongoAuditRepository) History(ctx context.Context, studentID primitive.ObjectID) ([]models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}, {Key: "_id", Value: -1}})
+
+	results, err := r.collection.Find(ctx, bson.M{"studentId": studentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditEntry{}
+	if err := results.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *MongoAuditRepository) Get(ctx context.Context, studentID primitive.ObjectID, version int64) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+
+	err := r.collection.FindOne(ctx, bson.M{"studentId": studentID, "version": version}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.AuditEntry{}, ErrAuditEntryNotFound
+	}
+
+	return entry, err
+}
+
+// the IDs generated by the driver start with the time they were created at, so they roughly follow the order of the writes
+func (r *MongoAuditRepository) Since(ctx context.Context, after primitive.ObjectID, limit int) ([]models.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	results, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditEntry{}
+	if err := results.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// MemoryAuditRepository keeps the audit entries in memory, used by the tests and for running offline
+type MemoryAuditRepository struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry
+}
+
+var _ AuditRepository = (*MemoryAuditRepository)(nil)
+
+// function to create an empty in-memory audit repository
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// an entry which comes with an ID keeps it, like one generated by another instance a moment before it got to write it
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	r.entries = append(r.entries, entry)
+
+	return nil
+}
+
+func (r *MemoryAuditRepository) History(ctx context.Context, studentID primitive.ObjectID) ([]models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+	for _, entry := range r.entries {
+		if entry.StudentID == studentID {
+			entries = append(entries, entry)
+		}
+	}
+
+	// latest first, the entries are stored in the order they were written
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Version > entries[j].Version
+	})
+
+	return entries, nil
+}
+
+func (r *MemoryAuditRepository) Get(ctx context.Context, studentID primitive.ObjectID, version int64) (models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, entry := range r.entries {
+		if entry.StudentID == studentID && entry.Version == version {
+			return entry, nil
+		}
+	}
+
+	return models.AuditEntry{}, ErrAuditEntryNotFound
+}
+
+func (r *MemoryAuditRepository) Since(ctx context.Context, after primitive.ObjectID, limit int) ([]models.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// the entries are stored in the order they were written, which is not always the order of their IDs
+	entries := []models.AuditEntry{}
+	for _, entry := range r.entries {
+		if bytes.Compare(entry.ID[:], after[:]) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].ID[:], entries[j].ID[:]) < 0
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
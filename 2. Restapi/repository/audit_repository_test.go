@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"my-rest-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// repository in which another client renames the student right after it is read, once
+type racingRepository struct {
+	StudentRepository
+	rename string
+}
+
+func (r *racingRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	student, err := r.StudentRepository.Get(ctx, id)
+	if err == nil && r.rename != "" {
+		renamed := student
+		renamed.Name, r.rename = r.rename, ""
+		r.StudentRepository.Update(ctx, id, renamed, AnyVersion)
+	}
+	return student, err
+}
+
+func TestAuditedWritesRecordTheStateTheyReplaced(t *testing.T) {
+	ctx := context.Background()
+	inner := &racingRepository{StudentRepository: NewMemoryStudentRepository()}
+	audit := NewMemoryAuditRepository()
+	students := NewAuditedStudentRepository(inner, audit)
+
+	created, _ := students.Create(ctx, newStudent())
+
+	// the student is read again once it changed, the change recorded is the one from the rename
+	inner.rename = "Grace"
+	update := newStudent()
+	update.Name = "Ada Lovelace"
+	updated, err := students.Update(ctx, created.ID, update, AnyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+
+	entry, err := audit.Get(ctx, created.ID, updated.Version)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []models.FieldChange{{Field: "name", Before: "Grace", After: "Ada Lovelace"}}, entry.Changes)
+	}
+
+	// the caller who asked for a version is told about the change instead
+	inner.rename = "Grace"
+	_, err = students.Update(ctx, created.ID, newStudent(), updated.Version)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
+func TestAuditedDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	audit := NewMemoryAuditRepository()
+	students := NewAuditedStudentRepository(NewMemoryStudentRepository(), audit)
+
+	created, _ := students.Create(ctx, newStudent())
+	deleted, err := students.Delete(ctx, created.ID, AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	restored, err := students.Restore(ctx, created.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the deletion is the change of both entries
+	history, _ := audit.History(ctx, created.ID)
+	if assert.Len(t, history, 3) {
+		restore, deletion := history[0], history[1]
+		assert.Equal(t, restored.Version, restore.Version)
+
+		// the entry of the deletion holds the student as it was stored, not a copy rebuilt next to it
+		assert.Equal(t, deleted, deletion.Snapshot)
+
+		if assert.Len(t, deletion.Changes, 1) {
+			assert.Equal(t, "deletedAt", deletion.Changes[0].Field)
+			assert.Nil(t, deletion.Changes[0].Before)
+			assert.Equal(t, *deletion.Snapshot.DeletedAt, deletion.Changes[0].After)
+		}
+		assert.Equal(t, []models.FieldChange{{Field: "deletedAt", Before: *deletion.Snapshot.DeletedAt, After: nil}}, restore.Changes)
+	}
+}
@@ -0,0 +1,171 @@
+// File containing the decorator reading the students by ID through a cache
+
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"my-rest-api/cache"
+	"my-rest-api/metrics"
+	"my-rest-api/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/sync/singleflight"
+)
+
+// how long the load of a missed student may take, the callers waiting on it give up earlier with their own context
+const cacheLoadTimeout = 5 * time.Second
+
+// CachedStudentRepository reads the students by ID through a cache, the other reads go to the wrapped repository
+// every write made through it removes the student from the cache, whatever its outcome, since a failed write
+// (e.g. a version conflict) may be the sign that the cached student is stale
+// a failure of the cache is logged and the request goes on with the wrapped repository
+type CachedStudentRepository struct {
+	StudentRepository
+	cache cache.Cache
+
+	// the concurrent misses of a student are collapsed into one load
+	loads singleflight.Group
+
+	// bumped by every write, a student loaded while a write was made is not cached as it may be stale already
+	// the lock makes the check and the caching of a loaded student happen all before or all after an invalidation
+	mu         sync.Mutex
+	generation uint64
+}
+
+// making sure the decorator keeps satisfying the interface
+var _ StudentRepository = (*CachedStudentRepository)(nil)
+
+// function to wrap a student repository so that the students read by ID are cached
+// the writes have to go through the decorator for the cache to stay up to date
+func NewCachedStudentRepository(students StudentRepository, cache cache.Cache) *CachedStudentRepository {
+	return &CachedStudentRepository{StudentRepository: students, cache: cache}
+}
+
+// function to get a student from the cache, or from the wrapped repository when it is not cached
+// the students which do not exist are not cached
+// the callers waiting on the load of the same student share its outcome
+// the load does not end with the request which started it, the others waiting on it would get its cancellation
+func (r *CachedStudentRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	key := cacheKey(id)
+
+	if student, ok := r.lookup(ctx, key); ok {
+		return student, nil
+	}
+
+	loads := r.loads.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+
+		r.mu.Lock()
+		generation := r.generation
+		r.mu.Unlock()
+
+		metrics.CacheLoad()
+		student, err := r.StudentRepository.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		r.store(ctx, key, student, generation)
+		return student, nil
+	})
+
+	select {
+	case loaded := <-loads:
+		if loaded.Err != nil {
+			return models.Student{}, loaded.Err
+		}
+		return loaded.Val.(models.Student), nil
+	case <-ctx.Done():
+		return models.Student{}, ctx.Err()
+	}
+}
+
+func (r *CachedStudentRepository) Update(ctx context.Context, id primitive.ObjectID, student models.Student, version int64) (models.Student, error) {
+	defer r.invalidate(ctx, id)
+	return r.StudentRepository.Update(ctx, id, student, version)
+}
+
+func (r *CachedStudentRepository) Patch(ctx context.Context, id primitive.ObjectID, student models.Student, fields []models.Field, version int64) (models.Student, error) {
+	defer r.invalidate(ctx, id)
+	return r.StudentRepository.Patch(ctx, id, student, fields, version)
+}
+
+func (r *CachedStudentRepository) Delete(ctx context.Context, id primitive.ObjectID, version int64) (models.Student, error) {
+	defer r.invalidate(ctx, id)
+	return r.StudentRepository.Delete(ctx, id, version)
+}
+
+func (r *CachedStudentRepository) Restore(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	defer r.invalidate(ctx, id)
+	return r.StudentRepository.Restore(ctx, id)
+}
+
+// function to get the repository under the cache of a student repository, or the repository itself when it is not cached
+// the checks which must not be answered with a stale student (e.g. the preconditions of the writes) read through it
+func Uncached(students StudentRepository) StudentRepository {
+	if cached, ok := students.(*CachedStudentRepository); ok {
+		return cached.StudentRepository
+	}
+	return students
+}
+
+// the key of a student in the cache, the cache may be shared with other applications
+func cacheKey(id primitive.ObjectID) string {
+	return "student-api:student:" + id.Hex()
+}
+
+// function to read a student out of the cache, a value which cannot be read counts as a miss
+func (r *CachedStudentRepository) lookup(ctx context.Context, key string) (models.Student, bool) {
+	var student models.Student
+
+	raw, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		metrics.CacheError("get")
+		slog.WarnContext(ctx, "could not read from the cache", "key", key, "error", err)
+	}
+	if ok {
+		ok = bson.Unmarshal(raw, &student) == nil
+	}
+
+	metrics.CacheLookup(ok)
+	return student, ok
+}
+
+// function to cache a loaded student, unless a write was made since the load started
+func (r *CachedStudentRepository) store(ctx context.Context, key string, student models.Student, generation uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+		return
+	}
+
+	raw, err := bson.Marshal(student)
+	if err == nil {
+		err = r.cache.Set(ctx, key, raw)
+	}
+	if err != nil {
+		metrics.CacheError("set")
+		slog.WarnContext(ctx, "could not write to the cache", "key", key, "error", err)
+	}
+}
+
+// function to remove a student from the cache once it was written
+// the student stays stale in the cache until it expires when this fails, so it is logged as an error
+// bumping the generation is enough to keep the loads under way from caching the student, the cache is not called under the lock
+func (r *CachedStudentRepository) invalidate(ctx context.Context, id primitive.ObjectID) {
+	r.mu.Lock()
+	r.generation++
+	r.mu.Unlock()
+
+	key := cacheKey(id)
+	if err := r.cache.Delete(ctx, key); err != nil {
+		metrics.CacheError("delete")
+		slog.ErrorContext(ctx, "could not remove a student from the cache, it is stale until it expires", "key", key, "error", err)
+	}
+}
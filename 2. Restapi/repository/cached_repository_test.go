@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"my-rest-api/cache"
+	"my-rest-api/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// repository counting the lookups by ID, which can be held back until the test releases them
+type countingRepository struct {
+	StudentRepository
+
+	mu      sync.Mutex
+	gets    int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *countingRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	r.mu.Lock()
+	r.gets++
+	r.mu.Unlock()
+
+	if r.release != nil {
+		r.started <- struct{}{}
+		<-r.release
+	}
+	return r.StudentRepository.Get(ctx, id)
+}
+
+func (r *countingRepository) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gets
+}
+
+// cache whose operations all fail, like a Redis server which cannot be reached
+type brokenCache struct{}
+
+func (brokenCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("down")
+}
+func (brokenCache) Set(context.Context, string, []byte) error { return errors.New("down") }
+func (brokenCache) Delete(context.Context, string) error      { return errors.New("down") }
+
+func newStudent() models.Student {
+	dob, _ := models.ParseDate("2001-02-03")
+	return models.Student{Name: "Ada", DOB: dob, Percentage: 90, Address: "London", Description: "Go Developer"}
+}
+
+func TestCachedStudentRepository(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepository{StudentRepository: NewMemoryStudentRepository()}
+	students := NewCachedStudentRepository(inner, cache.NewLRU(10, time.Minute))
+
+	created, err := students.Create(ctx, newStudent())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the student is loaded once, then read from the cache as it was stored
+	for i := 0; i < 3; i++ {
+		student, err := students.Get(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, created.Name, student.Name)
+		assert.Equal(t, created.Version, student.Version)
+		assert.True(t, created.CreatedAt.Equal(student.CreatedAt))
+	}
+	assert.Equal(t, 1, inner.count())
+
+	// a write removes the student from the cache
+	update := newStudent()
+	update.Name = "Ada Lovelace"
+	_, err = students.Update(ctx, created.ID, update, AnyVersion)
+	assert.NoError(t, err)
+
+	student, _ := students.Get(ctx, created.ID)
+	assert.Equal(t, "Ada Lovelace", student.Name)
+	assert.Equal(t, 2, inner.count())
+
+	// a failed write does too, the cached student may be the reason it failed
+	_, err = students.Update(ctx, created.ID, update, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	students.Get(ctx, created.ID)
+	assert.Equal(t, 3, inner.count())
+
+	// a deleted student is not found anymore, and the students which are not found are not cached
+	_, err = students.Delete(ctx, created.ID, AnyVersion)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = students.Get(ctx, created.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 5, inner.count())
+}
+
+func TestCachedStudentRepositoryCollapsesMisses(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepository{StudentRepository: NewMemoryStudentRepository()}
+	students := NewCachedStudentRepository(inner, cache.NewLRU(10, time.Minute))
+	created, _ := students.Create(ctx, newStudent())
+
+	inner.started, inner.release = make(chan struct{}, 1), make(chan struct{})
+
+	var wg sync.WaitGroup
+	get := func() {
+		defer wg.Done()
+		student, err := students.Get(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, created.ID, student.ID)
+	}
+
+	// the first miss loads the student, the ones made meanwhile wait for it instead of loading it again
+	wg.Add(1)
+	go get()
+	<-inner.started
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go get()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, inner.count())
+}
+
+func TestCachedStudentRepositoryOutlivesTheFirstCaller(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepository{StudentRepository: NewMemoryStudentRepository()}
+	students := NewCachedStudentRepository(inner, cache.NewLRU(10, time.Minute))
+	created, _ := students.Create(ctx, newStudent())
+
+	inner.started, inner.release = make(chan struct{}, 1), make(chan struct{})
+
+	// the caller which started the load goes away, the ones waiting on it still get the student
+	first, cancel := context.WithCancel(ctx)
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := students.Get(first, created.ID)
+		canceled <- err
+	}()
+	<-inner.started
+
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := students.Get(ctx, created.ID)
+		loaded <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+	close(inner.release)
+	assert.NoError(t, <-loaded)
+	assert.Equal(t, 1, inner.count())
+}
+
+func TestCachedStudentRepositorySkipsStaleLoads(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepository{StudentRepository: NewMemoryStudentRepository()}
+	students := NewCachedStudentRepository(inner, cache.NewLRU(10, time.Minute))
+	created, _ := students.Create(ctx, newStudent())
+
+	// the student is written while it is being loaded, what was loaded may be stale and is not cached
+	inner.started, inner.release = make(chan struct{}, 1), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		students.Get(ctx, created.ID)
+	}()
+	<-inner.started
+
+	update := newStudent()
+	update.Name = "Ada Lovelace"
+	students.Update(ctx, created.ID, update, AnyVersion)
+	close(inner.release)
+	<-done
+
+	inner.release = nil
+	student, _ := students.Get(ctx, created.ID)
+	assert.Equal(t, "Ada Lovelace", student.Name)
+	assert.Equal(t, 2, inner.count())
+}
+
+func TestCachedStudentRepositoryWithoutCache(t *testing.T) {
+	ctx := context.Background()
+	students := NewCachedStudentRepository(NewMemoryStudentRepository(), brokenCache{})
+
+	// the requests go on without the cache when it fails
+	created, _ := students.Create(ctx, newStudent())
+	student, err := students.Get(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, student.ID)
+
+	_, err = students.Update(ctx, created.ID, newStudent(), AnyVersion)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,495 @@
+// File responsible for following the changes made to the students, out of their change stream or the audit log
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// how many entries are read from the audit log at once
+const feedBatchSize = 100
+
+// how many changes wait for a follower still sending the previous ones, a follower further behind is ended
+const feedBuffer = 256
+
+// how many batches a resumed change stream may come back empty before it reached the changes of the loop
+// it gives up after them and the audit log is read instead
+const feedResumeBatches = 10
+
+// how far back the audit log is read again every time the feed checks it for new entries
+// the IDs of the entries are generated by the instances of the api when they write them, so an entry can show up
+// after some with later IDs: the time between generating an ID and the write being visible, plus the drift
+// between the clocks of the instances, has to stay below it
+const feedOverlap = 10 * time.Second
+
+// error returned by the student stores which cannot push their changes, e.g. on a standalone MongoDB server
+var ErrWatchUnsupported = errors.New("the students cannot be watched")
+
+// error ending a follower which could not keep up with the changes, it can resume after the last one it sent
+var ErrFeedBehind = errors.New("the follower fell behind the change feed")
+
+// StudentWatcher is implemented by the student stores which can push their changes as they are written
+// the writes which do not go through the api (a purge, a migration, ...) are pushed as well
+type StudentWatcher interface {
+	// Watch opens a stream of the changes written after the given resume token, or from now on without one
+	// ErrWatchUnsupported means the storage cannot do it
+	Watch(ctx context.Context, resumeAfter string) (StudentStream, error)
+}
+
+// StudentStream hands over the changes made to the students in the order they were written, described as audit entries
+// every change comes with the token resuming a stream right after it
+type StudentStream interface {
+	// Next waits for the next change until the context is done
+	Next(ctx context.Context) (models.AuditEntry, string, error)
+
+	// TryNext hands over the next change if it is written already, false means the batch the stream read was empty,
+	// which does not mean the stream has read every change up to now (see Reached)
+	TryNext(ctx context.Context) (models.AuditEntry, string, bool, error)
+
+	// Reached tells up to which cluster time the stream has read the changes, false when it cannot tell
+	Reached() (primitive.Timestamp, bool)
+
+	Close(ctx context.Context) error
+}
+
+// FeedPositionPattern is the id of an event of the feed: the ID of its entry, followed by the resume token
+// of the change stream when the feed was watching the students
+const FeedPositionPattern = `^[0-9a-fA-F]{24}(\.[0-9a-fA-F]{1,512})?$`
+
+var feedPosition = regexp.MustCompile(FeedPositionPattern)
+
+// FeedPosition is where a follower of the feed is, the last entry it got
+type FeedPosition struct {
+	After primitive.ObjectID
+	Token string
+}
+
+// function to read the id of an event back into a position, false when it is not one
+func ParseFeedPosition(raw string) (FeedPosition, bool) {
+	if !feedPosition.MatchString(raw) {
+		return FeedPosition{}, false
+	}
+
+	hex, token, _ := strings.Cut(raw, ".")
+	after, _ := primitive.ObjectIDFromHex(hex)
+	return FeedPosition{After: after, Token: token}, true
+}
+
+func (p FeedPosition) String() string {
+	if p.Token == "" {
+		return p.After.Hex()
+	}
+	return p.After.Hex() + "." + p.Token
+}
+
+// Change is an entry of the audit log handed over by the feed, along with the position right after it
+type Change struct {
+	Entry    models.AuditEntry
+	Position FeedPosition
+}
+
+// ChangeFeed hands over the changes made to the students as they are written
+// it waits on the change stream of the students when they can be watched, and polls the audit log otherwise,
+// either way the clients can resume from the last change they saw
+// the changes are read by a single loop for all the followers of the process, it runs while there is one
+type ChangeFeed struct {
+	audit    AuditRepository
+	watcher  StudentWatcher
+	interval time.Duration
+
+	// set once the students turned out not to be watchable, so that it is not tried on every call
+	polling atomic.Bool
+
+	mu   sync.Mutex
+	loop *feedLoop
+}
+
+// feedLoop reads the new changes once and hands them to every follower
+type feedLoop struct {
+	cancel    context.CancelFunc
+	followers map[*follower]bool
+
+	// the cluster time the change stream of the loop has read up to, the changes after it go to every follower
+	reached      primitive.Timestamp
+	reachedKnown bool
+}
+
+// follower is one of the callers of Follow, err tells why once changes is closed
+type follower struct {
+	changes chan Change
+	err     error
+
+	// where the loop was when the follower joined it, a resumed change stream catches up to there
+	until      primitive.Timestamp
+	untilKnown bool
+}
+
+// function to create a feed of the changes made to the students
+// they are watched when watcher is set and can be, otherwise the audit log is checked for new entries every interval
+func NewChangeFeed(audit AuditRepository, watcher StudentWatcher, interval time.Duration) *ChangeFeed {
+	return &ChangeFeed{audit: audit, watcher: watcher, interval: interval}
+}
+
+// function to send every change made after the given position, then the new ones as they come, until the context is done
+// without a position only the changes made from now on are sent
+// a position with a token resumes the change stream right after it, without one the audit log is read again
+// from shortly before it, and the changes of these moments may be sent twice
+// it stops at the first error of send or of the audit log, and with ErrFeedBehind when send cannot keep up
+func (f *ChangeFeed) Follow(ctx context.Context, from FeedPosition, send func(Change) error) error {
+	follower, err := f.subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	defer f.unsubscribe(follower)
+
+	// the loop was started first, so it may hand over again some of the changes sent while catching up
+	sent := map[primitive.ObjectID]bool{}
+	if !from.After.IsZero() {
+		subscribed := now()
+		err := f.catchUp(ctx, from, follower, func(change Change) error {
+			sent[change.Entry.ID] = true
+			return send(change)
+		})
+		if err != nil {
+			return err
+		}
+
+		// the loop only hands over the entries written since, none of them has a much older ID
+		oldest := subscribed.Add(-feedOverlap)
+		for id := range sent {
+			if id.Timestamp().Before(oldest) {
+				delete(sent, id)
+			}
+		}
+	}
+
+	for {
+		select {
+		case change, ok := <-follower.changes:
+			if !ok {
+				return follower.err
+			}
+			if sent[change.Entry.ID] {
+				continue
+			}
+			if err := send(change); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// function to send the changes made after a position, the ones made since the follower subscribed come from the loop as well
+// the change stream is resumed after the token of the position when there is one, the audit log is read again otherwise
+func (f *ChangeFeed) catchUp(ctx context.Context, from FeedPosition, follower *follower, send func(Change) error) error {
+	if f.watcher != nil && from.Token != "" && !f.polling.Load() {
+		err := f.resume(ctx, from, follower, send)
+		if !errors.Is(err, errCannotResume) {
+			return err
+		}
+
+		// e.g. a token older than the history MongoDB keeps
+		slog.WarnContext(ctx, "the change stream cannot be resumed, the audit log is read again instead", "error", err)
+	}
+
+	return f.read(ctx, newFeedCursor(from.After), func(entry models.AuditEntry) error {
+		return send(Change{Entry: entry, Position: FeedPosition{After: entry.ID}})
+	})
+}
+
+// error of a change stream which cannot be resumed up to where the loop was, the audit log is read instead
+var errCannotResume = errors.New("the change stream cannot be resumed")
+
+// function to read the change stream resumed after a position until it reaches where the loop was when the follower joined it
+// a batch may come back empty before that, so it goes on until the position of the stream tells it is there
+func (f *ChangeFeed) resume(ctx context.Context, from FeedPosition, follower *follower, send func(Change) error) error {
+	if !follower.untilKnown {
+		return fmt.Errorf("%w: the position of the change feed is not known", errCannotResume)
+	}
+
+	stream, err := f.watcher.Watch(ctx, from.Token)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCannotResume, err)
+	}
+	defer stream.Close(context.Background())
+
+	for empty := 0; ; {
+		entry, token, ok, err := stream.TryNext(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errCannotResume, err)
+		}
+
+		if ok {
+			if err := send(Change{Entry: entry, Position: FeedPosition{After: entry.ID, Token: token}}); err != nil {
+				return err
+			}
+		} else if empty++; empty > feedResumeBatches {
+			return fmt.Errorf("%w: it came back empty %d times before it caught up", errCannotResume, feedResumeBatches)
+		}
+
+		reached, known := stream.Reached()
+		if !known {
+			return fmt.Errorf("%w: its position is not known", errCannotResume)
+		}
+		if primitive.CompareTimestamp(reached, follower.until) >= 0 {
+			return nil
+		}
+	}
+}
+
+// function to add a follower to the loop, the first one starts it
+// it returns once the loop reads the changes, so that no change made from then on is missed
+func (f *ChangeFeed) subscribe(ctx context.Context) (*follower, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.loop == nil {
+		loop, err := f.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+		f.loop = loop
+	}
+
+	follower := &follower{changes: make(chan Change, feedBuffer), until: f.loop.reached, untilKnown: f.loop.reachedKnown}
+	f.loop.followers[follower] = true
+	return follower, nil
+}
+
+func (f *ChangeFeed) unsubscribe(follower *follower) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.loop != nil && f.loop.followers[follower] {
+		f.drop(f.loop, follower, nil)
+	}
+}
+
+// function to remove a follower from a loop, the loop stops with its last follower
+// it has to be called with the lock held
+func (f *ChangeFeed) drop(loop *feedLoop, follower *follower, err error) {
+	delete(loop.followers, follower)
+	if err != nil {
+		follower.err = err
+		close(follower.changes)
+	}
+
+	if len(loop.followers) == 0 && f.loop == loop {
+		loop.cancel()
+		f.loop = nil
+	}
+}
+
+// function to start the loop, on the change stream of the students when they can be watched and polling the audit log otherwise
+// it has to be called with the lock held, the loop outlives the follower starting it
+func (f *ChangeFeed) start(ctx context.Context) (*feedLoop, error) {
+	loopCtx, cancel := context.WithCancel(context.Background())
+	loop := &feedLoop{cancel: cancel, followers: map[*follower]bool{}}
+
+	if f.watcher != nil && !f.polling.Load() {
+		stream, err := f.watcher.Watch(ctx, "")
+		if err == nil {
+			loop.reached, loop.reachedKnown = stream.Reached()
+			go f.run(loop, func() error {
+				defer stream.Close(context.Background())
+				return f.watch(loopCtx, stream, loop)
+			})
+			return loop, nil
+		}
+		if !errors.Is(err, ErrWatchUnsupported) {
+			cancel()
+			return nil, err
+		}
+
+		f.polling.Store(true)
+		slog.WarnContext(ctx, "the students cannot be watched, the change feed polls the audit log instead", "error", err)
+	}
+
+	// the entries already written are not handed over, the ones still being written are
+	cursor := newFeedCursor(primitive.NewObjectIDFromTimestamp(now()))
+	if err := f.read(ctx, cursor, func(models.AuditEntry) error { return nil }); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go f.run(loop, func() error {
+		return f.poll(loopCtx, cursor, loop)
+	})
+	return loop, nil
+}
+
+// function to run a loop until it fails or stops, the followers left are ended with its error
+func (f *ChangeFeed) run(loop *feedLoop, read func() error) {
+	err := read()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for follower := range loop.followers {
+		f.drop(loop, follower, err)
+	}
+	loop.cancel()
+}
+
+// function to hand a change to every follower of a loop, the ones which cannot take it are ended
+func (f *ChangeFeed) hand(loop *feedLoop, change Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for follower := range loop.followers {
+		select {
+		case follower.changes <- change:
+		default:
+			f.drop(loop, follower, ErrFeedBehind)
+		}
+	}
+}
+
+// function to hand over the changes the change stream brings
+// the loop moves past a change before handing it, so a follower joining in between gets it one way or the other
+func (f *ChangeFeed) watch(ctx context.Context, stream StudentStream, loop *feedLoop) error {
+	for {
+		entry, token, err := stream.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		loop.reached, loop.reachedKnown = stream.Reached()
+		f.mu.Unlock()
+
+		f.hand(loop, Change{Entry: entry, Position: FeedPosition{After: entry.ID, Token: token}})
+	}
+}
+
+// function to check the audit log for new entries every interval
+func (f *ChangeFeed) poll(ctx context.Context, cursor *feedCursor, loop *feedLoop) error {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := f.read(ctx, cursor, func(entry models.AuditEntry) error {
+			f.hand(loop, Change{Entry: entry, Position: FeedPosition{After: entry.ID}})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// function to send every entry the audit log holds from the start of the cursor on, except the ones already sent
+func (f *ChangeFeed) read(ctx context.Context, cursor *feedCursor, send func(models.AuditEntry) error) error {
+	from := cursor.start()
+	for {
+		entries, err := f.audit.Since(ctx, from, feedBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			from = entry.ID
+			if cursor.sent[entry.ID] {
+				continue
+			}
+
+			if err := send(entry); err != nil {
+				return err
+			}
+			cursor.add(entry.ID)
+		}
+
+		// a full batch means there is more to catch up on, the next one is read right away
+		if len(entries) < feedBatchSize {
+			return nil
+		}
+	}
+}
+
+// feedCursor is where a reader of the audit log is, when it polls it
+// it remembers the entries sent within feedOverlap of the latest one, the ones the next read goes over again
+type feedCursor struct {
+	latest primitive.ObjectID
+	sent   map[primitive.ObjectID]bool
+}
+
+func newFeedCursor(after primitive.ObjectID) *feedCursor {
+	cursor := &feedCursor{latest: after, sent: map[primitive.ObjectID]bool{}}
+	if !after.IsZero() {
+		cursor.sent[after] = true
+	}
+	return cursor
+}
+
+// function to give the ID the audit log is read after
+func (c *feedCursor) start() primitive.ObjectID {
+	from := c.latest.Timestamp().Add(-feedOverlap)
+	if from.Unix() <= 0 {
+		return primitive.NilObjectID
+	}
+	return primitive.NewObjectIDFromTimestamp(from)
+}
+
+// function to remember an entry sent, the ones which fell out of the overlap are forgotten
+func (c *feedCursor) add(id primitive.ObjectID) {
+	c.sent[id] = true
+	if bytes.Compare(id[:], c.latest[:]) <= 0 {
+		return
+	}
+
+	// the IDs only tell the second they were generated at, nothing falls out before the next one
+	previous := c.latest
+	c.latest = id
+	if !id.Timestamp().After(previous.Timestamp()) {
+		return
+	}
+
+	oldest := c.latest.Timestamp().Add(-feedOverlap)
+	for sent := range c.sent {
+		if sent.Timestamp().Before(oldest) {
+			delete(c.sent, sent)
+		}
+	}
+}
+
+// ChangeFilter picks the entries of the feed a client is interested in, the zero value keeps all of them
+type ChangeFilter struct {
+	// the actions kept, all of them when empty
+	Actions []string
+
+	// the student right after the change has to match the conditions and the filter expression, like in a list
+	// a purge only carries the ID of the student, so it is kept when only the actions are filtered
+	Conditions []Condition
+	Filter     filters.Expr
+}
+
+// function to tell whether an entry of the feed is kept by the filter
+func (f ChangeFilter) Match(entry models.AuditEntry) bool {
+	if len(f.Actions) > 0 && !slices.Contains(f.Actions, entry.Action) {
+		return false
+	}
+
+	return matchesConditions(entry.Snapshot, f.Conditions) && (f.Filter == nil || filters.Match(f.Filter, entry.Snapshot))
+}
@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// audit log pushing the entries it records to its streams as well, like the change stream of the students on a replica set
+// the token of an entry is its place in the log, in hexadecimal, and so is the cluster time a stream reached
+type watchableAudit struct {
+	*MemoryAuditRepository
+
+	// whether it behaves like a standalone server, which cannot be watched
+	unsupported bool
+
+	// how many empty batches the resumed streams read before the entries they have to catch up on
+	stalls int
+
+	mu      sync.Mutex
+	watches int
+	pushed  []models.AuditEntry
+	broken  error
+
+	// closed and replaced on every change, the streams wait on it
+	changed chan struct{}
+}
+
+func newWatchableAudit(unsupported bool) *watchableAudit {
+	return &watchableAudit{MemoryAuditRepository: NewMemoryAuditRepository(), unsupported: unsupported, changed: make(chan struct{})}
+}
+
+func (a *watchableAudit) Record(ctx context.Context, entry models.AuditEntry) error {
+	if err := a.MemoryAuditRepository.Record(ctx, entry); err != nil {
+		return err
+	}
+
+	a.MemoryAuditRepository.mu.RLock()
+	recorded := a.entries[len(a.entries)-1]
+	a.MemoryAuditRepository.mu.RUnlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pushed = append(a.pushed, recorded)
+	close(a.changed)
+	a.changed = make(chan struct{})
+	return nil
+}
+
+// function to break the streams, like the collection being dropped
+func (a *watchableAudit) fail(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.broken = err
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *watchableAudit) Watch(ctx context.Context, resumeAfter string) (StudentStream, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.watches++
+	if a.unsupported {
+		return nil, ErrWatchUnsupported
+	}
+
+	stream := &logStream{audit: a, next: len(a.pushed)}
+	if resumeAfter != "" {
+		place, err := strconv.ParseInt(resumeAfter, 16, 64)
+		if err != nil || int(place) > len(a.pushed) {
+			return nil, errors.New("the resume token is not in the log")
+		}
+		stream.next = int(place)
+		stream.stalls = a.stalls
+	}
+	return stream, nil
+}
+
+func (a *watchableAudit) watchCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.watches
+}
+
+type logStream struct {
+	audit  *watchableAudit
+	next   int
+	stalls int
+}
+
+// function to take the next entry of the log, or the channel telling when there is one
+func (s *logStream) take() (models.AuditEntry, string, <-chan struct{}, error) {
+	s.audit.mu.Lock()
+	defer s.audit.mu.Unlock()
+
+	if s.audit.broken != nil {
+		return models.AuditEntry{}, "", nil, s.audit.broken
+	}
+	if s.next == len(s.audit.pushed) {
+		return models.AuditEntry{}, "", s.audit.changed, nil
+	}
+
+	s.next++
+	return s.audit.pushed[s.next-1], strconv.FormatInt(int64(s.next), 16), nil, nil
+}
+
+func (s *logStream) Next(ctx context.Context) (models.AuditEntry, string, error) {
+	for {
+		entry, token, changed, err := s.take()
+		if err != nil || changed == nil {
+			return entry, token, err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return models.AuditEntry{}, "", ctx.Err()
+		}
+	}
+}
+
+func (s *logStream) TryNext(ctx context.Context) (models.AuditEntry, string, bool, error) {
+	if s.stalls > 0 {
+		s.stalls--
+		return models.AuditEntry{}, "", false, nil
+	}
+
+	entry, token, changed, err := s.take()
+	return entry, token, err == nil && changed == nil, err
+}
+
+func (s *logStream) Reached() (primitive.Timestamp, bool) {
+	return primitive.Timestamp{T: uint32(s.next)}, true
+}
+
+func (s *logStream) Close(context.Context) error {
+	return nil
+}
+
+// function to follow a feed from a position until count changes were sent
+func follow(t *testing.T, feed *ChangeFeed, from FeedPosition, count int) []Change {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var changes []Change
+	stop := errors.New("stop")
+	err := feed.Follow(ctx, from, func(change Change) error {
+		changes = append(changes, change)
+		if len(changes) == count {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+
+	return changes
+}
+
+// function to follow a feed from the beginning until count changes were sent, it gives their actions
+func followUntil(t *testing.T, feed *ChangeFeed, count int) []string {
+	var actions []string
+	for _, change := range follow(t, feed, FeedPosition{After: primitive.NewObjectIDFromTimestamp(time.Unix(1, 0))}, count) {
+		actions = append(actions, change.Entry.Action)
+	}
+	return actions
+}
+
+// function to count the followers of the loop of a feed, -1 when it does not run
+func followers(feed *ChangeFeed) int {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	if feed.loop == nil {
+		return -1
+	}
+	return len(feed.loop.followers)
+}
+
+func TestChangeFeedWatch(t *testing.T) {
+	ctx := context.Background()
+	audit := newWatchableAudit(false)
+	feed := NewChangeFeed(audit, audit, time.Hour)
+
+	// the entry written before the stream was opened is caught up on, the update comes from the stream
+	audit.Record(ctx, models.AuditEntry{Action: models.ActionCreate})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		audit.Record(ctx, models.AuditEntry{Action: models.ActionUpdate})
+	}()
+
+	// without a change stream the update would only be seen after an hour of polling
+	assert.Equal(t, []string{models.ActionCreate, models.ActionUpdate}, followUntil(t, feed, 2))
+	assert.Equal(t, 1, audit.watchCount())
+	assert.Equal(t, -1, followers(feed), "the loop stops with its last follower")
+}
+
+func TestChangeFeedPollsWhenItCannotWatch(t *testing.T) {
+	ctx := context.Background()
+	audit := newWatchableAudit(true)
+	feed := NewChangeFeed(audit, audit, 10*time.Millisecond)
+
+	audit.Record(ctx, models.AuditEntry{Action: models.ActionCreate})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		audit.Record(ctx, models.AuditEntry{Action: models.ActionDelete})
+	}()
+	assert.Equal(t, []string{models.ActionCreate, models.ActionDelete}, followUntil(t, feed, 2))
+
+	// the audit log is not tried again once it turned out it cannot be watched
+	followUntil(t, feed, 1)
+	assert.Equal(t, 1, audit.watchCount())
+}
+
+func TestChangeFeedResumesTheStream(t *testing.T) {
+	ctx := context.Background()
+	audit := newWatchableAudit(false)
+	feed := NewChangeFeed(audit, audit, time.Hour)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		for _, action := range []string{models.ActionCreate, models.ActionUpdate, models.ActionDelete} {
+			audit.Record(ctx, models.AuditEntry{Action: action})
+		}
+	}()
+	changes := follow(t, feed, FeedPosition{}, 3)
+	if !assert.Len(t, changes, 3) || !assert.NotEmpty(t, changes[1].Position.Token) {
+		return
+	}
+
+	// the stream picks up right after the update, the audit log is not read again
+	resumed := follow(t, feed, changes[1].Position, 1)
+	if assert.Len(t, resumed, 1) {
+		assert.Equal(t, changes[2].Entry.ID, resumed[0].Entry.ID)
+		assert.Equal(t, changes[2].Position, resumed[0].Position)
+	}
+
+	// without a token, or with one which cannot be resumed, the entries written shortly before are sent again
+	for _, from := range []FeedPosition{{After: changes[1].Entry.ID}, {After: changes[1].Entry.ID, Token: "ff"}} {
+		var actions []string
+		for _, change := range follow(t, feed, from, 2) {
+			actions = append(actions, change.Entry.Action)
+		}
+		assert.Equal(t, []string{models.ActionCreate, models.ActionDelete}, actions)
+	}
+}
+
+// a batch of the resumed stream may come back empty before it reached the changes the loop hands over
+func TestChangeFeedResumesPastEmptyBatches(t *testing.T) {
+	ctx := context.Background()
+	audit := newWatchableAudit(false)
+	feed := NewChangeFeed(audit, audit, time.Hour)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		for _, action := range []string{models.ActionCreate, models.ActionUpdate, models.ActionDelete} {
+			audit.Record(ctx, models.AuditEntry{Action: action})
+		}
+	}()
+	changes := follow(t, feed, FeedPosition{}, 3)
+	if !assert.Len(t, changes, 3) {
+		return
+	}
+
+	audit.stalls = 2
+	resumed := follow(t, feed, changes[0].Position, 2)
+	if assert.Len(t, resumed, 2) {
+		assert.Equal(t, []primitive.ObjectID{changes[1].Entry.ID, changes[2].Entry.ID}, []primitive.ObjectID{resumed[0].Entry.ID, resumed[1].Entry.ID})
+	}
+
+	// a stream which keeps coming back empty is given up on, the audit log is read instead
+	audit.stalls = feedResumeBatches + 1
+	var actions []string
+	for _, change := range follow(t, feed, changes[1].Position, 2) {
+		actions = append(actions, change.Entry.Action)
+	}
+	assert.Equal(t, []string{models.ActionCreate, models.ActionDelete}, actions)
+}
+
+func TestChangeFeedSharesOneLoop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	audit := newWatchableAudit(false)
+	feed := NewChangeFeed(audit, audit, time.Hour)
+
+	received := make(chan string)
+	var done sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			feed.Follow(ctx, FeedPosition{}, func(change Change) error {
+				received <- change.Entry.Action
+				return nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool { return followers(feed) == 3 }, time.Second, time.Millisecond)
+
+	audit.Record(ctx, models.AuditEntry{Action: models.ActionCreate})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, models.ActionCreate, <-received)
+	}
+	assert.Equal(t, 1, audit.watchCount(), "the followers share one change stream")
+
+	cancel()
+	done.Wait()
+	assert.Equal(t, -1, followers(feed))
+}
+
+func TestChangeFeedEndsTheFollowers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	audit := newWatchableAudit(false)
+	feed := NewChangeFeed(audit, audit, time.Hour)
+
+	// a follower which cannot keep up is ended without holding back the others
+	unblock := make(chan struct{})
+	slow := make(chan error, 1)
+	go func() {
+		slow <- feed.Follow(ctx, FeedPosition{}, func(Change) error {
+			<-unblock
+			return nil
+		})
+	}()
+	assert.Eventually(t, func() bool { return followers(feed) == 1 }, time.Second, time.Millisecond)
+
+	for i := 0; i < feedBuffer+2; i++ {
+		audit.Record(ctx, models.AuditEntry{Action: models.ActionUpdate})
+	}
+	assert.Eventually(t, func() bool { return followers(feed) == -1 }, time.Second, time.Millisecond)
+	close(unblock)
+	assert.ErrorIs(t, <-slow, ErrFeedBehind)
+
+	// every follower is ended with the error of the stream
+	failed := make(chan error, 1)
+	go func() {
+		failed <- feed.Follow(ctx, FeedPosition{}, func(Change) error { return nil })
+	}()
+	assert.Eventually(t, func() bool { return followers(feed) == 1 }, time.Second, time.Millisecond)
+
+	broken := errors.New("the collection was dropped")
+	audit.fail(broken)
+	assert.ErrorIs(t, <-failed, broken)
+}
+
+// the IDs are generated by the instances before they write the entries, so an entry may show up after some with later IDs
+func TestChangeFeedLateEntries(t *testing.T) {
+	for _, unsupported := range []bool{false, true} {
+		t.Run(map[bool]string{false: "watching", true: "polling"}[unsupported], func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			audit := newWatchableAudit(unsupported)
+			feed := NewChangeFeed(audit, audit, 10*time.Millisecond)
+
+			received := make(chan models.AuditEntry)
+			go feed.Follow(ctx, FeedPosition{After: primitive.NewObjectIDFromTimestamp(time.Unix(1, 0))}, func(change Change) error {
+				select {
+				case received <- change.Entry:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+
+			next := func() string {
+				select {
+				case entry := <-received:
+					return entry.Action
+				case <-time.After(200 * time.Millisecond):
+					return ""
+				}
+			}
+
+			audit.Record(ctx, models.AuditEntry{Action: models.ActionCreate})
+			assert.Equal(t, models.ActionCreate, next())
+
+			audit.Record(ctx, models.AuditEntry{ID: primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Second)), Action: models.ActionUpdate})
+			assert.Equal(t, models.ActionUpdate, next())
+
+			audit.Record(ctx, models.AuditEntry{Action: models.ActionDelete})
+			assert.Equal(t, models.ActionDelete, next())
+			assert.Empty(t, next(), "every entry is sent once")
+		})
+	}
+}
+
+func TestParseFeedPosition(t *testing.T) {
+	id := primitive.NewObjectID()
+	for raw, want := range map[string]FeedPosition{
+		id.Hex():             {After: id},
+		id.Hex() + ".82AB01": {After: id, Token: "82AB01"},
+	} {
+		position, ok := ParseFeedPosition(raw)
+		assert.True(t, ok, raw)
+		assert.Equal(t, want, position)
+		assert.Equal(t, raw, position.String())
+	}
+
+	for _, raw := range []string{"", "nope", id.Hex() + ".", id.Hex() + ".token", id.Hex()[1:] + ".82AB01"} {
+		_, ok := ParseFeedPosition(raw)
+		assert.False(t, ok, raw)
+	}
+}
+
+func TestChangeFilter(t *testing.T) {
+	entry := models.AuditEntry{Action: models.ActionUpdate, Snapshot: models.Student{Name: "Ada", Address: "Paris", Percentage: 80}}
+	field, _ := models.LookupField("percentage")
+	expr, err := filters.Compile(`address = "Paris"`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		description string
+		filter      ChangeFilter
+		expected    bool
+	}{
+		{description: "no filter", filter: ChangeFilter{}, expected: true},
+		{description: "one of the actions", filter: ChangeFilter{Actions: []string{models.ActionCreate, models.ActionUpdate}}, expected: true},
+		{description: "another action", filter: ChangeFilter{Actions: []string{models.ActionDelete}}, expected: false},
+		{description: "a matching condition", filter: ChangeFilter{Conditions: []Condition{{Field: field, Op: OpGte, Value: 80.0}}}, expected: true},
+		{description: "a condition which does not match", filter: ChangeFilter{Conditions: []Condition{{Field: field, Op: OpGt, Value: 90.0}}}, expected: false},
+		{description: "a matching expression", filter: ChangeFilter{Filter: expr}, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.filter.Match(entry))
+		})
+	}
+}
@@ -0,0 +1,393 @@
+// File containing an in-memory implementation of the StudentRepository, used by the tests and for running offline
+
+package repository
+
+import (
+	"context"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// making sure the implementation keeps satisfying the interface
+var _ StudentRepository = (*MemoryStudentRepository)(nil)
+
+type MemoryStudentRepository struct {
+	mu       sync.RWMutex
+	students map[primitive.ObjectID]models.Student
+
+	// IDs in insertion order so that List is stable like a collection scan
+	order []primitive.ObjectID
+}
+
+// function to create an empty in-memory repository
+func NewMemoryStudentRepository() *MemoryStudentRepository {
+	return &MemoryStudentRepository{students: map[primitive.ObjectID]models.Student{}}
+}
+
+func (r *MemoryStudentRepository) Create(ctx context.Context, student models.Student) (models.Student, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rollNumberTaken(student.RollNumber, primitive.NilObjectID) {
+		return models.Student{}, ErrDuplicate
+	}
+
+	student.ID = primitive.NewObjectID()
+	student.Version = 1
+	student.CreatedAt = now()
+	student.UpdatedAt = student.CreatedAt
+	r.students[student.ID] = student
+	r.order = append(r.order, student.ID)
+
+	return student, nil
+}
+
+func (r *MemoryStudentRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	student, ok := r.students[id]
+	if !ok || student.DeletedAt != nil {
+		return models.Student{}, ErrNotFound
+	}
+
+	return student, nil
+}
+
+func (r *MemoryStudentRepository) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]models.Student, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	students := []models.Student{}
+	for _, id := range ids {
+		if student, ok := r.students[id]; ok && student.DeletedAt == nil {
+			students = append(students, student)
+		}
+	}
+
+	return students, nil
+}
+
+func (r *MemoryStudentRepository) FindByRollNumber(ctx context.Context, rollNumber string) (models.Student, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, id := range r.order {
+		if student := r.students[id]; student.RollNumber == rollNumber && student.DeletedAt == nil {
+			return student, nil
+		}
+	}
+
+	return models.Student{}, ErrNotFound
+}
+
+func (r *MemoryStudentRepository) Update(ctx context.Context, id primitive.ObjectID, student models.Student, version int64) (models.Student, error) {
+	// only the editable attributes are overwritten, createdAt is left as it is
+	var editable []models.Field
+	for _, field := range models.StudentFields {
+		if field.Editable {
+			editable = append(editable, field)
+		}
+	}
+
+	return r.Patch(ctx, id, student, editable, version)
+}
+
+func (r *MemoryStudentRepository) Patch(ctx context.Context, id primitive.ObjectID, student models.Student, fields []models.Field, version int64) (models.Student, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lookup(id, version)
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	// nothing to write, the version is left as it is like in mongo
+	if len(fields) == 0 {
+		return existing, nil
+	}
+
+	for _, field := range fields {
+		field.Copy(&existing, student)
+	}
+
+	if r.rollNumberTaken(existing.RollNumber, id) {
+		return models.Student{}, ErrDuplicate
+	}
+
+	existing.UpdatedAt = now()
+	existing.Version++
+	r.students[id] = existing
+
+	return existing, nil
+}
+
+func (r *MemoryStudentRepository) Delete(ctx context.Context, id primitive.ObjectID, version int64) (models.Student, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lookup(id, version)
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	// moving the student to the trash instead of removing it
+	deletedAt := now()
+	existing.DeletedAt = &deletedAt
+	existing.UpdatedAt = deletedAt
+	existing.Version++
+	r.students[id] = existing
+
+	return existing, nil
+}
+
+func (r *MemoryStudentRepository) Restore(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.students[id]
+	if !ok || existing.DeletedAt == nil {
+		return models.Student{}, ErrNotFound
+	}
+
+	existing.DeletedAt = nil
+	existing.UpdatedAt = now()
+	existing.Version++
+	r.students[id] = existing
+
+	return existing, nil
+}
+
+func (r *MemoryStudentRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	order := r.order[:0]
+	for _, id := range r.order {
+		if deletedAt := r.students[id].DeletedAt; deletedAt != nil && deletedAt.Before(deletedBefore) {
+			delete(r.students, id)
+			purged++
+			continue
+		}
+		order = append(order, id)
+	}
+	r.order = order
+
+	return purged, nil
+}
+
+// function to tell whether a student other than the given one has the roll number, like the unique index of mongo
+// the deleted students keep their roll number until they are purged
+// it must be called with the lock held
+func (r *MemoryStudentRepository) rollNumberTaken(rollNumber string, except primitive.ObjectID) bool {
+	if rollNumber == "" {
+		return false
+	}
+
+	for id, student := range r.students {
+		if id != except && student.RollNumber == rollNumber {
+			return true
+		}
+	}
+
+	return false
+}
+
+// function to fetch a student which is about to be written, checking its version
+// the students in the trash cannot be written
+// it must be called with the lock held
+func (r *MemoryStudentRepository) lookup(id primitive.ObjectID, version int64) (models.Student, error) {
+	existing, ok := r.students[id]
+	if !ok || existing.DeletedAt != nil {
+		return models.Student{}, ErrNotFound
+	}
+
+	if version != AnyVersion && existing.Version != version {
+		return models.Student{}, ErrVersionConflict
+	}
+
+	return existing, nil
+}
+
+func (r *MemoryStudentRepository) List(ctx context.Context, query ListQuery) (Page, error) {
+	return r.list(query, false)
+}
+
+func (r *MemoryStudentRepository) ListTrash(ctx context.Context, query ListQuery) (Page, error) {
+	return r.list(query, true)
+}
+
+// function to run a list query either on the live students or on the trash
+func (r *MemoryStudentRepository) list(query ListQuery, deleted bool) (Page, error) {
+	var afterValues []interface{}
+	var afterID primitive.ObjectID
+	if query.Cursor != "" {
+		var err error
+		if afterValues, afterID, err = query.decodeCursor(); err != nil {
+			return Page{}, err
+		}
+	}
+
+	r.mu.RLock()
+	students := []models.Student{}
+	for _, id := range r.order {
+		student := r.students[id]
+		if (student.DeletedAt != nil) != deleted {
+			continue
+		}
+
+		if matchesConditions(student, query.Conditions) && (query.Filter == nil || filters.Match(query.Filter, student)) {
+			students = append(students, student)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(students, func(i, j int) bool {
+		return compareKeys(query.Sort, sortValues(query.Sort, students[i]), students[i].ID, sortValues(query.Sort, students[j]), students[j].ID) < 0
+	})
+
+	// skipping everything up to and including the position of the cursor
+	if query.Cursor != "" {
+		start := sort.Search(len(students), func(i int) bool {
+			return compareKeys(query.Sort, sortValues(query.Sort, students[i]), students[i].ID, afterValues, afterID) > 0
+		})
+		students = students[start:]
+	}
+
+	if len(students) > query.limit()+1 {
+		students = students[:query.limit()+1]
+	}
+
+	return query.page(students), nil
+}
+
+// the in-memory search scores every student by the weighted number of matching words
+// it is only an approximation of the mongo text search, which also handles phrases and stop words
+func (r *MemoryStudentRepository) Search(ctx context.Context, query SearchQuery) (SearchPage, error) {
+	var afterScore float64
+	var afterID primitive.ObjectID
+	if query.Cursor != "" {
+		var err error
+		if afterScore, afterID, err = query.decodeCursor(); err != nil {
+			return SearchPage{}, err
+		}
+	}
+
+	terms := searchTerms(query.Text)
+
+	r.mu.RLock()
+	hits := []SearchHit{}
+	for _, id := range r.order {
+		if r.students[id].DeletedAt != nil {
+			continue
+		}
+
+		if score := searchScore(r.students[id], terms); score > 0 {
+			hits = append(hits, SearchHit{Student: r.students[id], Score: score})
+		}
+	}
+	r.mu.RUnlock()
+
+	// best matches first, "_id" breaks the ties like in mongo
+	after := func(a SearchHit, score float64, id primitive.ObjectID) bool {
+		if a.Score != score {
+			return a.Score < score
+		}
+		return strings.Compare(a.Student.ID.Hex(), id.Hex()) > 0
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return after(hits[j], hits[i].Score, hits[i].Student.ID)
+	})
+
+	if query.Cursor != "" {
+		start := sort.Search(len(hits), func(i int) bool {
+			return after(hits[i], afterScore, afterID)
+		})
+		hits = hits[start:]
+	}
+
+	if len(hits) > query.limit()+1 {
+		hits = hits[:query.limit()+1]
+	}
+
+	return query.page(hits), nil
+}
+
+func searchScore(student models.Student, terms []string) float64 {
+	var score float64
+	for _, searchField := range SearchFields {
+		field, _ := models.LookupField(searchField.Name)
+		for _, word := range splitWords(field.Value(student).(string)) {
+			for _, term := range terms {
+				if termMatches(word, term) {
+					score += float64(searchField.Weight)
+					break
+				}
+			}
+		}
+	}
+
+	return score
+}
+
+// function to check a student against every condition, the same way mongo would
+func matchesConditions(student models.Student, conditions []Condition) bool {
+	for _, condition := range conditions {
+		result := models.CompareValues(condition.Field.Value(student), condition.Value)
+
+		var ok bool
+		switch condition.Op {
+		case OpEq:
+			ok = result == 0
+		case OpNe:
+			ok = result != 0
+		case OpGt:
+			ok = result > 0
+		case OpGte:
+			ok = result >= 0
+		case OpLt:
+			ok = result < 0
+		case OpLte:
+			ok = result <= 0
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortValues(sortFields []SortField, student models.Student) []interface{} {
+	values := make([]interface{}, len(sortFields))
+	for i, sortField := range sortFields {
+		values[i] = sortField.Field.Value(student)
+	}
+
+	return values
+}
+
+// function to compare two positions in the sort order, "_id" breaks the ties like in mongo
+func compareKeys(sortFields []SortField, aValues []interface{}, aID primitive.ObjectID, bValues []interface{}, bID primitive.ObjectID) int {
+	for i, sortField := range sortFields {
+		result := models.CompareValues(aValues[i], bValues[i])
+		if sortField.Descending {
+			result = -result
+		}
+
+		if result != 0 {
+			return result
+		}
+	}
+
+	return strings.Compare(aID.Hex(), bID.Hex())
+}
@@ -0,0 +1,408 @@
+// File containing the MongoDB backed implementation of the StudentRepository
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"my-rest-api/tracing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// making sure the implementation keeps satisfying the interface
+var _ StudentRepository = (*MongoStudentRepository)(nil)
+
+type MongoStudentRepository struct {
+	collection *mongo.Collection
+}
+
+// function to create a repository on top of an existing collection
+func NewMongoStudentRepository(collection *mongo.Collection) *MongoStudentRepository {
+	return &MongoStudentRepository{collection: collection}
+}
+
+// function to create the indexes the repository relies on, it is safe to call on every startup
+// the roll numbers are unique among the students which have one
+func (r *MongoStudentRepository) EnsureIndexes(ctx context.Context) error {
+	keys := bson.D{}
+	weights := bson.D{}
+	for _, searchField := range SearchFields {
+		field, _ := models.LookupField(searchField.Name)
+		keys = append(keys, bson.E{Key: field.Key, Value: "text"})
+		weights = append(weights, bson.E{Key: field.Key, Value: searchField.Weight})
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    keys,
+			Options: options.Index().SetName("students_text").SetWeights(weights),
+		},
+		{
+			Keys:    bson.D{{Key: "rollNumber", Value: 1}},
+			Options: options.Index().SetName("students_roll_number").SetUnique(true).SetPartialFilterExpression(bson.M{"rollNumber": bson.M{"$gt": ""}}),
+		},
+	})
+	return err
+}
+
+func (r *MongoStudentRepository) Create(ctx context.Context, student models.Student) (models.Student, error) {
+	// letting MongoDB generate the ID, every student starts at version 1
+	student.ID = primitive.NilObjectID
+	student.Version = 1
+	student.CreatedAt = now()
+	student.UpdatedAt = student.CreatedAt
+
+	result, err := r.collection.InsertOne(ctx, student)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Student{}, ErrDuplicate
+	}
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	student.ID = result.InsertedID.(primitive.ObjectID)
+	return student, nil
+}
+
+func (r *MongoStudentRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	var student models.Student
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deletedAt": nil}).Decode(&student)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Student{}, ErrNotFound
+	}
+
+	return student, err
+}
+
+func (r *MongoStudentRepository) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]models.Student, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "deletedAt": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	students := []models.Student{}
+	if err := cursor.All(ctx, &students); err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+func (r *MongoStudentRepository) FindByRollNumber(ctx context.Context, rollNumber string) (models.Student, error) {
+	var student models.Student
+
+	err := r.collection.FindOne(ctx, bson.M{"rollNumber": rollNumber, "deletedAt": nil}).Decode(&student)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Student{}, ErrNotFound
+	}
+
+	return student, err
+}
+
+func (r *MongoStudentRepository) Update(ctx context.Context, id primitive.ObjectID, student models.Student, version int64) (models.Student, error) {
+	// only the editable attributes are overwritten, createdAt is left as it is
+	var editable []models.Field
+	for _, field := range models.StudentFields {
+		if field.Editable {
+			editable = append(editable, field)
+		}
+	}
+
+	return r.Patch(ctx, id, student, editable, version)
+}
+
+func (r *MongoStudentRepository) Patch(ctx context.Context, id primitive.ObjectID, student models.Student, fields []models.Field, version int64) (models.Student, error) {
+	// setting only the given attributes, the others are left untouched in the database
+	update := bson.M{}
+	for _, field := range fields {
+		update[field.Key] = field.Value(student)
+	}
+
+	// there is nothing to write, the student is left as it is (updatedAt included)
+	if len(update) == 0 {
+		existing, err := r.Get(ctx, id)
+		if err == nil && version != AnyVersion && existing.Version != version {
+			return models.Student{}, ErrVersionConflict
+		}
+		return existing, err
+	}
+
+	// returning the document as it looks after the update
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	update["updatedAt"] = now()
+
+	var updated models.Student
+	err := r.collection.FindOneAndUpdate(ctx, versionFilter(id, version), bson.M{"$set": update, "$inc": bson.M{"version": 1}}, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Student{}, r.missingOrConflict(ctx, id)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Student{}, ErrDuplicate
+	}
+
+	return updated, err
+}
+
+func (r *MongoStudentRepository) Delete(ctx context.Context, id primitive.ObjectID, version int64) (models.Student, error) {
+	// moving the document to the trash instead of removing it
+	deletedAt := now()
+	update := bson.M{"$set": bson.M{"deletedAt": deletedAt, "updatedAt": deletedAt}, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var deleted models.Student
+	err := r.collection.FindOneAndUpdate(ctx, versionFilter(id, version), update, opts).Decode(&deleted)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Student{}, r.missingOrConflict(ctx, id)
+	}
+
+	return deleted, err
+}
+
+func (r *MongoStudentRepository) Restore(ctx context.Context, id primitive.ObjectID) (models.Student, error) {
+	update := bson.M{"$set": bson.M{"updatedAt": now()}, "$unset": bson.M{"deletedAt": ""}, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var restored models.Student
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deletedAt": bson.M{"$ne": nil}}, update, opts).Decode(&restored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Student{}, ErrNotFound
+	}
+
+	return restored, err
+}
+
+func (r *MongoStudentRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// function to build the filter of a conditional write, only the students which are not in the trash can be written
+// the documents written before versioning existed have no version and count as version 0
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+	switch version {
+	case AnyVersion:
+		return bson.M{"_id": id, "deletedAt": nil}
+	case 0:
+		return bson.M{"_id": id, "deletedAt": nil, "version": bson.M{"$in": bson.A{0, nil}}}
+	default:
+		return bson.M{"_id": id, "deletedAt": nil, "version": version}
+	}
+}
+
+// function to find out why a conditional write did not match anything
+func (r *MongoStudentRepository) missingOrConflict(ctx context.Context, id primitive.ObjectID) error {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "deletedAt": nil})
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrVersionConflict
+}
+
+func (r *MongoStudentRepository) List(ctx context.Context, query ListQuery) (Page, error) {
+	return r.list(ctx, query, bson.M{"deletedAt": nil})
+}
+
+func (r *MongoStudentRepository) ListTrash(ctx context.Context, query ListQuery) (Page, error) {
+	return r.list(ctx, query, bson.M{"deletedAt": bson.M{"$ne": nil}})
+}
+
+// function to run a list query within a scope, either the live students or the trash
+func (r *MongoStudentRepository) list(ctx context.Context, query ListQuery, scope bson.M) (Page, error) {
+	clauses := bson.A{scope, conditionsFilter(query.Conditions)}
+	if query.Filter != nil {
+		clauses = append(clauses, filters.ToBSON(query.Filter))
+	}
+
+	// continuing right after the last student of the previous page
+	if query.Cursor != "" {
+		values, id, err := query.decodeCursor()
+		if err != nil {
+			return Page{}, err
+		}
+
+		clauses = append(clauses, keysetFilter(query.Sort, values, id))
+	}
+
+	// fetching one student more than asked to know whether there is a next page
+	opts := options.Find().SetSort(sortDocument(query.Sort)).SetLimit(int64(query.limit() + 1))
+
+	results, err := r.collection.Find(ctx, bson.M{"$and": clauses}, opts)
+	if err != nil {
+		return Page{}, err
+	}
+
+	defer results.Close(ctx)
+
+	// fetching an individual student using a cursor and appending it to the slice
+	// the loop is traced on its own, the getMore commands it sends show up inside it
+	students, err := decodeStudents(ctx, results)
+	if err != nil {
+		return Page{}, err
+	}
+
+	return query.page(students), nil
+}
+
+func decodeStudents(ctx context.Context, results *mongo.Cursor) (students []models.Student, err error) {
+	ctx, span := tracing.Start(ctx, "decode students")
+	defer func() {
+		span.SetAttributes(attribute.Int("students.count", len(students)))
+		tracing.End(span, err)
+	}()
+
+	students = []models.Student{}
+	for results.Next(ctx) {
+		var student models.Student
+		if err := results.Decode(&student); err != nil {
+			return nil, err
+		}
+
+		students = append(students, student)
+	}
+
+	return students, results.Err()
+}
+
+// function to translate the typed conditions into a mongo filter
+// conditions on the same field are merged, e.g. {"percentage": {"$gte": 80, "$lt": 90}}
+func conditionsFilter(conditions []Condition) bson.M {
+	filter := bson.M{}
+	for _, condition := range conditions {
+		operators, ok := filter[condition.Field.Key].(bson.M)
+		if !ok {
+			operators = bson.M{}
+			filter[condition.Field.Key] = operators
+		}
+
+		operators["$"+string(condition.Op)] = condition.Value
+	}
+
+	return filter
+}
+
+// function to build the sort document, "_id" is always the last key to break ties
+func sortDocument(sortFields []SortField) bson.D {
+	sort := bson.D{}
+	for _, sortField := range sortFields {
+		direction := 1
+		if sortField.Descending {
+			direction = -1
+		}
+
+		sort = append(sort, bson.E{Key: sortField.Field.Key, Value: direction})
+	}
+
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+// function to build the filter matching everything that comes after the cursor in the sort order
+// for a sort on (a, b) this is: a > va OR (a = va AND b > vb) OR (a = va AND b = vb AND _id > id)
+func keysetFilter(sortFields []SortField, values []interface{}, id primitive.ObjectID) bson.M {
+	var or bson.A
+	for i := 0; i <= len(sortFields); i++ {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[sortFields[j].Field.Key] = values[j]
+		}
+
+		if i == len(sortFields) {
+			clause["_id"] = bson.M{"$gt": id}
+		} else {
+			operator := "$gt"
+			if sortFields[i].Descending {
+				operator = "$lt"
+			}
+			clause[sortFields[i].Field.Key] = bson.M{operator: values[i]}
+		}
+
+		or = append(or, clause)
+	}
+
+	return bson.M{"$or": or}
+}
+
+func (r *MongoStudentRepository) Search(ctx context.Context, query SearchQuery) (SearchPage, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$text": bson.M{"$search": query.Text}, "deletedAt": nil}}},
+		{{Key: "$addFields", Value: bson.M{"_score": bson.M{"$meta": "textScore"}}}},
+	}
+
+	// continuing after the last hit of the previous page, in (score desc, _id asc) order
+	if query.Cursor != "" {
+		score, id, err := query.decodeCursor()
+		if err != nil {
+			return SearchPage{}, err
+		}
+
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"_score": bson.M{"$lt": score}},
+			bson.M{"_score": score, "_id": bson.M{"$gt": id}},
+		}}}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_score", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: query.limit() + 1}},
+	)
+
+	results, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	defer results.Close(ctx)
+
+	hits, err := decodeHits(ctx, results)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	return query.page(hits), nil
+}
+
+func decodeHits(ctx context.Context, results *mongo.Cursor) (hits []SearchHit, err error) {
+	ctx, span := tracing.Start(ctx, "decode search hits")
+	defer func() {
+		span.SetAttributes(attribute.Int("students.count", len(hits)))
+		tracing.End(span, err)
+	}()
+
+	hits = []SearchHit{}
+	for results.Next(ctx) {
+		var result struct {
+			models.Student `bson:",inline"`
+			Score          float64 `bson:"_score"`
+		}
+		if err := results.Decode(&result); err != nil {
+			return nil, err
+		}
+
+		hits = append(hits, SearchHit{Student: result.Student, Score: result.Score})
+	}
+
+	return hits, results.Err()
+}
+
+// the current time at the precision mongo stores it, so that a student reads back the same as it was written
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
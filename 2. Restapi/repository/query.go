@@ -0,0 +1,195 @@
+// File containing the description of a list query (filters, sorting and pagination) shared by every implementation
+
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"my-rest-api/filters"
+	"my-rest-api/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// number of students in a page when the client does not ask for a specific amount
+	DefaultLimit = 20
+
+	// biggest page a client can ask for
+	MaxLimit = 100
+)
+
+// error returned when a cursor token cannot be decoded or does not belong to the requested sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Operator string
+
+const (
+	OpEq  Operator = "eq"
+	OpNe  Operator = "ne"
+	OpGt  Operator = "gt"
+	OpGte Operator = "gte"
+	OpLt  Operator = "lt"
+	OpLte Operator = "lte"
+)
+
+// every supported operator, used to recognise suffixes such as "_gte" in query params
+var Operators = []Operator{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte}
+
+// Condition is a single typed filter such as percentage >= 80
+type Condition struct {
+	Field models.Field
+	Op    Operator
+	Value interface{}
+}
+
+// SortField is one key of the sort order
+type SortField struct {
+	Field      models.Field
+	Descending bool
+}
+
+// ListQuery describes which students to return and in which order
+// The "_id" is always used as the last sort key so that the order (and the cursor) is stable
+type ListQuery struct {
+	Conditions []Condition
+	Filter     filters.Expr // optional checked filter expression, applied on top of the conditions
+	Sort       []SortField
+	Limit      int
+	Cursor     string
+}
+
+// Page is one page of a list query
+// NextCursor is empty when there are no more students to fetch
+type Page struct {
+	Students   []models.Student
+	NextCursor string
+}
+
+// the position of the last student of a page, encoded as an opaque token for the client
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// function to read a sort order written the way the client sends it, one key per entry
+// a key is the name of a field, prefixed with "-" to sort in descending order, e.g. ["percentage", "-name"]
+func ParseSort(keys []string) ([]SortField, error) {
+	sort := make([]SortField, 0, len(keys))
+	for _, key := range keys {
+		descending := strings.HasPrefix(key, "-")
+
+		field, ok := models.LookupField(strings.TrimPrefix(key, "-"))
+		if !ok {
+			return nil, fmt.Errorf("cannot sort on unknown field %q", strings.TrimPrefix(key, "-"))
+		}
+
+		sort = append(sort, SortField{Field: field, Descending: descending})
+	}
+
+	return sort, nil
+}
+
+// function to make sure the limit is within bounds
+func (q ListQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+
+	if q.Limit > MaxLimit {
+		return MaxLimit
+	}
+
+	return q.Limit
+}
+
+// function to write the sort order the way the client sends it, e.g. "percentage,-name"
+func (q ListQuery) sortSpec() string {
+	keys := make([]string, len(q.Sort))
+	for i, sortField := range q.Sort {
+		keys[i] = sortField.Field.Name
+		if sortField.Descending {
+			keys[i] = "-" + keys[i]
+		}
+	}
+
+	return strings.Join(keys, ",")
+}
+
+// function to build the cursor pointing right after the given student
+func (q ListQuery) encodeCursor(student models.Student) string {
+	c := cursor{Sort: q.sortSpec(), ID: student.ID.Hex()}
+	for _, sortField := range q.Sort {
+		c.Values = append(c.Values, sortField.Field.Value(student))
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// function to read the cursor of the query back into sort values and an ID
+func (q ListQuery) decodeCursor() ([]interface{}, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	// a cursor is only meaningful for the sort order it was created with
+	if c.Sort != q.sortSpec() || len(c.Values) != len(q.Sort) {
+		return nil, primitive.NilObjectID, fmt.Errorf("%w: it was created for a different sort order", ErrInvalidCursor)
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	// json gives back float64 and string, checking them against the kind of each field
+	// dates are written as RFC 3339 strings and read back into times
+	for i, sortField := range q.Sort {
+		switch value := c.Values[i].(type) {
+		case float64:
+			if sortField.Field.Kind != models.NumberField {
+				return nil, primitive.NilObjectID, ErrInvalidCursor
+			}
+		case string:
+			switch sortField.Field.Kind {
+			case models.StringField:
+			case models.TimeField:
+				timestamp, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, primitive.NilObjectID, ErrInvalidCursor
+				}
+				c.Values[i] = timestamp
+			default:
+				return nil, primitive.NilObjectID, ErrInvalidCursor
+			}
+		default:
+			return nil, primitive.NilObjectID, ErrInvalidCursor
+		}
+	}
+
+	return c.Values, id, nil
+}
+
+// function to turn up to limit+1 fetched students into a page
+// the extra student only tells us that there is a next page, it is not returned
+func (q ListQuery) page(students []models.Student) Page {
+	limit := q.limit()
+	if len(students) <= limit {
+		return Page{Students: students}
+	}
+
+	students = students[:limit]
+	return Page{Students: students, NextCursor: q.encodeCursor(students[limit-1])}
+}
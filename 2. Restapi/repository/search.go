@@ -0,0 +1,212 @@
+// File containing the description of a full-text search and the helpers shared by every implementation
+
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"my-rest-api/models"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the fields covered by the full-text search, with how much a match in each of them weighs
+var SearchFields = []struct {
+	Name   string
+	Weight int
+}{
+	{Name: "name", Weight: 10},
+	{Name: "address", Weight: 5},
+	{Name: "description", Weight: 1},
+}
+
+// longest highlighted snippet, in characters
+const snippetLength = 160
+
+// SearchQuery describes a full-text search, it is paged the same way as a ListQuery
+type SearchQuery struct {
+	Text   string
+	Limit  int
+	Cursor string
+}
+
+// SearchHit is one student matching a search with its relevance and the highlighted snippets
+// Highlights holds, for every searched field that matched, a snippet with the matches wrapped in <em> tags
+type SearchHit struct {
+	Student    models.Student    `json:"student"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchPage is one page of search results, best matches first
+type SearchPage struct {
+	Hits       []SearchHit
+	NextCursor string
+}
+
+func (q SearchQuery) limit() int {
+	return ListQuery{Limit: q.Limit}.limit()
+}
+
+// the cursor of a search is tied to the searched text, since the scores only make sense for it
+func (q SearchQuery) cursorKey() string {
+	return "search:" + q.Text
+}
+
+func (q SearchQuery) encodeCursor(hit SearchHit) string {
+	raw, _ := json.Marshal(cursor{Sort: q.cursorKey(), Values: []interface{}{hit.Score}, ID: hit.Student.ID.Hex()})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func (q SearchQuery) decodeCursor() (float64, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != q.cursorKey() || len(c.Values) != 1 {
+		return 0, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	score, ok := c.Values[0].(float64)
+	if !ok {
+		return 0, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return 0, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return score, id, nil
+}
+
+// function to turn up to limit+1 hits into a page and to fill in their highlights
+func (q SearchQuery) page(hits []SearchHit) SearchPage {
+	terms := searchTerms(q.Text)
+	for i := range hits {
+		hits[i].Highlights = highlights(hits[i].Student, terms)
+	}
+
+	limit := q.limit()
+	if len(hits) <= limit {
+		return SearchPage{Hits: hits}
+	}
+
+	hits = hits[:limit]
+	return SearchPage{Hits: hits, NextCursor: q.encodeCursor(hits[limit-1])}
+}
+
+// function to split the searched text into lowercase words
+// words starting with "-" are exclusions in a mongo text search, they are never highlighted
+func searchTerms(text string) []string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "-") {
+			continue
+		}
+
+		terms = append(terms, splitWords(strings.ToLower(word))...)
+	}
+
+	return terms
+}
+
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// function to tell whether a word of a document matches a searched term
+// mongo stems the words, so "developers" finds "developer", the prefix check is a cheap approximation of it
+func termMatches(word string, term string) bool {
+	word = strings.ToLower(word)
+	if strings.HasPrefix(word, term) {
+		return true
+	}
+
+	return len([]rune(word)) >= 3 && strings.HasPrefix(term, word)
+}
+
+func highlights(student models.Student, terms []string) map[string]string {
+	result := map[string]string{}
+	for _, searchField := range SearchFields {
+		field, _ := models.LookupField(searchField.Name)
+		if snippet, ok := highlight(field.Value(student).(string), terms); ok {
+			result[searchField.Name] = snippet
+		}
+	}
+
+	return result
+}
+
+// function to build a snippet of the text around the first match, with every match wrapped in <em> tags
+// the text is html escaped so that the snippet can be displayed as it is
+func highlight(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+
+	// finding the words of the text along with their position
+	type span struct{ start, end int }
+	var matches []span
+	for start := 0; start < len(runes); {
+		if !unicode.IsLetter(runes[start]) && !unicode.IsDigit(runes[start]) {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+
+		for _, term := range terms {
+			if termMatches(string(runes[start:end]), term) {
+				matches = append(matches, span{start, end})
+				break
+			}
+		}
+		start = end
+	}
+
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	// centering the snippet on the first match
+	from := matches[0].start - snippetLength/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetLength
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	var snippet strings.Builder
+	if from > 0 {
+		snippet.WriteString("…")
+	}
+
+	position := from
+	for _, match := range matches {
+		if match.start < from || match.end > to {
+			continue
+		}
+
+		snippet.WriteString(html.EscapeString(string(runes[position:match.start])))
+		snippet.WriteString("<em>" + html.EscapeString(string(runes[match.start:match.end])) + "</em>")
+		position = match.end
+	}
+	snippet.WriteString(html.EscapeString(string(runes[position:to])))
+
+	if to < len(runes) {
+		snippet.WriteString("…")
+	}
+
+	return snippet.String(), true
+}
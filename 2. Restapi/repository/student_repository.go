@@ -0,0 +1,92 @@
+// File containing the storage abstraction used by the handlers, so they do not depend on a specific database
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"my-rest-api/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// error returned by every implementation when no student matches the given ID
+// students in the trash are only found by ListTrash and Restore
+var ErrNotFound = errors.New("student not found")
+
+// error returned by the writes when the stored student is not at the expected version anymore
+var ErrVersionConflict = errors.New("student was modified concurrently")
+
+// error returned by the writes when another student already has the same roll number
+var ErrDuplicate = errors.New("a student with the same roll number already exists")
+
+// version to pass to the writes which should not check the version of the stored student
+const AnyVersion int64 = -1
+
+// StudentRepository is the set of operations the controllers need from a student store
+type StudentRepository interface {
+	// Create stores a new student and returns it with its generated ID
+	Create(ctx context.Context, student models.Student) (models.Student, error)
+
+	// Get fetches a single student by ID
+	Get(ctx context.Context, id primitive.ObjectID) (models.Student, error)
+
+	// GetMany fetches the students with the given IDs in one query, in no particular order
+	// the IDs which match no student (or a deleted one) are simply left out
+	GetMany(ctx context.Context, ids []primitive.ObjectID) ([]models.Student, error)
+
+	// FindByRollNumber fetches the student with the given roll number, deleted students are not found
+	FindByRollNumber(ctx context.Context, rollNumber string) (models.Student, error)
+
+	// Update overwrites the editable fields of a student and returns the stored result
+	// The write only happens if the stored student is at the given version (unless it is AnyVersion)
+	Update(ctx context.Context, id primitive.ObjectID, student models.Student, version int64) (models.Student, error)
+
+	// Patch overwrites only the given fields of a student with their value in student and returns the stored result
+	// The write only happens if the stored student is at the given version (unless it is AnyVersion)
+	Patch(ctx context.Context, id primitive.ObjectID, student models.Student, fields []models.Field, version int64) (models.Student, error)
+
+	// Delete moves a student to the trash and returns it as stored, it is hidden from Get, List and Search until it is restored
+	// The student is only moved if it is at the given version (unless it is AnyVersion)
+	Delete(ctx context.Context, id primitive.ObjectID, version int64) (models.Student, error)
+
+	// List returns one page of the students matching the query
+	List(ctx context.Context, query ListQuery) (Page, error)
+
+	// ListTrash returns one page of the deleted students matching the query
+	ListTrash(ctx context.Context, query ListQuery) (Page, error)
+
+	// Restore takes a student out of the trash and returns it
+	Restore(ctx context.Context, id primitive.ObjectID) (models.Student, error)
+
+	// Purge permanently removes the students deleted before the given time and returns how many were removed
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// Search runs a full-text search over the SearchFields, best matches first
+	Search(ctx context.Context, query SearchQuery) (SearchPage, error)
+}
+
+// function to find the ID of the student an identifier designates, among the deleted students when deleted is set
+// the deleted students keep their roll number until they are purged, so a roll number designates one student either way
+func ResolveStudentID(ctx context.Context, students StudentRepository, identifier models.StudentIdentifier, deleted bool) (primitive.ObjectID, error) {
+	if identifier.RollNumber == "" {
+		return identifier.ID, nil
+	}
+
+	if !deleted {
+		student, err := students.FindByRollNumber(ctx, identifier.RollNumber)
+		return student.ID, err
+	}
+
+	field, _ := models.LookupField("rollNumber")
+	page, err := students.ListTrash(ctx, ListQuery{Conditions: []Condition{{Field: field, Op: OpEq, Value: identifier.RollNumber}}, Limit: 1})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if len(page.Students) == 0 {
+		return primitive.NilObjectID, ErrNotFound
+	}
+
+	return page.Students[0].ID, nil
+}
@@ -0,0 +1,203 @@
+// File containing the change stream of the students in MongoDB, which the change feed waits on
+// every write of the collection is streamed, the ones made without the api (a purge, a migration, ...) as well
+
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"my-rest-api/models"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the code of the error returned by MongoDB when change streams are not available, on a standalone server
+const changeStreamsUnsupported = 40573
+
+// making sure the repository keeps being watchable
+var _ StudentWatcher = (*MongoStudentRepository)(nil)
+
+// the changes are pushed through a change stream, which needs a replica set (or a sharded cluster)
+// the updates come with the student as it is when the change is read, the tokens are the _data of the resume tokens of the stream
+func (r *MongoStudentRepository) Watch(ctx context.Context, resumeAfter string) (StudentStream, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}}}}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != "" {
+		opts.SetResumeAfter(bson.M{"_data": resumeAfter})
+	}
+
+	stream, err := r.collection.Watch(ctx, pipeline, opts)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == changeStreamsUnsupported {
+		return nil, fmt.Errorf("%w: %s", ErrWatchUnsupported, commandErr.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoStudentStream{stream: stream}, nil
+}
+
+// error returned once the change stream cannot go on, e.g. when the collection was dropped
+var errStudentStreamClosed = errors.New("the change stream of the students was closed")
+
+type mongoStudentStream struct {
+	stream *mongo.ChangeStream
+}
+
+func (s *mongoStudentStream) Next(ctx context.Context) (models.AuditEntry, string, error) {
+	if !s.stream.Next(ctx) {
+		if err := s.stream.Err(); err != nil {
+			return models.AuditEntry{}, "", err
+		}
+		if err := ctx.Err(); err != nil {
+			return models.AuditEntry{}, "", err
+		}
+		return models.AuditEntry{}, "", errStudentStreamClosed
+	}
+
+	return s.decode()
+}
+
+func (s *mongoStudentStream) TryNext(ctx context.Context) (models.AuditEntry, string, bool, error) {
+	if !s.stream.TryNext(ctx) {
+		return models.AuditEntry{}, "", false, s.stream.Err()
+	}
+
+	entry, token, err := s.decode()
+	return entry, token, err == nil, err
+}
+
+// the resume token moves on with every batch, the empty ones included, so it tells where the stream is
+func (s *mongoStudentStream) Reached() (primitive.Timestamp, bool) {
+	return tokenClusterTime(s.token())
+}
+
+// function to describe the current change, along with the token resuming the stream right after it
+func (s *mongoStudentStream) decode() (models.AuditEntry, string, error) {
+	var change studentChange
+	if err := s.stream.Decode(&change); err != nil {
+		return models.AuditEntry{}, "", err
+	}
+
+	return change.entry(), s.token(), nil
+}
+
+func (s *mongoStudentStream) token() string {
+	token, _ := s.stream.ResumeToken().Lookup("_data").StringValueOK()
+	return token
+}
+
+func (s *mongoStudentStream) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
+
+// function to read the cluster time a resume token starts with, the changes are in the order of their cluster time
+// the _data of a token is a KeyString written in hexadecimal, its first value is the cluster time (type 130, then 8 bytes)
+func tokenClusterTime(token string) (primitive.Timestamp, bool) {
+	if len(token) < 18 {
+		return primitive.Timestamp{}, false
+	}
+
+	raw, err := hex.DecodeString(token[:18])
+	if err != nil || raw[0] != 130 {
+		return primitive.Timestamp{}, false
+	}
+
+	return primitive.Timestamp{T: binary.BigEndian.Uint32(raw[1:5]), I: binary.BigEndian.Uint32(raw[5:9])}, true
+}
+
+// studentChange holds the attributes of a change of the students which the feed tells about
+type studentChange struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+
+	// the student when the change was read, missing when it was purged since
+	FullDocument *models.Student `bson:"fullDocument"`
+
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// function to describe a change of the students like an entry of the audit log
+// who made it and what the attributes were before are not known, the changes only give the value they were written with
+// a delete moving the student to the trash is an update setting deletedAt, the delete of the document is a purge
+func (c studentChange) entry() models.AuditEntry {
+	entry := models.AuditEntry{
+		ID:        changeID(c.ClusterTime, c.DocumentKey.ID),
+		StudentID: c.DocumentKey.ID,
+		At:        time.Unix(int64(c.ClusterTime.T), 0).UTC(),
+		Changes:   []models.FieldChange{},
+		Snapshot:  models.Student{ID: c.DocumentKey.ID},
+	}
+	if c.FullDocument != nil {
+		entry.Snapshot = *c.FullDocument
+		entry.Version = c.FullDocument.Version
+	}
+
+	switch c.OperationType {
+	case "insert":
+		entry.Action = models.ActionCreate
+		entry.Changes = models.Diff(models.Student{}, entry.Snapshot)
+		return entry
+	case "delete":
+		entry.Action = models.ActionPurge
+		return entry
+	}
+
+	// a replace writes every attribute, an update the ones it lists
+	written, replaced := entry.Snapshot, c.OperationType == "replace"
+	var keys []string
+	if !replaced {
+		written = models.Student{}
+		bson.Unmarshal(c.UpdateDescription.UpdatedFields, &written)
+
+		elements, _ := c.UpdateDescription.UpdatedFields.Elements()
+		for _, element := range elements {
+			keys = append(keys, element.Key())
+		}
+	}
+
+	entry.Action = models.ActionUpdate
+	for _, field := range models.StudentFields {
+		if field.Editable && (replaced || slices.Contains(keys, field.Key)) {
+			entry.Changes = append(entry.Changes, models.FieldChange{Field: field.Name, After: field.Value(written)})
+		}
+	}
+
+	switch {
+	case slices.Contains(keys, "deletedAt") && written.DeletedAt != nil:
+		entry.Action = models.ActionDelete
+		entry.Changes = append(entry.Changes, models.FieldChange{Field: "deletedAt", After: *written.DeletedAt})
+	case slices.Contains(c.UpdateDescription.RemovedFields, "deletedAt"):
+		entry.Action = models.ActionRestore
+		entry.Changes = append(entry.Changes, models.FieldChange{Field: "deletedAt"})
+	}
+
+	return entry
+}
+
+// function to give a change of the students an ID, the same in every stream reading it so that a follower gets it once
+// it starts with the second of the change like the IDs of the audit entries, then comes the place of the change in that
+// second and the end of the ID of the student, which tells apart the changes of a transaction
+func changeID(clusterTime primitive.Timestamp, student primitive.ObjectID) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[0:4], clusterTime.T)
+	binary.BigEndian.PutUint32(id[4:8], clusterTime.I)
+	copy(id[8:], student[8:])
+	return id
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"my-rest-api/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// function to write a resume token the way MongoDB does, starting with the cluster time
+func resumeToken(clusterTime primitive.Timestamp) string {
+	return fmt.Sprintf("82%08X%08X2B022C0100296E5A1004", clusterTime.T, clusterTime.I)
+}
+
+// function to build a batch of a change stream, the post batch resume token tells where the stream is once it is read
+func changeBatch(identifier mtest.BatchIdentifier, reached primitive.Timestamp, events ...bson.D) bson.D {
+	batch := bson.A{}
+	for _, event := range events {
+		batch = append(batch, event)
+	}
+
+	return bson.D{{Key: "ok", Value: 1}, {Key: "cursor", Value: bson.D{
+		{Key: "id", Value: int64(1)},
+		{Key: "ns", Value: "db.students"},
+		{Key: string(identifier), Value: batch},
+		{Key: "postBatchResumeToken", Value: bson.D{{Key: "_data", Value: resumeToken(reached)}}},
+	}}}
+}
+
+// function to build an event of the change stream of the students
+func changeEvent(operation string, clusterTime primitive.Timestamp, student primitive.ObjectID, fields ...bson.E) bson.D {
+	return append(bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: resumeToken(clusterTime)}}},
+		{Key: "operationType", Value: operation},
+		{Key: "clusterTime", Value: clusterTime},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: student}}},
+	}, fields...)
+}
+
+func TestMongoStudentWatch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	killed := bson.D{{Key: "ok", Value: 1}, {Key: "cursorsKilled", Value: bson.A{int64(1)}}}
+	deletedAt := time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)
+
+	mt.Run("resumes after the token", func(mt *mtest.T) {
+		created := primitive.Timestamp{T: 1700000000, I: 1}
+		mt.AddMockResponses(
+			changeBatch(mtest.FirstBatch, created, changeEvent("insert", created, id,
+				bson.E{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Ada"}, {Key: "version", Value: 1}}},
+			)),
+			changeBatch(mtest.NextBatch, primitive.Timestamp{T: 1700000005, I: 3}),
+			killed,
+		)
+
+		stream, err := NewMongoStudentRepository(mt.Coll).Watch(context.Background(), resumeToken(primitive.Timestamp{T: 1699999999}))
+		if !assert.NoError(mt, err) {
+			return
+		}
+		defer stream.Close(context.Background())
+
+		options := mt.GetStartedEvent().Command.Lookup("pipeline", "0", "$changeStream").Document()
+		assert.Equal(mt, resumeToken(primitive.Timestamp{T: 1699999999}), options.Lookup("resumeAfter", "_data").StringValue())
+		assert.Equal(mt, "updateLookup", options.Lookup("fullDocument").StringValue())
+
+		entry, token, err := stream.Next(context.Background())
+		if assert.NoError(mt, err) {
+			assert.Equal(mt, changeID(created, id), entry.ID)
+			assert.Equal(mt, models.ActionCreate, entry.Action)
+			assert.Equal(mt, "Ada", entry.Snapshot.Name)
+			assert.Equal(mt, resumeToken(created), token)
+		}
+
+		// an empty batch moves the stream on all the same
+		_, _, ok, err := stream.TryNext(context.Background())
+		assert.NoError(mt, err)
+		assert.False(mt, ok)
+		reached, known := stream.Reached()
+		assert.True(mt, known)
+		assert.Equal(mt, primitive.Timestamp{T: 1700000005, I: 3}, reached)
+	})
+
+	mt.Run("describes the changes", func(mt *mtest.T) {
+		at := func(i uint32) primitive.Timestamp { return primitive.Timestamp{T: 1700000000, I: i} }
+		student := bson.E{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Grace"}, {Key: "version", Value: 2}}}
+		updated := func(fields bson.D, removed ...string) bson.E {
+			return bson.E{Key: "updateDescription", Value: bson.D{{Key: "updatedFields", Value: fields}, {Key: "removedFields", Value: removed}}}
+		}
+
+		mt.AddMockResponses(
+			changeBatch(mtest.FirstBatch, at(4),
+				changeEvent("update", at(1), id, student, updated(bson.D{{Key: "name", Value: "Grace"}, {Key: "version", Value: 2}})),
+				changeEvent("update", at(2), id, student, updated(bson.D{{Key: "deletedAt", Value: deletedAt}, {Key: "version", Value: 3}})),
+				changeEvent("update", at(3), id, student, updated(bson.D{{Key: "version", Value: 4}}, "deletedAt")),
+				changeEvent("delete", at(4), id),
+			),
+			killed,
+		)
+
+		stream, err := NewMongoStudentRepository(mt.Coll).Watch(context.Background(), "")
+		if !assert.NoError(mt, err) {
+			return
+		}
+		defer stream.Close(context.Background())
+
+		expected := []struct {
+			action  string
+			changes []models.FieldChange
+		}{
+			{models.ActionUpdate, []models.FieldChange{{Field: "name", After: "Grace"}}},
+			{models.ActionDelete, []models.FieldChange{{Field: "deletedAt", After: deletedAt}}},
+			{models.ActionRestore, []models.FieldChange{{Field: "deletedAt"}}},
+			{models.ActionPurge, []models.FieldChange{}},
+		}
+		for i, want := range expected {
+			entry, _, err := stream.Next(context.Background())
+			if !assert.NoError(mt, err) {
+				return
+			}
+			assert.Equal(mt, want.action, entry.Action)
+			assert.Equal(mt, want.changes, entry.Changes, want.action)
+			assert.Equal(mt, id, entry.StudentID)
+			assert.Equal(mt, changeID(at(uint32(i+1)), id), entry.ID)
+		}
+	})
+
+	mt.Run("standalone server", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    changeStreamsUnsupported,
+			Message: "The $changeStream stage is only supported on replica sets",
+		}))
+
+		_, err := NewMongoStudentRepository(mt.Coll).Watch(context.Background(), "")
+		assert.ErrorIs(mt, err, ErrWatchUnsupported)
+	})
+
+	mt.Run("other errors", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "not authorized"}))
+
+		_, err := NewMongoStudentRepository(mt.Coll).Watch(context.Background(), "")
+		assert.Error(mt, err)
+		assert.NotErrorIs(mt, err, ErrWatchUnsupported)
+	})
+}
+
+func TestTokenClusterTime(t *testing.T) {
+	clusterTime, ok := tokenClusterTime(resumeToken(primitive.Timestamp{T: 1700000000, I: 7}))
+	assert.True(t, ok)
+	assert.Equal(t, primitive.Timestamp{T: 1700000000, I: 7}, clusterTime)
+
+	for _, token := range []string{"", "82", "ff00000000000000000000", "82zz"} {
+		_, ok := tokenClusterTime(token)
+		assert.False(t, ok, token)
+	}
+}
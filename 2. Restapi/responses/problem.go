@@ -0,0 +1,31 @@
+package responses
+
+// The structure of an error response, following RFC 7807 (application/problem+json)
+// Type tells the kind of problem and never changes, Detail explains this occurrence of it to a person
+// Errors is only set for validation problems and lists every rule which failed, field by field
+
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// details specific to some problems, e.g. the position of a mistake in a filter expression
+	Filter   string `json:"filter,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+// The content type of the error responses
+const ProblemContentType = "application/problem+json"
+
+// A rule of the student model which an attribute of the request does not follow
+// Rule is the name of the validator rule (required, past, ...) and Param its parameter when it has one
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
@@ -9,3 +9,12 @@ type StudentResponse struct {
 	Message string     `json:"message"`
 	Data    *fiber.Map `json:"data"`
 }
+
+// The pagination details sent along with a list of students
+// NextCursor has to be passed back as the "cursor" query param to get the next page, it is empty on the last page
+
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,493 @@
+// File containing the documentation of the routes, the OpenAPI document served at /openapi.json is built out of it
+
+package routes
+
+import (
+	_ "embed"
+	"my-rest-api/controllers"
+	"my-rest-api/health"
+	"my-rest-api/models"
+	"my-rest-api/openapi"
+	"my-rest-api/repository"
+	"my-rest-api/responses"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the OpenAPI document generated out of the routes, reviewed and committed along with them
+//
+//go:embed openapi.json
+var contract []byte
+
+// function to read the committed OpenAPI document, the one the api is checked against and serves
+func Contract() (*openapi.Document, error) {
+	return openapi.Parse(contract)
+}
+
+// function to build the OpenAPI document of the given routes
+// the schemas are generated from the structs of the api, the student ones from the json and validate tags of models.Student
+func Spec(routes []Route) *openapi.Document {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "Student Records API",
+		Version:     "1.0.0",
+		Description: "Performs all the CRUD operations on the Student documents stored in MongoDB.",
+	})
+
+	doc.Register("Student", models.Student{})
+	doc.RegisterInput("StudentInput", models.Student{})
+
+	// a merge patch only carries the attributes it changes, none of them is required and null removes an attribute
+	input := doc.Components.Schemas["StudentInput"]
+	patch := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+	for name, property := range input.Properties {
+		nullable := *property
+		switch types := property.Type.(type) {
+		case string:
+			nullable.Type = []string{types, "null"}
+		case []string:
+			if !slices.Contains(types, "null") {
+				nullable.Type = append(slices.Clip(types), "null")
+			}
+		}
+		patch.Properties[name] = &nullable
+	}
+	doc.Components.Schemas["StudentMergePatch"] = patch
+
+	doc.Components.Schemas["JSONPatchOperation"] = &openapi.Schema{
+		Type:     "object",
+		Required: []string{"op", "path"},
+		Properties: map[string]*openapi.Schema{
+			"op":    {Type: "string", Enum: []interface{}{"add", "remove", "replace", "move", "copy", "test"}},
+			"path":  {Type: "string", Description: "JSON Pointer to an attribute, e.g. /percentage"},
+			"from":  {Type: "string"},
+			"value": {},
+		},
+	}
+
+	doc.Register("Pagination", responses.Pagination{})
+	doc.Register("FieldError", responses.FieldError{})
+	doc.Register("Problem", responses.Problem{})
+	doc.Register("SearchHit", repository.SearchHit{})
+	doc.Register("FieldChange", models.FieldChange{})
+	doc.Register("AuditEntry", models.AuditEntry{})
+	doc.Register("Report", health.Report{})
+	doc.Register("ComponentReport", health.ComponentReport{})
+
+	for _, route := range routes {
+		doc.AddOperation(route.Method, route.Path, route.Operation)
+	}
+
+	return doc
+}
+
+// function to describe the envelope every successful JSON response is sent in (responses.StudentResponse)
+func envelope(data *openapi.Schema, paginated bool) *openapi.Schema {
+	inner := map[string]*openapi.Schema{"data": data}
+	if paginated {
+		inner["pagination"] = openapi.Ref("Pagination")
+	}
+
+	return openapi.Object(map[string]*openapi.Schema{
+		"status":  openapi.Integer(),
+		"message": {Type: "string", Enum: []interface{}{"success"}},
+		"data":    openapi.Object(inner),
+	})
+}
+
+func jsonResponse(description string, schema *openapi.Schema) openapi.Response {
+	return openapi.Response{Description: description, Content: map[string]openapi.MediaType{"application/json": {Schema: schema}}}
+}
+
+// function to describe a response carrying a single student along with its ETag
+func studentResponse(description string) openapi.Response {
+	response := jsonResponse(description, envelope(openapi.Ref("Student"), false))
+	response.Headers = map[string]openapi.Header{"ETag": {Description: "the version of the student, e.g. \"3\"", Schema: openapi.String()}}
+	return response
+}
+
+// function to describe a probe of the orchestrator, it answers with the result of each of its checks
+func probeDoc(operationID string, summary string) openapi.Operation {
+	return openapi.Operation{
+		OperationID: operationID,
+		Summary:     summary,
+		Tags:        []string{"Health"},
+		Responses: map[string]openapi.Response{
+			"200": jsonResponse("every check passed", openapi.Ref("Report")),
+			"503": jsonResponse("at least one check failed", openapi.Ref("Report")),
+		},
+	}
+}
+
+// the problems which can be returned, by status
+var problemDescriptions = map[int]string{
+	400: "the request is invalid (malformed ID, broken validation rule, query param which cannot be understood, ...)",
+	404: "the student does not exist",
+	409: "the student conflicts with another one, or kept changing while it was written",
+	412: "the student is not at the version given in If-Match",
+	415: "the body is not sent with a supported content type",
+	426: "the request is not a WebSocket upgrade",
+	500: "unexpected error, the cause is written in the logs",
+}
+
+// function to complete the successful responses of an operation with the problems it can return
+// an unexpected error (500) can always happen
+func withProblems(success map[string]openapi.Response, statuses ...int) map[string]openapi.Response {
+	for _, status := range append(statuses, 500) {
+		success[strconv.Itoa(status)] = openapi.Response{
+			Description: problemDescriptions[status],
+			Content:     map[string]openapi.MediaType{responses.ProblemContentType: {Schema: openapi.Ref("Problem")}},
+		}
+	}
+
+	return success
+}
+
+// function to list the names of the attributes which can be filtered and sorted on
+func fieldNames() string {
+	names := make([]string, len(models.StudentFields))
+	for i, field := range models.StudentFields {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+var (
+	studentIDParam = openapi.Parameter{
+		Name:        controllers.ParamStudentID,
+		In:          "path",
+		Required:    true,
+		Description: "the ID of the student, or its roll number written as roll:<roll number>",
+		Schema:      &openapi.Schema{Type: "string", Pattern: models.StudentIdentifierPattern},
+	}
+
+	actorParam = openapi.Parameter{
+		Name:        controllers.HeaderUser,
+		In:          "header",
+		Description: "the user making the change, it is recorded in the history of the student",
+		Schema:      openapi.String(),
+	}
+
+	ifMatchParam = openapi.Parameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: "the ETag of the version the student is expected to be at, the write is rejected with 412 otherwise",
+		Schema:      openapi.String(),
+	}
+
+	limitParam = openapi.Parameter{
+		Name:        "limit",
+		In:          "query",
+		Description: "size of a page",
+		Schema:      &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(repository.MaxLimit)},
+	}
+
+	cursorParam = openapi.Parameter{
+		Name:        "cursor",
+		In:          "query",
+		Description: "the nextCursor returned with the previous page",
+		Schema:      openapi.String(),
+	}
+
+	filterParam = openapi.Parameter{
+		Name:        "filter",
+		In:          "query",
+		Description: "a filter expression, e.g. percentage > 80 and (address = \"Paris\" or name ~ \"Ad*\")",
+		Schema:      openapi.String(),
+	}
+
+	conditionsParam = openapi.Parameter{
+		Name:        "conditions",
+		In:          "query",
+		Description: "filters written <attribute>=<value> or <attribute>_<op>=<value> with op being one of eq, ne, gt, gte, lt, lte, e.g. percentage_gte=80",
+		Style:       "form",
+		Explode:     boolean(true),
+		Schema:      &openapi.Schema{Type: "object", AdditionalProperties: openapi.String()},
+	}
+
+	listParams = []openapi.Parameter{
+		limitParam,
+		cursorParam,
+		{Name: "sort", In: "query", Description: "comma separated attributes, a \"-\" sorts in descending order, e.g. percentage,-name. The attributes are " + fieldNames(), Schema: openapi.String()},
+		filterParam,
+		conditionsParam,
+	}
+
+	// the id of an event is the ID of its audit entry, followed by the resume token of the change stream when there is one
+	eventIDSchema = &openapi.Schema{Type: "string", Pattern: repository.FeedPositionPattern}
+
+	// the filters of the events are matched against the student right after the change
+	eventParams = []openapi.Parameter{
+		{Name: "actions", In: "query", Description: "comma separated actions to stream, all of them by default: " + strings.Join(models.Actions, ", "), Schema: openapi.String()},
+		{Name: "lastEventId", In: "query", Description: "the id of the last event received, the ones which came after it are sent first. Without it only the changes made from now on are sent", Schema: eventIDSchema},
+		filterParam,
+		conditionsParam,
+	}
+
+	listResponses = withProblems(map[string]openapi.Response{
+		"200": jsonResponse("one page of students", envelope(openapi.ArrayOf(openapi.Ref("Student")), true)),
+	}, 400)
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func boolean(value bool) *bool {
+	return &value
+}
+
+var (
+	getHomeDoc = openapi.Operation{
+		OperationID: "getHome",
+		Summary:     "Welcome message",
+		Tags:        []string{"Home"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "the welcome message", Content: map[string]openapi.MediaType{"text/plain": {Schema: openapi.String()}}},
+		},
+	}
+
+	listStudentsDoc = openapi.Operation{
+		OperationID: "listStudents",
+		Summary:     "List the students, one page at a time",
+		Tags:        []string{"Students"},
+		Parameters:  listParams,
+		Responses:   listResponses,
+	}
+
+	searchStudentsDoc = openapi.Operation{
+		OperationID: "searchStudents",
+		Summary:     "Search the students by the words of their name, address and description",
+		Tags:        []string{"Students"},
+		Parameters: []openapi.Parameter{
+			{Name: "q", In: "query", Required: true, Description: "the searched words, the last one can be a prefix", Schema: openapi.String()},
+			limitParam,
+			cursorParam,
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": jsonResponse("the matching students, best matches first", envelope(openapi.ArrayOf(openapi.Ref("SearchHit")), true)),
+		}, 400),
+	}
+
+	listTrashDoc = openapi.Operation{
+		OperationID: "listTrash",
+		Summary:     "List the deleted students, one page at a time",
+		Tags:        []string{"Trash"},
+		Parameters:  listParams,
+		Responses:   listResponses,
+	}
+
+	purgeTrashDoc = openapi.Operation{
+		OperationID: "purgeTrash",
+		Summary:     "Permanently remove the students deleted before the retention period",
+		Tags:        []string{"Trash"},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": jsonResponse("how many students were removed", envelope(openapi.Object(map[string]*openapi.Schema{
+				"purged":    openapi.Integer(),
+				"retention": {Type: "string", Examples: []interface{}{"720h0m0s"}},
+			}), false)),
+		}),
+	}
+
+	getStudentDoc = openapi.Operation{
+		OperationID: "getStudent",
+		Summary:     "Get a student",
+		Tags:        []string{"Student"},
+		Parameters: []openapi.Parameter{
+			studentIDParam,
+			{Name: "If-None-Match", In: "header", Description: "the ETag of the version the client has, 304 is returned if it is still the current one", Schema: openapi.String()},
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": studentResponse("the student"),
+			"304": {Description: "the student is still at the version given in If-None-Match"},
+		}, 400, 404),
+	}
+
+	createStudentDoc = openapi.Operation{
+		OperationID: "createStudent",
+		Summary:     "Create a student",
+		Tags:        []string{"Student"},
+		Parameters:  []openapi.Parameter{actorParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("StudentInput")}},
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"201": jsonResponse("the ID of the new student", envelope(openapi.Object(map[string]*openapi.Schema{
+				"InsertedID": {Type: "string", Pattern: openapi.ObjectIDPattern},
+			}), false)),
+		}, 400, 409, 415),
+	}
+
+	updateStudentDoc = openapi.Operation{
+		OperationID: "updateStudent",
+		Summary:     "Replace the attributes of a student",
+		Tags:        []string{"Student"},
+		Parameters:  []openapi.Parameter{studentIDParam, ifMatchParam, actorParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("StudentInput")}},
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": studentResponse("the updated student"),
+		}, 400, 404, 409, 412, 415),
+	}
+
+	patchStudentDoc = openapi.Operation{
+		OperationID: "patchStudent",
+		Summary:     "Change some attributes of a student",
+		Description: "The body is a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902), the patched student is validated like on creation.",
+		Tags:        []string{"Student"},
+		Parameters:  []openapi.Parameter{studentIDParam, ifMatchParam, actorParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				controllers.MergePatchContentType: {Schema: openapi.Ref("StudentMergePatch")},
+				controllers.JSONPatchContentType:  {Schema: openapi.ArrayOf(openapi.Ref("JSONPatchOperation"))},
+			},
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": studentResponse("the patched student"),
+		}, 400, 404, 409, 412, 415),
+	}
+
+	deleteStudentDoc = openapi.Operation{
+		OperationID: "deleteStudent",
+		Summary:     "Move a student to the trash",
+		Tags:        []string{"Student"},
+		Parameters:  []openapi.Parameter{studentIDParam, ifMatchParam, actorParam},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": jsonResponse("the student was deleted", envelope(openapi.String(), false)),
+		}, 400, 404, 412),
+	}
+
+	restoreStudentDoc = openapi.Operation{
+		OperationID: "restoreStudent",
+		Summary:     "Take a student out of the trash",
+		Tags:        []string{"Trash"},
+		Parameters:  []openapi.Parameter{studentIDParam, actorParam},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": studentResponse("the restored student"),
+		}, 400, 404),
+	}
+
+	studentHistoryDoc = openapi.Operation{
+		OperationID: "getStudentHistory",
+		Summary:     "List the changes made to a student, the latest first",
+		Tags:        []string{"History"},
+		Parameters:  []openapi.Parameter{studentIDParam},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": jsonResponse("the history of the student", envelope(openapi.ArrayOf(openapi.Ref("AuditEntry")), false)),
+		}, 400, 404),
+	}
+
+	revertStudentDoc = openapi.Operation{
+		OperationID: "revertStudent",
+		Summary:     "Roll a student back to the state it had at a version",
+		Description: "A version which moved the student to the trash cannot be reverted to, the student is brought back with the restore instead.",
+		Tags:        []string{"History"},
+		Parameters: []openapi.Parameter{
+			studentIDParam,
+			{Name: "version", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer", Minimum: float(1)}},
+			ifMatchParam,
+			actorParam,
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": studentResponse("the reverted student"),
+		}, 400, 404, 412),
+	}
+
+	studentEventsDoc = openapi.Operation{
+		OperationID: "streamStudentEvents",
+		Summary:     "Stream the changes made to the students as Server-Sent Events",
+		Description: "Every change is an event named after its action, its id is the id of the audit entry (followed by a dot and the resume token of the change stream when the students are watched) and its data is the audit entry, the student right after the change being its snapshot. The changes read from the change stream have no actor and only the values after them, a purge only carries the studentId. An EventSource which reconnects sends Last-Event-ID and misses no change, a client too slow to keep up is disconnected and resumes the same way.",
+		Tags:        []string{"Events"},
+		Parameters: append([]openapi.Parameter{
+			{Name: controllers.HeaderLastEventID, In: "header", Description: "the id of the last event received, it wins over lastEventId", Schema: eventIDSchema},
+		}, eventParams...),
+		Responses: withProblems(map[string]openapi.Response{
+			"200": {Description: "the stream of the events, it ends when the server shuts down", Content: map[string]openapi.MediaType{"text/event-stream": {Schema: openapi.String()}}},
+		}, 400),
+	}
+
+	studentEventsWebSocketDoc = openapi.Operation{
+		OperationID: "streamStudentEventsWebSocket",
+		Summary:     "Stream the changes made to the students over a WebSocket",
+		Description: "Every change is a text message holding its audit entry as JSON (like the Server-Sent Events), along with the id of the event in eventId. The connection is closed with 1001 when the server shuts down, the client then reconnects with lastEventId.",
+		Tags:        []string{"Events"},
+		Parameters:  eventParams,
+		Responses: withProblems(map[string]openapi.Response{
+			"101": {Description: "the connection is upgraded to a WebSocket"},
+		}, 400, 426),
+	}
+
+	graphqlDoc = openapi.Operation{
+		OperationID: "graphql",
+		Summary:     "Run a GraphQL query or mutation on the students",
+		Description: "The schema is generated from the Student model, it can be read with an introspection query. The errors of the resolvers are listed in errors, with the kind of problem in extensions.code.",
+		Tags:        []string{"GraphQL"},
+		Parameters:  []openapi.Parameter{actorParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{"application/json": {Schema: &openapi.Schema{
+				Type:     "object",
+				Required: []string{"query"},
+				Properties: map[string]*openapi.Schema{
+					"query":         openapi.String(),
+					"variables":     {Type: []string{"object", "null"}},
+					"operationName": {Type: []string{"string", "null"}},
+				},
+			}}},
+		},
+		Responses: withProblems(map[string]openapi.Response{
+			"200": jsonResponse("the result of the request, the errors do not change the status", &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"data": {},
+					"errors": openapi.ArrayOf(&openapi.Schema{
+						Type:     "object",
+						Required: []string{"message"},
+						Properties: map[string]*openapi.Schema{
+							"message":    openapi.String(),
+							"path":       openapi.ArrayOf(&openapi.Schema{}),
+							"extensions": {Type: "object"},
+						},
+					}),
+				},
+			}),
+		}, 400, 415),
+	}
+
+	livenessDoc = probeDoc("livenessProbe", "Whether the process is alive, it is restarted when this fails")
+
+	readinessDoc = probeDoc("readinessProbe", "Whether the api can take traffic, it fails while the database cannot be reached and while the api shuts down")
+
+	startupDoc = probeDoc("startupProbe", "Whether the api has finished starting")
+
+	metricsDoc = openapi.Operation{
+		OperationID: "getMetrics",
+		Summary:     "The metrics of the api (requests, MongoDB commands and connections, go runtime) in the Prometheus text format",
+		Tags:        []string{"Health"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "the metrics", Content: map[string]openapi.MediaType{"text/plain": {Schema: openapi.String()}}},
+		},
+	}
+
+	specDoc = openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This OpenAPI document",
+		Tags:        []string{"Docs"},
+		Responses: map[string]openapi.Response{
+			"200": jsonResponse("the OpenAPI 3.1 document of the api", &openapi.Schema{Type: "object"}),
+		},
+	}
+
+	docsDoc = openapi.Operation{
+		OperationID: "getDocs",
+		Summary:     "The documentation of the api, rendered from the OpenAPI document",
+		Tags:        []string{"Docs"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "the docs page", Content: map[string]openapi.MediaType{"text/html": {Schema: openapi.String()}}},
+		},
+	}
+)
@@ -3,23 +3,125 @@
 package routes
 
 import (
+	"fmt"
 	"my-rest-api/controllers"
+	"my-rest-api/health"
+	"my-rest-api/metrics"
+	"my-rest-api/openapi"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func UserRoute(app *fiber.App) {
+// Route is an endpoint of the api along with its documentation
+// the OpenAPI document is generated out of the routes and committed as openapi.json, which the requests are checked against
+// so an endpoint cannot exist without being documented, and a change of the documentation shows in the committed document
+type Route struct {
+	Method    string
+	Path      string
+	Handlers  []fiber.Handler
+	Operation openapi.Operation
+}
+
+// paths of the generated documentation
+const (
+	SpecPath = "/openapi.json"
+	DocsPath = "/docs"
+)
+
+// function to list the routes of the api
+// the routes taking a student identifier go through BindStudentID, which rejects the malformed ones
+// and lets the handlers read the parsed ID, the restore goes through BindDeletedStudentID to find the student in the trash
+func StudentRoutes(students *controllers.StudentController, graphQL fiber.Handler) []Route {
+	return []Route{
+		{"GET", "/", []fiber.Handler{controllers.GetHome}, getHomeDoc},
+
+		{"GET", "/students", []fiber.Handler{students.GetAllStudents}, listStudentsDoc},
+
+		{"GET", "/students/search", []fiber.Handler{students.SearchStudents}, searchStudentsDoc},
+
+		{"GET", "/students/trash", []fiber.Handler{students.GetTrash}, listTrashDoc},
+
+		{"DELETE", "/students/trash", []fiber.Handler{students.PurgeTrash}, purgeTrashDoc},
+
+		{"GET", "/student/:userId", []fiber.Handler{students.BindStudentID, students.GetAStudent}, getStudentDoc},
+
+		{"POST", "/student", []fiber.Handler{students.CreateStudent}, createStudentDoc},
+
+		{"PUT", "/student/:userId", []fiber.Handler{students.BindStudentID, students.EditAStudent}, updateStudentDoc},
+
+		{"PATCH", "/student/:userId", []fiber.Handler{students.BindStudentID, students.PatchAStudent}, patchStudentDoc},
+
+		{"DELETE", "/student/:userId", []fiber.Handler{students.BindStudentID, students.DeleteAStudent}, deleteStudentDoc},
+
+		{"POST", "/student/:userId/restore", []fiber.Handler{students.BindDeletedStudentID, students.RestoreAStudent}, restoreStudentDoc},
+
+		{"GET", "/student/:userId/history", []fiber.Handler{students.BindStudentID, students.GetStudentHistory}, studentHistoryDoc},
 
-	app.Get("/", controllers.GetHome)
+		{"POST", "/student/:userId/revert/:version", []fiber.Handler{students.BindStudentID, students.RevertAStudent}, revertStudentDoc},
+
+		{"POST", "/graphql", []fiber.Handler{graphQL}, graphqlDoc},
+	}
+}
+
+// function to list the routes streaming the changes made to the students
+// the WebSocket one goes through UpgradeEvents, which answers the requests which are not upgrades with 426
+func EventRoutes(events *controllers.StudentEvents) []Route {
+	return []Route{
+		{"GET", "/students/events", []fiber.Handler{events.StreamEvents}, studentEventsDoc},
+
+		{"GET", "/students/events/ws", []fiber.Handler{events.UpgradeEvents}, studentEventsWebSocketDoc},
+	}
+}
+
+// function to list the routes of the probes of the orchestrator and of the metrics
+func HealthRoutes(probes *health.Probes) []Route {
+	return []Route{
+		{"GET", "/metrics", []fiber.Handler{metrics.Handler()}, metricsDoc},
+
+		{"GET", "/healthz", []fiber.Handler{probes.Liveness.Handler()}, livenessDoc},
+
+		{"GET", "/readyz", []fiber.Handler{probes.Readiness.Handler()}, readinessDoc},
+
+		{"GET", "/startupz", []fiber.Handler{probes.Startup.Handler()}, startupDoc},
+	}
+}
+
+// function to list every route of the api
+func apiRoutes(students *controllers.StudentController, events *controllers.StudentEvents, graphQL fiber.Handler, probes *health.Probes) []Route {
+	routes := append(StudentRoutes(students, graphQL), EventRoutes(events)...)
+	return append(routes, HealthRoutes(probes)...)
+}
+
+// function to generate the OpenAPI document out of the routes, openapi.json is expected to be the same
+// the document describes itself and the docs page as well
+func GenerateSpec() *openapi.Document {
+	routes := apiRoutes(&controllers.StudentController{}, &controllers.StudentEvents{}, nil, health.NewProbes())
+	return Spec(append(routes, Route{Method: "GET", Path: SpecPath, Operation: specDoc}, Route{Method: "GET", Path: DocsPath, Operation: docsDoc}))
+}
 
-	app.Get("/students", controllers.GetAllStudents)
+// function to connect the routes to the app
+// every route first goes through the validator of its operation in the committed document, so the requests the handlers get follow it
+// checkResponses also checks the responses against the document, an undocumented response is then turned into a 500
+func UserRoute(app *fiber.App, students *controllers.StudentController, events *controllers.StudentEvents, graphQL fiber.Handler, probes *health.Probes, checkResponses bool) error {
+	spec, err := Contract()
+	if err != nil {
+		return err
+	}
 
-	app.Get("/student/:userId", controllers.GetAStudent)
+	documented := spec.Operations()
+	for _, route := range apiRoutes(students, events, graphQL, probes) {
+		if !slices.Contains(documented, route.Method+" "+openapi.PathTemplate(route.Path)) {
+			return fmt.Errorf("%s %s is missing from the committed OpenAPI document, regenerate it (see TestOpenAPIDocument)", route.Method, route.Path)
+		}
 
-	app.Post("/student", controllers.CreateStudent)
+		handlers := append([]fiber.Handler{spec.Validator(route.Method, route.Path, checkResponses)}, route.Handlers...)
+		app.Add(route.Method, route.Path, handlers...)
+	}
 
-	app.Put("/student/:userId", controllers.EditAStudent)
+	app.Get(SpecPath, openapi.Handler(spec))
 
-	app.Delete("/student/:userId", controllers.DeleteAStudent)
+	app.Get(DocsPath, openapi.DocsHandler(SpecPath))
 
+	return nil
 }
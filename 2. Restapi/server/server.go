@@ -0,0 +1,167 @@
+// File responsible for building the application out of its dependencies
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"my-rest-api/cache"
+	"my-rest-api/configs"
+	"my-rest-api/controllers"
+	"my-rest-api/graph"
+	"my-rest-api/grpcserver"
+	"my-rest-api/health"
+	"my-rest-api/lifecycle"
+	"my-rest-api/logging"
+	"my-rest-api/metrics"
+	"my-rest-api/repository"
+	"my-rest-api/routes"
+	"my-rest-api/tracing"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// how often the change feed checks the audit log for new changes, when it cannot be watched
+const changeFeedInterval = time.Second
+
+// Server is the fully wired application
+// Nothing in here opens connections, everything is injected by the caller
+type Server struct {
+	App    *fiber.App
+	GRPC   *grpcserver.Server
+	config configs.Config
+
+	// the event streams of the http api, they are ended before it drains its requests
+	events *controllers.StudentEvents
+
+	// the probes of the orchestrator, the checks of the dependencies are registered by the caller
+	Health *health.Probes
+}
+
+// function to build the fiber app, the controllers and the routes from the given dependencies
+// the students read by ID go through studentCache, nil means they are not cached
+// the error is a mistake in the code, in the GraphQL schema or in the OpenAPI document
+func NewServer(cfg configs.Config, students repository.StudentRepository, audit repository.AuditRepository, studentCache cache.Cache) (*Server, error) {
+	// creating a fiber app, the errors returned by the handlers are all rendered by one error handler
+	app := fiber.New(fiber.Config{
+		ErrorHandler: controllers.ErrorHandler,
+		ReadTimeout:  cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write,
+		IdleTimeout:  cfg.Timeouts.Idle,
+	})
+
+	// the change feed watches the store itself when it can, so that the writes made without the api are streamed as well
+	watcher, _ := students.(repository.StudentWatcher)
+
+	// every change made through the handlers is recorded in the audit log
+	students = repository.NewAuditedStudentRepository(students, audit)
+
+	// the cache sits on top, so that every write of the apis invalidates it
+	// while the audit log still compares the changes with the student as it is stored
+	if studentCache != nil {
+		students = repository.NewCachedStudentRepository(students, studentCache)
+	}
+
+	// the GraphQL schema is generated from the student model, it can only fail on a mistake in the code
+	schema, err := graph.NewSchema(students)
+	if err != nil {
+		return nil, fmt.Errorf("graphql schema: %w", err)
+	}
+
+	// every request gets an ID and a log line, and is measured and traced, the ones which match no route as well
+	// (the middlewares are registered one after the other on purpose, fiber merges them into a single route
+	// which is how each of them tells that no route matched)
+	// the lines are written with the default logger, which main sets up
+	app.Use(logging.Middleware(slog.Default(), controllers.HeaderUser))
+	app.Use(metrics.Middleware)
+	app.Use(tracing.Middleware)
+
+	probes := health.NewProbes()
+
+	// the changes are streamed by the event routes and by the Watch call of the gRPC api
+	// out of the change stream of the students, or out of the audit log when they cannot be watched
+	feed := repository.NewChangeFeed(audit, watcher, changeFeedInterval)
+	events := controllers.NewStudentEvents(feed, cfg.Timeouts.Write)
+
+	// connecting the routes, the requests (and the responses when asked to) are checked against the OpenAPI document
+	if err := routes.UserRoute(app, controllers.NewStudentController(students, audit, cfg.TrashRetention, cfg.Timeouts.Request), events, graph.Handler(schema, students, cfg.Timeouts.Request), probes, cfg.ValidateResponses); err != nil {
+		return nil, fmt.Errorf("routes: %w", err)
+	}
+
+	// the gRPC api shares the same storage
+	grpcServer := grpcserver.NewServer(grpcserver.NewStudentService(students, feed))
+
+	return &Server{App: app, GRPC: grpcServer, config: cfg, Health: probes, events: events}, nil
+}
+
+// function to register the start and stop work of both apis, they are served on their configured addresses
+// and over TLS when a certificate is configured
+// on stop they refuse the new connections and drain the requests in progress until the context is done
+func (s *Server) Register(lc *lifecycle.Lifecycle) {
+	lc.Append(lifecycle.Hook{
+		Name: "http api",
+		OnStart: func(ctx context.Context) error {
+			listener, err := s.listen(s.config.ListenAddr, "http/1.1")
+			if err != nil {
+				return err
+			}
+
+			go func() {
+				if err := s.App.Listener(listener); err != nil {
+					lc.Fail(fmt.Errorf("http api: %w", err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// the event streams never end by themselves, the draining would wait for them otherwise
+			s.events.Shutdown()
+
+			if deadline, ok := ctx.Deadline(); ok {
+				return s.App.ShutdownWithTimeout(time.Until(deadline))
+			}
+			return s.App.Shutdown()
+		},
+	})
+
+	lc.Append(lifecycle.Hook{
+		Name: "grpc api",
+		OnStart: func(ctx context.Context) error {
+			listener, err := s.listen(s.config.GRPCAddr, "h2")
+			if err != nil {
+				return err
+			}
+
+			go func() {
+				if err := s.GRPC.Serve(listener); err != nil {
+					lc.Fail(fmt.Errorf("grpc api: %w", err))
+				}
+			}()
+			return nil
+		},
+		OnStop: s.GRPC.Shutdown,
+	})
+}
+
+// function to open the listener of an api, wrapped in TLS when a certificate is configured
+// the protocol is the one negotiated during the handshake, the REST api speaks HTTP/1.1 and gRPC runs on HTTP/2
+func (s *Server) listen(addr string, protocol string) (net.Listener, error) {
+	var config *tls.Config
+	if s.config.TLSEnabled() {
+		certificate, err := tls.LoadX509KeyPair(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: []string{protocol}, MinVersion: tls.VersionTLS12}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil || config == nil {
+		return listener, err
+	}
+	return tls.NewListener(listener, config), nil
+}
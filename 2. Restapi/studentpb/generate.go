@@ -0,0 +1,5 @@
+// Package studentpb holds the messages and the client and server stubs of the gRPC api, generated from proto/student.proto
+// NewStudentServiceClient is the Go client of the api
+package studentpb
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=my-rest-api --go-grpc_out=.. --go-grpc_opt=module=my-rest-api student.proto
@@ -0,0 +1,77 @@
+// File responsible for the server spans of the HTTP requests
+
+package tracing
+
+import (
+	"my-rest-api/middleware"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts the server span of every request of the app, it has to be registered with app.Use before the routes
+// the span continues the trace of the traceparent header when there is one, and is handed to the handlers through c.UserContext
+// the spans are named after the template of their route (e.g. GET /student/:userId) rather than their path
+// and get the real status of the errors
+func Middleware(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{header: &c.Request().Header})
+
+	// the values are copied since fiber reuses its memory once the request is over, and the spans are exported later
+	method := utils.CopyString(c.Method())
+	ctx, span := tracer().Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.HTTPMethod(method),
+		semconv.HTTPScheme(utils.CopyString(c.Protocol())),
+		semconv.HTTPTarget(utils.CopyString(c.Path())),
+		semconv.NetSockPeerAddr(c.Context().RemoteIP().String()),
+	))
+	defer span.End()
+
+	c.SetUserContext(ctx)
+	outcome, err := middleware.Next(c)
+	if err != nil {
+		return err
+	}
+
+	if outcome.Matched {
+		span.SetName(method + " " + outcome.Route)
+		span.SetAttributes(semconv.HTTPRoute(outcome.Route))
+	}
+
+	// only the failures of the server mark the span as failed, the mistakes of the client do not
+	span.SetAttributes(semconv.HTTPStatusCode(outcome.Status))
+	if outcome.Status >= http.StatusInternalServerError {
+		if outcome.Err != nil {
+			span.RecordError(outcome.Err)
+		}
+		span.SetStatus(codes.Error, http.StatusText(outcome.Status))
+	}
+
+	return nil
+}
+
+// headerCarrier reads and writes the trace context in the headers of a fasthttp request
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (h headerCarrier) Get(key string) string {
+	return string(h.header.Peek(key))
+}
+
+func (h headerCarrier) Set(key string, value string) {
+	h.header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.header.VisitAll(func(key []byte, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
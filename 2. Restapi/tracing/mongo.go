@@ -0,0 +1,104 @@
+// File responsible for the spans of the MongoDB commands, out of the command monitor of the driver
+
+package tracing
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// commandSpans holds the spans of the commands in progress, by the ID of their request
+type commandSpans struct {
+	mu    sync.Mutex
+	spans map[int64]trace.Span
+}
+
+func (s *commandSpans) put(requestID int64, span trace.Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans[requestID] = span
+}
+
+func (s *commandSpans) take(requestID int64) (trace.Span, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span, ok := s.spans[requestID]
+	delete(s.spans, requestID)
+	return span, ok
+}
+
+// function to build the command monitor making a span of every command, to set with options.Client().SetMonitor
+// only the commands sent while a span is in progress are traced, so the work done outside of the requests
+// (the indexes made on startup, the polling of the change feed) does not start traces of its own
+// the command itself is not recorded, it carries the data of the students
+func CommandMonitor() *event.CommandMonitor {
+	spans := &commandSpans{spans: map[int64]trace.Span{}}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+
+			name := e.CommandName
+			attributes := []attribute.KeyValue{semconv.DBSystemMongoDB, semconv.DBName(e.DatabaseName), semconv.DBOperation(e.CommandName)}
+			if collection := collectionName(e); collection != "" {
+				name = collection + "." + e.CommandName
+				attributes = append(attributes, semconv.DBMongoDBCollection(collection))
+			}
+			attributes = append(attributes, peerAttributes(e.ConnectionID)...)
+
+			_, span := tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+			spans.put(e.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			if span, ok := spans.take(e.RequestID); ok {
+				span.End()
+			}
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			if span, ok := spans.take(e.RequestID); ok {
+				span.SetStatus(codes.Error, e.Failure)
+				span.End()
+			}
+		},
+	}
+}
+
+// function to find the collection a command works on, it is the value of the first element for the commands which have one
+// e.g. {"find": "students", "filter": ...}
+func collectionName(e *event.CommandStartedEvent) string {
+	element, err := e.Command.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+
+	collection, _ := element.Value().StringValueOK()
+	return collection
+}
+
+// function to describe the server a command is sent to, out of the ID of the connection such as "localhost:27017[-4]"
+func peerAttributes(connectionID string) []attribute.KeyValue {
+	address, _, _ := strings.Cut(connectionID, "[")
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+
+	attributes := []attribute.KeyValue{semconv.NetPeerName(host)}
+	if number, err := strconv.Atoi(port); err == nil {
+		attributes = append(attributes, semconv.NetPeerPort(number))
+	}
+	return attributes
+}
@@ -0,0 +1,96 @@
+// Package tracing records where the time of a request goes, as OpenTelemetry spans
+// Every HTTP request gets a server span, continuing the trace of the caller when it sends a W3C traceparent header,
+// and the MongoDB commands, the decoding of the results and the validation of the bodies are spans within it
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"my-rest-api/configs"
+	"my-rest-api/lifecycle"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the name the spans of the api are recorded under
+const instrumentationName = "my-rest-api"
+
+// function to get the tracer of the api
+// it is looked up every time, so that the provider installed by Setup (or by a test) is the one used
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// function to install the W3C trace context propagator and the tracer provider of the configured exporter
+// with the none exporter the trace context is still read, but no span is recorded
+// the returned hook flushes the spans not exported yet when the api stops, so it has to be stopped after everything making spans
+func Setup(cfg configs.Tracing) (lifecycle.Hook, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	hook := lifecycle.Hook{Name: "tracing"}
+
+	exporter, err := newExporter(cfg)
+	if err != nil || exporter == nil {
+		return hook, err
+	}
+
+	service, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return hook, err
+	}
+
+	// the traces started by a caller keep the decision it made, the other ones are sampled at the configured ratio
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(service),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	hook.OnStop = provider.Shutdown
+	return hook, nil
+}
+
+// function to create the exporter of the spans, there is none with the none exporter
+func newExporter(cfg configs.Tracing) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case configs.ExporterStdout:
+		return stdouttrace.New()
+
+	case configs.ExporterOTLP:
+		// the connection to the collector is made in the background, an unreachable collector does not stop the api from starting
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+
+	case configs.ExporterNone:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+}
+
+// function to start a span as a child of the span of the context, e.g. around a piece of work of a handler
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// function to end a span started with Start, the error (if any) is recorded on it and marks it as failed
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
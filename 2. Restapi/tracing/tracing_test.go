@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// function to install a provider keeping the spans in memory, for the test to look at them
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+// function to find the value of an attribute of a span
+func attributeOf(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Get("/student/:userId", func(c *fiber.Ctx) error {
+		if c.Params("userId") == "broken" {
+			return errors.New("broken")
+		}
+
+		// the work of the handler is traced within the span of the request
+		_, span := Start(c.UserContext(), "work")
+		End(span, nil)
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/student/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	app.Test(req)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	work, server := spans[0], spans[1]
+
+	// the trace of the caller is continued
+	assert.Equal(t, "GET /student/:userId", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Equal(t, "/student/:userId", attributeOf(server, "http.route").AsString())
+	assert.Equal(t, int64(200), attributeOf(server, "http.status_code").AsInt64())
+	assert.Equal(t, codes.Unset, server.Status().Code)
+
+	assert.Equal(t, "work", work.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), work.Parent().SpanID())
+
+	// the errors are rendered before the span ends, a failure of the server marks the span as failed
+	app.Test(httptest.NewRequest("GET", "/student/broken", nil))
+	server = recorder.Ended()[2]
+	assert.Equal(t, int64(500), attributeOf(server, "http.status_code").AsInt64())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	if assert.Len(t, server.Events(), 1) {
+		assert.Equal(t, "exception", server.Events()[0].Name)
+	}
+	assert.False(t, server.Parent().IsValid(), "a request without traceparent starts a trace")
+
+	// the unknown paths are named after their method only, and are not failures
+	app.Test(httptest.NewRequest("GET", "/nowhere", nil))
+	server = recorder.Ended()[3]
+	assert.Equal(t, "GET", server.Name())
+	assert.Equal(t, int64(404), attributeOf(server, "http.status_code").AsInt64())
+	assert.Equal(t, codes.Unset, server.Status().Code)
+}
+
+func TestCommandMonitor(t *testing.T) {
+	recorder := record(t)
+	monitor := CommandMonitor()
+
+	ctx, parent := Start(context.Background(), "request")
+
+	find, _ := bson.Marshal(bson.D{{Key: "find", Value: "students"}, {Key: "filter", Value: bson.D{{Key: "name", Value: "Ada"}}}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: find, DatabaseName: "Records", CommandName: "find", RequestID: 1, ConnectionID: "db:27017[-3]"})
+	ping, _ := bson.Marshal(bson.D{{Key: "ping", Value: 1}})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: ping, DatabaseName: "admin", CommandName: "ping", RequestID: 2, ConnectionID: "db:27017[-4]"})
+
+	// a command sent outside of a span is not traced
+	monitor.Started(context.Background(), &event.CommandStartedEvent{Command: find, DatabaseName: "Records", CommandName: "find", RequestID: 3})
+
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "ping", RequestID: 2}, Failure: "unreachable"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1}})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 3}})
+	parent.End()
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+
+	ping1, find1 := spans[0], spans[1]
+	assert.Equal(t, "ping", ping1.Name())
+	assert.Equal(t, codes.Error, ping1.Status().Code)
+	assert.Equal(t, "unreachable", ping1.Status().Description)
+
+	assert.Equal(t, "students.find", find1.Name())
+	assert.Equal(t, trace.SpanKindClient, find1.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), find1.Parent().SpanID())
+	assert.Equal(t, "mongodb", attributeOf(find1, "db.system").AsString())
+	assert.Equal(t, "Records", attributeOf(find1, "db.name").AsString())
+	assert.Equal(t, "students", attributeOf(find1, "db.mongodb.collection").AsString())
+	assert.Equal(t, "db", attributeOf(find1, "net.peer.name").AsString())
+	assert.Equal(t, int64(27017), attributeOf(find1, "net.peer.port").AsInt64())
+	for _, kv := range find1.Attributes() {
+		assert.NotContains(t, kv.Value.Emit(), "Ada", "the command is not recorded")
+	}
+}